@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
+	ewf "github.com/asalih/go-ewf"
 	"github.com/asalih/go-ewf/evf1"
 	"github.com/asalih/go-ewf/evf2"
+	"github.com/asalih/go-ewf/shared"
 )
 
 const version = "1.0.0"
@@ -53,7 +57,7 @@ Commands:
   dump      Extract data from an EWF image to raw format
   create    Create an EWF image from raw data
   info      Display information about an EWF image
-  verify    Verify/benchmark EWF image by reading all data
+  verify    Verify the stored MD5/SHA1 hashes of an EWF image
   version   Show version information
   help      Show this help message
 
@@ -69,6 +73,7 @@ func dumpCommand() {
 	length := fs.Int64("length", -1, "Number of bytes to extract (-1 for all)")
 	bufferSize := fs.Int("buffer", 1024*1024, "Buffer size in bytes (default: 1MB)")
 	verbose := fs.Bool("verbose", false, "Verbose output")
+	recoverImage := fs.Bool("recover", false, "Read the data of an interrupted acquisition")
 
 	err := fs.Parse(os.Args[2:])
 	if err != nil {
@@ -82,7 +87,7 @@ func dumpCommand() {
 		os.Exit(1)
 	}
 
-	if err := dumpImage(*source, *target, *offset, *length, *bufferSize, *verbose); err != nil {
+	if err := dumpImage(*source, *target, *offset, *length, *bufferSize, *verbose, *recoverImage); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -106,6 +111,11 @@ func createCommand() {
 	driveModel := fs.String("drive-model", "", "Drive model (EVF2 only)")
 	serialNumber := fs.String("serial-number", "", "Serial number (EVF2 only)")
 
+	compression := fs.String("compression", "best", "Compression level: none, fast or best (EVF1 only)")
+	segmentSize := fs.Int64("segment-size", 0, "Maximum segment file size in bytes, 0 for a single segment")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of compression workers")
+	sectorSize := fs.Uint("sector-size", 512, "Bytes per sector")
+	sectorsPerChunk := fs.Uint("sectors-per-chunk", 64, "Number of sectors per chunk")
 	bufferSize := fs.Int("buffer", 1024*1024, "Buffer size in bytes (default: 1MB)")
 	verbose := fs.Bool("verbose", false, "Verbose output")
 
@@ -131,7 +141,15 @@ func createCommand() {
 		SerialNumber:   *serialNumber,
 	}
 
-	if err := createImage(*source, *target, *format, metadata, *bufferSize, *verbose); err != nil {
+	options := WriterOptions{
+		Compression:     *compression,
+		SegmentSize:     *segmentSize,
+		Workers:         *workers,
+		SectorSize:      uint32(*sectorSize),
+		SectorsPerChunk: uint32(*sectorsPerChunk),
+	}
+
+	if err := createImage(*source, *target, *format, metadata, options, *bufferSize, *verbose); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -141,6 +159,8 @@ func createCommand() {
 func infoCommand() {
 	fs := flag.NewFlagSet("info", flag.ExitOnError)
 	source := fs.String("source", "", "Source EWF image file (required)")
+	recoverImage := fs.Bool("recover", false, "Open an interrupted acquisition and report what can be recovered")
+	strict := fs.Bool("strict", false, "Validate the checksums of the sections and chunks")
 
 	err := fs.Parse(os.Args[2:])
 	if err != nil {
@@ -154,17 +174,17 @@ func infoCommand() {
 		os.Exit(1)
 	}
 
-	if err := showImageInfo(*source); err != nil {
+	if err := showImageInfo(*source, shared.OpenOptions{Recover: *recoverImage, Strict: *strict}); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 }
 
-// verifyCommand reads and verifies an EWF image by reading all data (performance test)
+// verifyCommand reads all data of an EWF image and verifies its stored hashes
 func verifyCommand() {
 	fs := flag.NewFlagSet("verify", flag.ExitOnError)
 	source := fs.String("source", "", "Source EWF image file (required)")
-	bufferSize := fs.Int("buffer", 1024*1024, "Buffer size in bytes (default: 1MB)")
+	recoverImage := fs.Bool("recover", false, "Read the data of an interrupted acquisition")
 
 	err := fs.Parse(os.Args[2:])
 	if err != nil {
@@ -178,7 +198,7 @@ func verifyCommand() {
 		os.Exit(1)
 	}
 
-	if err := verifyImage(*source, *bufferSize); err != nil {
+	if err := verifyImage(*source, *recoverImage); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -194,113 +214,35 @@ type Metadata struct {
 	SerialNumber   string
 }
 
-// openAllSegments opens all segment files for a given base file
-// E.g., if given "image.E01", it will also open image.E02, image.E03, etc.
-// or for "image.Ex01", it will open image.Ex02, image.Ex03, etc.
-func openAllSegments(basePath string) ([]*os.File, error) {
-	files := make([]*os.File, 0)
-
-	// Open the first file
-	f, err := os.Open(basePath)
-	if err != nil {
-		return nil, err
-	}
-	files = append(files, f)
-
-	// Detect the pattern (E01, E02, ... or Ex01, Ex02, ...)
-	ext := filepath.Ext(basePath)
-	base := strings.TrimSuffix(basePath, ext)
-
-	// Determine if it's E01/Ex01 format
-	extUpper := strings.ToUpper(ext)
-	var pattern string
-	var startNum int
-
-	if strings.HasPrefix(extUpper, ".E") && len(extUpper) == 4 {
-		// E01, E02, E03 format
-		pattern = ".E%02d"
-		startNum = 2 // Start with E02 since E01 is already open
-	} else if strings.HasPrefix(extUpper, ".EX") && len(extUpper) == 5 {
-		// Ex01, Ex02, Ex03 format
-		pattern = ".Ex%02d"
-		startNum = 2
-	} else {
-		// Not a segmented format or unrecognized, just return the first file
-		return files, nil
-	}
-
-	// Try to open subsequent segments
-	for i := startNum; i < 100; i++ { // Reasonable limit of 100 segments
-		segmentExt := fmt.Sprintf(pattern, i)
-		segmentPath := base + segmentExt
-
-		f, err := os.Open(segmentPath)
-		if err != nil {
-			// No more segments
-			break
-		}
-		files = append(files, f)
-	}
-
-	return files, nil
+type WriterOptions struct {
+	Compression     string
+	SegmentSize     int64
+	Workers         int
+	SectorSize      uint32
+	SectorsPerChunk uint32
 }
 
-func dumpImage(source, target string, offset, length int64, bufferSize int, verbose bool) error {
+func dumpImage(source, target string, offset, length int64, bufferSize int, verbose, recoverImage bool) error {
 	if verbose {
 		fmt.Printf("Opening EWF image: %s\n", source)
 	}
 
-	// Open all segment files
-	segmentFiles, err := openAllSegments(source)
+	reader, err := ewf.Open(source, shared.OpenOptions{Recover: recoverImage})
 	if err != nil {
-		return fmt.Errorf("failed to open segment files: %w", err)
+		return fmt.Errorf("failed to open image: %w", err)
 	}
-	defer func() {
-		for _, f := range segmentFiles {
-			_ = f.Close()
-		}
-	}()
+	defer reader.Close()
 
-	if verbose && len(segmentFiles) > 1 {
-		fmt.Printf("Found %d segment files\n", len(segmentFiles))
-	}
-
-	// Try to detect format and open
-	var reader io.ReadSeeker
-	var size int64
-
-	// Convert to ReadSeeker slice
-	seekers := make([]io.ReadSeeker, len(segmentFiles))
-	for i, f := range segmentFiles {
-		seekers[i] = f
+	if verbose {
+		fmt.Printf("Detected format: %s\n", reader.Format)
 	}
 
-	// Try EVF2 first
-	ewf2, err := evf2.OpenEWF(seekers...)
-	if err == nil {
-		reader = ewf2
-		size = ewf2.Size()
-		if verbose {
-			fmt.Printf("Detected format: EVF2 (Ex01)\n")
-			fmt.Printf("Image size: %d bytes (%.2f GB)\n", size, float64(size)/(1024*1024*1024))
-		}
-	} else {
-		// Reset all files and try EVF1
-		for _, f := range segmentFiles {
-			if _, err := f.Seek(0, io.SeekStart); err != nil {
-				return fmt.Errorf("failed to seek to start: %w", err)
-			}
-		}
-		ewf1, err := evf1.OpenEWF(seekers...)
-		if err != nil {
-			return fmt.Errorf("failed to open as EVF1 or EVF2: %w", err)
-		}
-		reader = ewf1
-		size = ewf1.Size()
-		if verbose {
-			fmt.Printf("Detected format: EVF1 (E01)\n")
-			fmt.Printf("Image size: %d bytes (%.2f GB)\n", size, float64(size)/(1024*1024*1024))
+	size := reader.Size()
+	if verbose {
+		if segments := reader.SegmentCount(); segments > 1 {
+			fmt.Printf("Found %d segment files\n", segments)
 		}
+		fmt.Printf("Image size: %d bytes (%.2f GB)\n", size, float64(size)/(1024*1024*1024))
 	}
 
 	// Validate offset and length
@@ -380,7 +322,7 @@ func dumpImage(source, target string, offset, length int64, bufferSize int, verb
 	return nil
 }
 
-func createImage(source, target, format string, metadata Metadata, bufferSize int, verbose bool) error {
+func createImage(source, target, format string, metadata Metadata, options WriterOptions, bufferSize int, verbose bool) error {
 	format = strings.ToLower(format)
 	if format != "evf1" && format != "evf2" {
 		return fmt.Errorf("invalid format: %s (must be evf1 or evf2)", format)
@@ -405,6 +347,18 @@ func createImage(source, target, format string, metadata Metadata, bufferSize in
 	}
 
 	sourceSize := sourceInfo.Size()
+	// block devices report a size of 0, they end where a seek to their end lands
+	if !sourceInfo.Mode().IsRegular() {
+		if end, err := sourceFile.Seek(0, io.SeekEnd); err == nil {
+			if _, err := sourceFile.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek source file: %w", err)
+			}
+			sourceSize = end
+		} else if format == "evf2" {
+			// the media size is recorded ahead of the data
+			return fmt.Errorf("evf2 needs the size of the source up front, use -format evf1 for pipes")
+		}
+	}
 	if verbose {
 		fmt.Printf("Source size: %d bytes (%.2f GB)\n", sourceSize, float64(sourceSize)/(1024*1024*1024))
 	}
@@ -433,9 +387,9 @@ func createImage(source, target, format string, metadata Metadata, bufferSize in
 	var written int64
 
 	if format == "evf1" {
-		written, err = createEVF1Image(sourceFile, targetFile, sourceSize, metadata, bufferSize, verbose)
+		written, err = createEVF1Image(sourceFile, targetFile, target, sourceSize, metadata, options, bufferSize, verbose)
 	} else {
-		written, err = createEVF2Image(sourceFile, targetFile, sourceSize, metadata, bufferSize, verbose)
+		written, err = createEVF2Image(sourceFile, targetFile, target, sourceSize, metadata, options, bufferSize, verbose)
 	}
 
 	if err != nil {
@@ -451,12 +405,41 @@ func createImage(source, target, format string, metadata Metadata, bufferSize in
 	return nil
 }
 
-func createEVF1Image(source io.Reader, target io.WriteSeeker, size int64, metadata Metadata, bufferSize int, verbose bool) (int64, error) {
+func createEVF1Image(source io.Reader, target io.WriteSeeker, targetPath string, size int64, metadata Metadata, options WriterOptions, bufferSize int, verbose bool) (int64, error) {
 	creator, err := evf1.CreateEWF(target)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create EVF1 writer: %w", err)
 	}
 
+	switch strings.ToLower(options.Compression) {
+	case "none":
+		creator.SetCompressionLevel(evf1.None)
+	case "fast":
+		creator.SetCompressionLevel(evf1.Good)
+	case "best", "":
+		creator.SetCompressionLevel(evf1.Best)
+	default:
+		return 0, fmt.Errorf("invalid compression level: %s (must be none, fast or best)", options.Compression)
+	}
+
+	creator.SetSectorGeometry(options.SectorSize, options.SectorsPerChunk)
+	if err := creator.SetCompressionWorkers(options.Workers, 0); err != nil {
+		return 0, err
+	}
+
+	if options.SegmentSize > 0 {
+		creator.SetSegmentSize(options.SegmentSize, func(segmentNumber uint16) (io.WriteSeeker, error) {
+			segmentPath, err := shared.SegmentPath(targetPath, segmentNumber)
+			if err != nil {
+				return nil, err
+			}
+			if verbose {
+				fmt.Printf("\nOutput segment: %s\n", segmentPath)
+			}
+			return os.Create(segmentPath)
+		})
+	}
+
 	// Add metadata
 	if metadata.CaseNumber != "" {
 		creator.AddMediaInfo(evf1.EWF_HEADER_VALUES_INDEX_CASE_NUMBER, metadata.CaseNumber)
@@ -515,12 +498,30 @@ func createEVF1Image(source io.Reader, target io.WriteSeeker, size int64, metada
 	return written, nil
 }
 
-func createEVF2Image(source io.Reader, target io.Writer, size int64, metadata Metadata, bufferSize int, verbose bool) (int64, error) {
+func createEVF2Image(source io.Reader, target io.Writer, targetPath string, size int64, metadata Metadata, options WriterOptions, bufferSize int, verbose bool) (int64, error) {
 	creator, err := evf2.CreateEWF(target)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create EVF2 writer: %w", err)
 	}
 
+	creator.SetSectorGeometry(options.SectorSize, options.SectorsPerChunk)
+	if err := creator.SetCompressionWorkers(options.Workers, 0); err != nil {
+		return 0, err
+	}
+
+	if options.SegmentSize > 0 {
+		creator.SetSegmentSize(options.SegmentSize, func(segmentNumber uint16) (io.Writer, error) {
+			segmentPath, err := shared.SegmentPath(targetPath, segmentNumber)
+			if err != nil {
+				return nil, err
+			}
+			if verbose {
+				fmt.Printf("\nOutput segment: %s\n", segmentPath)
+			}
+			return os.Create(segmentPath)
+		})
+	}
+
 	// Add case data metadata
 	if metadata.CaseNumber != "" {
 		creator.AddCaseData(evf2.EWF_CASE_DATA_CASE_NUMBER, metadata.CaseNumber)
@@ -587,157 +588,120 @@ func createEVF2Image(source io.Reader, target io.Writer, size int64, metadata Me
 	return written, nil
 }
 
-func verifyImage(source string, bufferSize int) error {
+func verifyImage(source string, recoverImage bool) error {
 	fmt.Printf("Opening EWF image: %s\n", source)
 
-	// Open all segment files
-	segmentFiles, err := openAllSegments(source)
+	reader, err := ewf.Open(source, shared.OpenOptions{Recover: recoverImage})
 	if err != nil {
-		return fmt.Errorf("failed to open segment files: %w", err)
-	}
-	defer func() {
-		for _, f := range segmentFiles {
-			_ = f.Close()
-		}
-	}()
-
-	fmt.Printf("Found %d segment file(s)\n", len(segmentFiles))
-
-	// Convert to ReadSeeker slice
-	seekers := make([]io.ReadSeeker, len(segmentFiles))
-	for i, f := range segmentFiles {
-		seekers[i] = f
+		return fmt.Errorf("failed to open image: %w", err)
 	}
+	defer reader.Close()
 
-	// Try to detect format and open
-	var reader io.Reader
-	var size int64
-	var format string
-
-	// Try EVF2 first
-	ewf2, err := evf2.OpenEWF(seekers...)
-	if err == nil {
-		reader = ewf2
-		size = ewf2.Size()
-		format = "EVF2 (Ex01)"
-	} else {
-		// Reset all files and try EVF1
-		for _, f := range segmentFiles {
-			if _, err := f.Seek(0, io.SeekStart); err != nil {
-				return fmt.Errorf("failed to seek to start: %w", err)
-			}
-		}
-		ewf1, err := evf1.OpenEWF(seekers...)
-		if err != nil {
-			return fmt.Errorf("failed to open as EVF1 or EVF2: %w", err)
-		}
-		reader = ewf1
-		size = ewf1.Size()
-		format = "EVF1 (E01)"
+	fmt.Printf("Found %d segment file(s)\n", reader.SegmentCount())
+	if recovery := reader.Recovery(); recovery != nil && recovery.Truncated() {
+		fmt.Printf("Interrupted acquisition: verifying the %d recovered bytes\n", recovery.Size)
 	}
 
-	fmt.Printf("Format: %s\n", format)
+	size := reader.Size()
+	fmt.Printf("Format: %s\n", reader.Format)
 	fmt.Printf("Image size: %d bytes (%.2f GB)\n", size, float64(size)/(1024*1024*1024))
-	fmt.Printf("Buffer size: %d bytes (%.2f MB)\n", bufferSize, float64(bufferSize)/(1024*1024))
-	fmt.Println("\nReading and verifying all data...")
+	fmt.Println("\nReading all data and computing hashes...")
 
-	// Read all data to discard (for performance testing)
-	buffer := make([]byte, bufferSize)
-	var totalRead int64
 	startTime := time.Now()
 	lastUpdate := time.Now()
 
-	for {
-		n, err := reader.Read(buffer)
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("read error at position %d: %w", totalRead, err)
-		}
-
-		if n == 0 {
-			break
-		}
-
-		totalRead += int64(n)
-
+	result, err := reader.VerifyHashes(context.Background(), func(processed, total int64) {
 		// Show progress every second
 		if time.Since(lastUpdate) >= time.Second {
 			elapsed := time.Since(startTime)
-			rate := float64(totalRead) / elapsed.Seconds() / (1024 * 1024)
-			progress := float64(totalRead) / float64(size) * 100
-			fmt.Printf("\rProgress: %.2f%% (%d/%d bytes) - %.2f MB/s", progress, totalRead, size, rate)
+			rate := float64(processed) / elapsed.Seconds() / (1024 * 1024)
+			progress := float64(processed) / float64(total) * 100
+			fmt.Printf("\rProgress: %.2f%% (%d/%d bytes) - %.2f MB/s", progress, processed, total, rate)
 			lastUpdate = time.Now()
 		}
-
-		if err == io.EOF {
-			break
-		}
+	})
+	if err != nil {
+		return err
 	}
 
 	elapsed := time.Since(startTime)
-	rate := float64(totalRead) / elapsed.Seconds() / (1024 * 1024)
+	rate := float64(result.BytesRead) / elapsed.Seconds() / (1024 * 1024)
 
 	fmt.Printf("\r\n\n=== Verification Complete ===\n")
-	fmt.Printf("Total read: %d bytes (%.2f GB)\n", totalRead, float64(totalRead)/(1024*1024*1024))
-	fmt.Printf("Expected:   %d bytes (%.2f GB)\n", size, float64(size)/(1024*1024*1024))
+	fmt.Printf("Total read: %d bytes (%.2f GB)\n", result.BytesRead, float64(result.BytesRead)/(1024*1024*1024))
 	fmt.Printf("Time:       %s\n", elapsed.Round(time.Millisecond))
-	fmt.Printf("Rate:       %.2f MB/s\n", rate)
+	fmt.Printf("Rate:       %.2f MB/s\n\n", rate)
 
-	if totalRead < size {
-		fmt.Printf("\n⚠️  Warning: Read less data than expected (%d < %d)\n", totalRead, size)
-		fmt.Printf("This might be due to padding at the end of the image.\n")
-	} else {
-		fmt.Printf("\n✅ Successfully read all data!\n")
+	printHashResult("MD5", result.MD5)
+	printHashResult("SHA1", result.SHA1)
+
+	if !result.HasStoredHashes() {
+		fmt.Printf("\n⚠️  Warning: Image has no stored hashes to verify against\n")
+		return nil
+	}
+	if result.Mismatch() {
+		return fmt.Errorf("stored hashes do not match the image data")
 	}
 
+	fmt.Printf("\n✅ Stored hashes match the image data!\n")
 	return nil
 }
 
-func showImageInfo(source string) error {
-	// Open all segment files
-	segmentFiles, err := openAllSegments(source)
+func printHashResult(name string, h shared.HashResult) {
+	fmt.Printf("%s computed: %x\n", name, h.Computed)
+	switch {
+	case !h.IsStored():
+		fmt.Printf("%s stored:   (none)\n", name)
+	case h.Match():
+		fmt.Printf("%s stored:   %x (match)\n", name, h.Stored)
+	default:
+		fmt.Printf("%s stored:   %x (MISMATCH)\n", name, h.Stored)
+	}
+}
+
+func showImageInfo(source string, opts shared.OpenOptions) error {
+	reader, err := ewf.Open(source, opts)
 	if err != nil {
-		return fmt.Errorf("failed to open segment files: %w", err)
+		return fmt.Errorf("failed to open image: %w", err)
 	}
-	defer func() {
-		for _, f := range segmentFiles {
-			_ = f.Close()
-		}
-	}()
+	defer reader.Close()
 
-	// Convert to ReadSeeker slice
-	seekers := make([]io.ReadSeeker, len(segmentFiles))
-	for i, f := range segmentFiles {
-		seekers[i] = f
+	if ewf1, ok := reader.EVF1(); ok {
+		showEVF1Info(source, reader.Format, ewf1)
+	} else if ewf2, ok := reader.EVF2(); ok {
+		showEVF2Info(source, reader.Format, ewf2)
 	}
+	printRecovery(reader.Recovery())
+	return nil
+}
 
-	// Try EVF2 first
-	ewf2, err := evf2.OpenEWF(seekers...)
-	if err == nil {
-		showEVF2Info(source, ewf2, len(segmentFiles))
-		return nil
+// printRecovery reports how much of an image opened in recovery mode could be read
+func printRecovery(recovery *shared.Recovery) {
+	if recovery == nil {
+		return
 	}
 
-	// Reset all files and try EVF1
-	for _, f := range segmentFiles {
-		if _, err := f.Seek(0, io.SeekStart); err != nil {
-			return fmt.Errorf("failed to seek to start: %w", err)
-		}
+	fmt.Printf("\nRecovery:\n")
+	fmt.Printf("  Recovered: %d bytes (%.2f GB)\n", recovery.Size, float64(recovery.Size)/(1024*1024*1024))
+	if recovery.RecordedSize > 0 {
+		fmt.Printf("  Recorded:  %d bytes (%.2f GB)\n", recovery.RecordedSize, float64(recovery.RecordedSize)/(1024*1024*1024))
+	} else {
+		fmt.Printf("  Recorded:  unknown, the acquisition stopped before the media size was written\n")
 	}
-	ewf1, err := evf1.OpenEWF(seekers...)
-	if err != nil {
-		return fmt.Errorf("failed to open as EVF1 or EVF2: %w", err)
+	for _, segment := range recovery.Segments {
+		fmt.Printf("  Segment %d: chunks found by scanning, its sections end early\n", segment)
+	}
+	if !recovery.Truncated() {
+		fmt.Printf("  The image is complete\n")
 	}
-
-	showEVF1Info(source, ewf1, len(segmentFiles))
-	return nil
 }
 
-func showEVF1Info(source string, reader *evf1.EWFReader, segmentCount int) {
+func showEVF1Info(source string, format ewf.Format, reader *evf1.EWFReader) {
 	fmt.Printf("EWF Image Information\n")
 	fmt.Printf("=====================\n\n")
 	fmt.Printf("File: %s\n", filepath.Base(source))
-	fmt.Printf("Format: EVF1 (E01)\n")
-	fmt.Printf("Segments: %d\n", segmentCount)
+	fmt.Printf("Format: %s\n", format)
+	fmt.Printf("Segments: %d\n", reader.SegmentCount())
 	fmt.Printf("Size: %d bytes (%.2f GB)\n", reader.Size(), float64(reader.Size())/(1024*1024*1024))
 	fmt.Printf("Chunk Size: %d bytes\n", reader.ChunkSize)
 	fmt.Printf("\nMetadata:\n")
@@ -748,14 +712,68 @@ func showEVF1Info(source string, reader *evf1.EWFReader, segmentCount int) {
 			fmt.Printf("  %s: %s\n", key, strValue)
 		}
 	}
+
+	ranges, err := reader.Errors()
+	if err != nil {
+		fmt.Printf("\nWarning: failed to read all segments: %v\n", err)
+		return
+	}
+	printSectorErrors(ranges)
+
+	sessions, err := reader.Sessions()
+	if err != nil {
+		fmt.Printf("\nWarning: failed to read the session section: %v\n", err)
+		return
+	}
+	printSessions(sessions)
+
+	fallbacks, err := reader.TableFallbacks()
+	if err != nil {
+		fmt.Printf("\nWarning: failed to read all segments: %v\n", err)
+		return
+	}
+	if len(fallbacks) > 0 {
+		fmt.Printf("\nDamaged tables:\n")
+		for _, f := range fallbacks {
+			fmt.Printf("  %s\n", f)
+		}
+	}
+}
+
+// printSectorErrors lists the sector ranges that could not be read during acquisition
+func printSectorErrors(ranges []shared.SectorRange) {
+	if len(ranges) == 0 {
+		return
+	}
+
+	fmt.Printf("\nAcquisition Errors (zero filled):\n")
+	for _, r := range ranges {
+		fmt.Printf("  Sectors %d-%d (%d sectors)\n", r.First, r.First+r.Count-1, r.Count)
+	}
+}
+
+// printSessions lists the sessions and tracks of optical media
+func printSessions(sessions []shared.Session) {
+	if len(sessions) == 0 {
+		return
+	}
+
+	fmt.Printf("\nSessions:\n")
+	for i, s := range sessions {
+		kind := "Session"
+		if s.Flags&shared.SessionFlagAudioTrack != 0 {
+			kind = "Audio track"
+		}
+		fmt.Printf("  %d. %s: sectors %d-%d (%d sectors, flags 0x%08x)\n", i+1, kind, s.Range.First, s.Range.First+s.Range.Count-1, s.Range.Count, s.Flags)
+	}
 }
 
-func showEVF2Info(source string, reader *evf2.EWFReader, segmentCount int) {
+func showEVF2Info(source string, format ewf.Format, reader *evf2.EWFReader) {
 	fmt.Printf("EWF Image Information\n")
 	fmt.Printf("=====================\n\n")
 	fmt.Printf("File: %s\n", filepath.Base(source))
-	fmt.Printf("Format: EVF2 (Ex01)\n")
-	fmt.Printf("Segments: %d\n", segmentCount)
+	fmt.Printf("Format: %s\n", format)
+	fmt.Printf("Segments: %d\n", reader.SegmentCount())
 	fmt.Printf("Size: %d bytes (%.2f GB)\n", reader.Size(), float64(reader.Size())/(1024*1024*1024))
 	fmt.Printf("Chunk Size: %d bytes\n", reader.ChunkSize)
 	fmt.Printf("\nMetadata:\n")
@@ -771,4 +789,18 @@ func showEVF2Info(source string, reader *evf2.EWFReader, segmentCount int) {
 			}
 		}
 	}
+
+	ranges, err := reader.Errors()
+	if err != nil {
+		fmt.Printf("\nWarning: failed to read the error table: %v\n", err)
+		return
+	}
+	printSectorErrors(ranges)
+
+	sessions, err := reader.Sessions()
+	if err != nil {
+		fmt.Printf("\nWarning: failed to read the session table: %v\n", err)
+		return
+	}
+	printSessions(sessions)
 }
@@ -17,9 +17,11 @@ const defaultMaxTableLength uint32 = 16375
 var maxTableLength uint32 = defaultMaxTableLength
 
 const (
-	DefaultChunkSize = 32768
-	ChecksumSize     = 4
-	Uint32Size       = 4
+	DefaultSectorSize      = 512
+	DefaultSectorsPerChunk = 64
+	DefaultChunkSize       = DefaultSectorSize * DefaultSectorsPerChunk
+	ChecksumSize           = 4
+	Uint32Size             = 4
 )
 
 const (
@@ -37,4 +39,5 @@ const (
 	EWF_SECTION_TYPE_HASH    = "hash"
 	EWF_SECTION_TYPE_DIGEST  = "digest"
 	EWF_SECTION_TYPE_DONE    = "done"
+	EWF_SECTION_TYPE_LTREE   = "ltree"
 )
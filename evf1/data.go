@@ -65,3 +65,35 @@ func (d *EWFDataSection) Encode(ewf io.WriteSeeker) error {
 	_, d.Checksum, err = shared.WriteWithSum(ewf, d)
 	return err
 }
+
+func (d *EWFDataSection) fromVolume(vol EWFVolume) {
+	d.ChunkCount = vol.GetChunkCount()
+	d.SectorPerChunk = vol.GetSectorCount()
+	d.BytesPerSector = vol.GetSectorSize()
+	d.Sectors = vol.GetTotalSectorCount()
+	if v, ok := vol.(*EWFVolumeSectionData); ok {
+		d.GUID = v.UUID
+	}
+}
+
+// rewrite updates the data of an already encoded data section at dataOffset in its place.
+func (d *EWFDataSection) rewrite(ewf io.WriteSeeker, dataOffset int64) (err error) {
+	currentPosition, err := ewf.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, errs := ewf.Seek(currentPosition, io.SeekStart)
+		if err == nil {
+			err = errs
+		}
+	}()
+
+	_, err = ewf.Seek(dataOffset, io.SeekStart)
+	if err != nil {
+		return
+	}
+
+	_, d.Checksum, err = shared.WriteWithSum(ewf, d)
+	return
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/asalih/go-ewf/shared"
 )
 
 type EWFSectionDescriptorData struct {
@@ -68,3 +70,28 @@ func NewEWFSectionDescriptor(fh io.ReadSeeker) (*EWFSectionDescriptor, error) {
 func (esd *EWFSectionDescriptor) String() string {
 	return fmt.Sprintf("<EWFSection type=%s size=0x%x offset=0x%x checksum=0x%x>", esd.Type, esd.Size, esd.offset, esd.Checksum)
 }
+
+// end returns the offset in the segment file right after the section, Size does not include the
+// descriptor
+func (esd *EWFSectionDescriptor) end() int64 {
+	return esd.offset + int64(DescriptorSize) + int64(esd.Size)
+}
+
+// verifyChecksum validates the checksum of the descriptor read from the given segment
+func (esd *EWFSectionDescriptor) verifyChecksum(segmentNumber uint16) error {
+	sum, err := shared.Checksum(esd.Descriptor)
+	if err != nil {
+		return err
+	}
+	if sum != esd.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: esd.offset,
+			Chunk:         -1,
+			Section:       "section descriptor",
+			Stored:        esd.Checksum,
+			Computed:      sum,
+		}
+	}
+	return nil
+}
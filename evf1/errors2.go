@@ -0,0 +1,170 @@
+package evf1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// EWFErrors2Section lists the sector ranges that could not be read during acquisition,
+// the sectors are stored zero filled.
+type EWFErrors2Section struct {
+	Header  *EWFErrors2SectionHeader
+	Entries []EWFErrors2SectionEntry
+	Footer  *EWFErrors2SectionFooter
+
+	// damaged is the checksum mismatch of the section, nil when the checksums match
+	damaged error
+}
+
+type EWFErrors2SectionHeader struct {
+	NumEntries uint32
+	Padding    [512]uint8
+	Checksum   uint32
+}
+
+type EWFErrors2SectionEntry struct {
+	FirstSector uint32
+	SectorCount uint32
+}
+
+type EWFErrors2SectionFooter struct {
+	Checksum uint32
+}
+
+func (d *EWFErrors2Section) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, segment *EWFSegment) error {
+	_, err := fh.Seek(section.DataOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	header := EWFErrors2SectionHeader{}
+	err = binary.Read(fh, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	d.Header = &header
+
+	entrySize := int64(binary.Size(EWFErrors2SectionEntry{}))
+	if int64(binary.Size(header))+int64(header.NumEntries)*entrySize > int64(section.Size) {
+		return fmt.Errorf("errors2 section at 0x%x has %d entries, more than the section holds", section.offset, header.NumEntries)
+	}
+
+	d.Entries = make([]EWFErrors2SectionEntry, header.NumEntries)
+	err = binary.Read(fh, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return err
+	}
+
+	footer := EWFErrors2SectionFooter{}
+	err = binary.Read(fh, binary.LittleEndian, &footer)
+	if err != nil {
+		return err
+	}
+	d.Footer = &footer
+
+	// ranges of a damaged section are not reported, strict mode fails to open the image
+	d.damaged = d.verifyChecksums(section, segment.EWFHeader.SegmentNumber)
+	if segment.strict {
+		return d.damaged
+	}
+
+	return nil
+}
+
+func (d *EWFErrors2Section) Encode(ewf io.WriteSeeker) error {
+	currentPosition, err := ewf.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if d.Header == nil {
+		d.Header = &EWFErrors2SectionHeader{}
+	}
+	if d.Footer == nil {
+		d.Footer = &EWFErrors2SectionFooter{}
+	}
+	d.Header.NumEntries = uint32(len(d.Entries))
+
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_ERRORS2)
+	desc.Size = uint64(binary.Size(d.Header)+binary.Size(d.Entries)+binary.Size(d.Footer)) + DescriptorSize
+	desc.Next = desc.Size + uint64(currentPosition)
+
+	_, desc.Checksum, err = shared.WriteWithSum(ewf, desc)
+	if err != nil {
+		return err
+	}
+
+	_, d.Header.Checksum, err = shared.WriteWithSum(ewf, d.Header)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = binary.Write(buf, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return err
+	}
+	// only entries data
+	d.Footer.Checksum = adler32.Checksum(buf.Bytes())
+	err = binary.Write(buf, binary.LittleEndian, d.Footer.Checksum)
+	if err != nil {
+		return err
+	}
+
+	_, err = ewf.Write(buf.Bytes())
+	return err
+}
+
+// verifyChecksums validates the checksums of the header and the entries
+func (d *EWFErrors2Section) verifyChecksums(section *EWFSectionDescriptor, segmentNumber uint16) error {
+	sum, err := shared.Checksum(d.Header)
+	if err != nil {
+		return err
+	}
+	if sum != d.Header.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "errors2 header",
+			Stored:        d.Header.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, d.Entries); err != nil {
+		return err
+	}
+	sum = adler32.Checksum(buf.Bytes())
+	if sum != d.Footer.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "errors2 entries",
+			Stored:        d.Footer.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	return nil
+}
+
+// Ranges returns the unreadable sector ranges, an error when the section is damaged
+func (d *EWFErrors2Section) Ranges() ([]shared.SectorRange, error) {
+	if d.damaged != nil {
+		return nil, d.damaged
+	}
+
+	ranges := make([]shared.SectorRange, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		ranges = append(ranges, shared.SectorRange{First: uint64(e.FirstSector), Count: uint64(e.SectorCount)})
+	}
+	return ranges, nil
+}
@@ -2,10 +2,13 @@ package evf1
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sort"
+	"sync"
 
 	"github.com/asalih/go-ewf/shared"
 )
@@ -46,21 +49,79 @@ type EWFReader struct {
 
 	segments *list.List
 	position int64
+
+	// unreadable are the sector ranges reads fail on, set by OpenOptions.UnreadableSectorErrors
+	unreadable []shared.SectorRange
+	// chunks caches decompressed chunks, set by OpenOptions.ChunkCacheSize
+	chunks *shared.ChunkCache
+	// mu serializes the lazy decoding of segments, ReadAt is safe for concurrent use
+	mu sync.Mutex
+	// files are the segment files opened by OpenEWFFile, closed by Close
+	files []*os.File
+	// recovery is what could be read of an image opened with OpenOptions.Recover
+	recovery *shared.Recovery
 }
 
+// OpenEWF opens the segment files of an image, checksums are not validated
 func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
+	return OpenEWFWithOptions(shared.OpenOptions{}, fhs...)
+}
+
+// OpenEWFFile opens the image whose first segment file is at path together with the segment
+// files that follow it, e.g. image.E02 and image.E03 for image.E01. Close closes the files.
+func OpenEWFFile(path string, opts shared.OpenOptions) (*EWFReader, error) {
+	files, err := shared.OpenSegmentFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fhs := make([]io.ReadSeeker, len(files))
+	for i, f := range files {
+		fhs[i] = f
+	}
+	ewf, err := OpenEWFWithOptions(opts, fhs...)
+	if err != nil {
+		_ = shared.CloseFiles(files)
+		return nil, err
+	}
+	ewf.files = files
+	return ewf, nil
+}
+
+// OpenEWFReaderAt opens the segment files of an image that are read with positional reads only,
+// so the segments do not need a file position shared by all reads
+func OpenEWFReaderAt(opts shared.OpenOptions, segments ...shared.SegmentReaderAt) (*EWFReader, error) {
+	fhs := make([]io.ReadSeeker, len(segments))
+	for i, segment := range segments {
+		fhs[i] = io.NewSectionReader(segment.ReaderAt, 0, segment.Size)
+	}
+	return OpenEWFWithOptions(opts, fhs...)
+}
+
+// OpenEWFWithOptions opens the segment files of an image. In strict mode all segments are decoded
+// and their section descriptor and table checksums are validated before returning.
+func OpenEWFWithOptions(opts shared.OpenOptions, fhs ...io.ReadSeeker) (*EWFReader, error) {
 	ewf := &EWFReader{
 		ChunkSize: 0,
 		EWFSize:   0,
 		segments:  list.New(),
 	}
 
+	ewf.chunks = shared.NewChunkCache(opts.ChunkCacheSize)
+
 	allSegments := make([]*EWFSegment, 0)
 	for _, file := range fhs {
 		segment, err := NewEWFSegment(file)
+		if opts.Recover && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			// a segment file created right before the acquisition stopped holds no data
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		segment.strict = opts.Strict
+		segment.recover = opts.Recover
+		segment.chunks = ewf.chunks
 
 		allSegments = append(allSegments, segment)
 	}
@@ -72,6 +133,9 @@ func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
 	if len(allSegments) == 0 {
 		return nil, fmt.Errorf("failed to load EWF")
 	}
+	if err := validateSegments(allSegments); err != nil {
+		return nil, err
+	}
 
 	ewf.First = allSegments[0]
 	err := ewf.First.Decode(nil)
@@ -87,12 +151,134 @@ func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
 		return nil, fmt.Errorf("failed to load EWF")
 	}
 
+	if opts.Strict || opts.Recover {
+		for i := 1; i < ewf.segments.Len(); i++ {
+			if _, _, err := ewf.Segment(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	ewf.ChunkSize = ewf.First.Volume.Data.GetSectorCount() * ewf.First.Volume.Data.GetSectorSize()
+	// media size may not be a multiple of the chunk size, the last chunk is short then
 	ewf.EWFSize = int64(ewf.First.Volume.Data.GetChunkCount()) * int64(ewf.ChunkSize)
+	if ts := ewf.First.Volume.Data.GetTotalSectorCount(); ts > 0 {
+		ss := int64(ewf.First.Volume.Data.GetSectorSize())
+		ewf.EWFSize = int64(ts) * ss
+		// the last sector of media that is not a whole number of sectors is filled up with zeros
+		if vol, ok := ewf.First.Volume.Data.(*EWFVolumeSectionData); ok {
+			if ms := int64(vol.MediaSize); ms > ewf.EWFSize-ss && ms < ewf.EWFSize {
+				ewf.EWFSize = ms
+			}
+		}
+	}
+
+	if opts.Recover {
+		ewf.recovery, err = ewf.recover()
+		if err != nil {
+			return nil, err
+		}
+		ewf.EWFSize = ewf.recovery.Size
+	}
+
+	if opts.UnreadableSectorErrors {
+		ewf.unreadable, err = ewf.Errors()
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(ewf.unreadable, func(i, j int) bool {
+			return ewf.unreadable[i].First < ewf.unreadable[j].First
+		})
+	}
 
 	return ewf, nil
 }
 
+// validateSegments checks that the segments are one complete set of the same acquisition, the
+// error is a *shared.SegmentSetError
+func validateSegments(segments []*EWFSegment) error {
+	numbers := make([]uint16, len(segments))
+	ids := make([][]byte, len(segments))
+	for i, seg := range segments {
+		guid, err := seg.setIdentifier()
+		// the sections of a truncated segment may end before its GUID
+		if err != nil && !seg.recover {
+			return fmt.Errorf("segment %d: %w", seg.EWFHeader.SegmentNumber, err)
+		}
+		numbers[i] = seg.EWFHeader.SegmentNumber
+		ids[i] = guid[:]
+	}
+
+	// the segments are sorted, the acquisition continues after the last one when it ends with a
+	// next section. Recovery expects the segment an interrupted acquisition did not write and a
+	// truncated segment is reported when it is decoded.
+	last := segments[len(segments)-1]
+	continued := false
+	if !last.recover {
+		continued, _ = last.endsWithNext()
+	}
+	return shared.ValidateSegmentSet(numbers, ids, continued)
+}
+
+// recover returns how much of the media can be read from the decoded segments. The volume of an
+// interrupted acquisition does not record the media size yet.
+func (ewf *EWFReader) recover() (*shared.Recovery, error) {
+	recovery := &shared.Recovery{RecordedSize: ewf.EWFSize}
+
+	var chunkCount int64
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		chunkCount += seg.chunkCount
+		if seg.recovered {
+			recovery.Segments = append(recovery.Segments, seg.EWFHeader.SegmentNumber)
+		}
+	}
+	if chunkCount == 0 {
+		return recovery, nil
+	}
+
+	end, err := ewf.lastChunkEnd()
+	if err != nil {
+		return nil, err
+	}
+	recovery.Size = end
+	if recovery.RecordedSize > 0 && recovery.RecordedSize < end {
+		recovery.Size = recovery.RecordedSize
+	}
+
+	return recovery, nil
+}
+
+// lastChunkEnd returns the media offset where the data of the last chunk ends
+func (ewf *EWFReader) lastChunkEnd() (int64, error) {
+	var chunkCount int64
+	var last *EWFSegment
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return 0, err
+		}
+		chunkCount += seg.chunkCount
+		if len(seg.Tables) > 0 {
+			last = seg
+		}
+	}
+	if last == nil || chunkCount == 0 {
+		return 0, errors.New("image has no chunks")
+	}
+
+	tbl := last.Tables[len(last.Tables)-1]
+	buf, err := tbl.readChunk(int64(tbl.Header.NumEntries) - 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return (chunkCount-1)*int64(ewf.ChunkSize) + int64(len(buf)), nil
+}
+
 func (ewf *EWFReader) Metadata() map[string]interface{} {
 	md := make(map[string]interface{})
 	for k, v := range ewf.First.Header.MediaInfo {
@@ -116,10 +302,48 @@ func (ewf *EWFReader) Size() int64 {
 }
 
 func (ewf *EWFReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if len(ewf.unreadable) == 0 || off < 0 {
+		return ewf.readAt(p, off)
+	}
+
+	// reads stop at the first unreadable sector
+	sectorSize := int64(ewf.First.Volume.Data.GetSectorSize())
+	r, start, ok := shared.FindUnreadable(ewf.unreadable, sectorSize, off, int64(len(p)))
+	if !ok {
+		return ewf.readAt(p, off)
+	}
+	if start > off {
+		n, err = ewf.readAt(p[:start-off], off)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, &shared.UnreadableSectorError{Range: r}
+}
+
+// readAt reads the media, unreadable sectors read as the zeros stored for them
+func (ewf *EWFReader) readAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= ewf.EWFSize {
+		return 0, io.EOF
+	}
+
+	// reads stop at the end of the media
+	var eof error
+	if int64(len(p)) > ewf.EWFSize-off {
+		p = p[:ewf.EWFSize-off]
+		eof = io.EOF
+	}
+
 	sectorSize := int(ewf.First.Volume.Data.GetSectorSize())
 	sectorOffset := off / int64(sectorSize)
 	length := len(p)
-	sectorCount := (length + sectorSize - 1) / sectorSize
+
+	// Calculate how many sectors we need, accounting for starting mid-sector
+	startSectorOffset := off % int64(sectorSize)
+	sectorCount := int((startSectorOffset + int64(length) + int64(sectorSize) - 1) / int64(sectorSize))
 
 	buf, readErr := ewf.readSectors(sectorOffset, int64(sectorCount))
 	if readErr != nil && readErr != io.EOF {
@@ -151,7 +375,113 @@ func (ewf *EWFReader) ReadAt(p []byte, off int64) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	return n, nil
+	return n, eof
+}
+
+// VerifyHashes reads the Size() bytes of source data and compares their MD5 and SHA1 to the
+// hashes stored in the digest and hash sections. The zeros that fill up the last sector of a
+// source that is not a multiple of the sector size are not hashed. progress may be nil.
+func (ewf *EWFReader) VerifyHashes(ctx context.Context, progress shared.ProgressFunc) (*shared.HashVerification, error) {
+	var storedMD5, storedSHA1 []byte
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		// digest section carries both hashes, hash section only MD5
+		if seg.Digest != nil {
+			storedMD5 = seg.Digest.MD5[:]
+			storedSHA1 = seg.Digest.SHA1[:]
+		} else if seg.Hash != nil && storedMD5 == nil {
+			storedMD5 = seg.Hash.MD5[:]
+		}
+	}
+
+	// hashes cover the zero filled unreadable sectors
+	return shared.VerifyHashes(ctx, shared.ReaderAtFunc(ewf.readAt), ewf.EWFSize, storedMD5, storedSHA1, progress)
+}
+
+// Errors decodes all segments and returns the sector ranges that could not be read during
+// acquisition. The sectors are stored zero filled and are not media content. A damaged errors2
+// section is reported as a *shared.ChecksumError.
+func (ewf *EWFReader) Errors() ([]shared.SectorRange, error) {
+	var ranges []shared.SectorRange
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.Errors2 != nil {
+			segRanges, err := seg.Errors2.Ranges()
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, segRanges...)
+		}
+	}
+
+	return ranges, nil
+}
+
+// Sessions decodes all segments and returns the sessions and tracks of optical media, nil when
+// the image has no session section. A damaged session section is reported as a
+// *shared.ChecksumError.
+func (ewf *EWFReader) Sessions() ([]shared.Session, error) {
+	sectorSize := int64(ewf.First.Volume.Data.GetSectorSize())
+	totalSectors := uint64((ewf.EWFSize + sectorSize - 1) / sectorSize)
+
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.Session != nil {
+			return seg.Session.Sessions(totalSectors)
+		}
+	}
+
+	return nil, nil
+}
+
+// Close closes the segment files opened by OpenEWFFile. Segments passed to the other open
+// functions are left to the caller.
+func (ewf *EWFReader) Close() error {
+	files := ewf.files
+	ewf.files = nil
+	return shared.CloseFiles(files)
+}
+
+// SegmentCount returns the number of segment files of the image
+func (ewf *EWFReader) SegmentCount() int {
+	return ewf.segments.Len()
+}
+
+// ChunkCacheStats returns the hits and misses of the chunk cache, zero when the image was opened
+// without one
+func (ewf *EWFReader) ChunkCacheStats() shared.ChunkCacheStats {
+	return ewf.chunks.Stats()
+}
+
+// Recovery reports how much of the media could be read when the image was opened with
+// OpenOptions.Recover, nil when it was opened without it
+func (ewf *EWFReader) Recovery() *shared.Recovery {
+	return ewf.recovery
+}
+
+// TableFallbacks decodes all segments and returns the damaged tables that were replaced by
+// their table2 mirror and the tables that differ from it. Tables are validated in both modes,
+// strict mode also replaces tables whose section descriptor checksum does not match.
+func (ewf *EWFReader) TableFallbacks() ([]*TableFallback, error) {
+	var fallbacks []*TableFallback
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		fallbacks = append(fallbacks, seg.TableFallbacks...)
+	}
+
+	return fallbacks, nil
 }
 
 // Seek implements vfs.FileDescriptionImpl.Seek.
@@ -178,6 +508,9 @@ func (ewf *EWFReader) Seek(offset int64, whence int) (ret int64, err error) {
 }
 
 func (ewf *EWFReader) Segment(index int) (*EWFSegment, *list.Element, error) {
+	ewf.mu.Lock()
+	defer ewf.mu.Unlock()
+
 	elem, ok := shared.GetListElement(ewf.segments, index)
 	if !ok {
 		return nil, nil, errors.New("not found")
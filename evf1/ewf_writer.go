@@ -1,63 +1,102 @@
 package evf1
 
 import (
+	"compress/zlib"
+	"context"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
+	"hash/adler32"
 	"io"
+	"math"
 	"sync"
 
 	"github.com/asalih/go-ewf/shared"
 )
 
 var _ shared.EWFWriter = &EWFWriter{}
+var _ shared.AcquisitionWriter = &EWFWriter{}
 
-// EWFWriter is helper for creating E01 images. Data is always compressed
+// EWFWriter is helper for creating E01 images. Data is compressed unless the compression level is None
 type EWFWriter struct {
 	mu   sync.Mutex
 	dest io.WriteSeeker
 
-	dataSize   uint64
-	buf        []byte
-	compressor *shared.ZlibCompressor
+	dataSize         uint64
+	mediaSize        uint64
+	buf              []byte
+	bytesPerSector   uint32
+	sectorsPerChunk  uint32
+	compressionLevel CompressionLevel
+	zlibLevel        int
+	mediaType        MediaType
+	encode           shared.ChunkEncoder
+
+	workers     int
+	maxInFlight int64
+	pipeline    *shared.ChunkPipeline
+	// writeErr is the first error storing data, the encoders are stopped once it is set
+	writeErr error
 
 	md5Hasher  hash.Hash
 	sha1Hasher hash.Hash
 
+	// unreadable are the sector ranges written zero filled, listed in the errors2 section
+	unreadable []shared.SectorRange
+	// sessions are the sessions and tracks of optical media, listed in the session section
+	sessions []shared.Session
+
+	// logical is the file entry tree of a logical evidence file, nil for disk images
+	logical *shared.LogicalTree
+
+	maxSegmentSize int64
+	nextSegment    NextSegmentFunc
+	segments       []*segmentFile
+
 	Segment       *EWFSegment
 	SegmentOffset uint32
 	ChunkSize     uint32
 }
 
+// NextSegmentFunc opens the destination of the given segment number when the writer
+// rolls over to a new segment file (E02, E03, ...).
+type NextSegmentFunc func(segmentNumber uint16) (io.WriteSeeker, error)
+
+// segmentFile is a segment file written by the writer. Volume and data sections of the
+// segments are rewritten with the final chunk count when the writer is closed.
+type segmentFile struct {
+	dest           io.WriteSeeker
+	segment        *EWFSegment
+	dataOffset     int64
+	openedByWriter bool
+}
+
 type EWFCreator struct {
 	ewfWriter *EWFWriter
 }
 
 func CreateEWF(dest io.WriteSeeker) (*EWFCreator, error) {
 	ewf := &EWFWriter{
-		dest:          dest,
-		buf:           make([]byte, 0, DefaultChunkSize),
-		SegmentOffset: 0,
-		ChunkSize:     0,
+		dest:             dest,
+		buf:              make([]byte, 0, DefaultChunkSize),
+		bytesPerSector:   DefaultSectorSize,
+		sectorsPerChunk:  DefaultSectorsPerChunk,
+		compressionLevel: Best,
+		mediaType:        Fixed,
+		SegmentOffset:    0,
+		ChunkSize:        DefaultChunkSize,
 	}
 
-	compressor, err := shared.NewZlibCompressor()
-	if err != nil {
-		return nil, err
-	}
-	ewf.compressor = compressor
-
+	var err error
 	ewf.Segment, err = NewEWFSegment(nil)
 	if err != nil {
 		return nil, err
 	}
-	ewf.Segment.EWFHeader = &EWFHeader{
-		FieldsStart:   1,
-		SegmentNumber: 1, // TODO: this number increments for each file chunk like E0n
-		FieldsEnd:     0,
-	}
-	copy(ewf.Segment.EWFHeader.Signature[:], []byte(EVFSignature))
+	ewf.Segment.EWFHeader = newEWFHeader(1)
 
 	ewf.Segment.Header = &EWFHeaderSection{}
 	ewf.Segment.Header.CategoryName = "main"
@@ -65,8 +104,13 @@ func CreateEWF(dest io.WriteSeeker) (*EWFCreator, error) {
 	ewf.Segment.Header.MediaInfo = make(map[string]string)
 
 	ewf.Segment.Sectors = new(EWFSectorsSection)
+	volume := DefaultVolume()
+	// the volume section of the first segment and the data sections of the others share the GUID
+	if _, err := rand.Read(volume.UUID[:]); err != nil {
+		return nil, err
+	}
 	ewf.Segment.Volume = &EWFVolumeSection{
-		Data: DefaultVolume(),
+		Data: volume,
 	}
 
 	ewf.Segment.Tables = []*EWFTableSection{
@@ -76,7 +120,7 @@ func CreateEWF(dest io.WriteSeeker) (*EWFCreator, error) {
 	ewf.Segment.Digest = new(EWFDigestSection)
 	ewf.Segment.Hash = new(EWFHashSection)
 	ewf.Segment.Data = &EWFDataSection{
-		MediaType:      1,
+		MediaType:      uint8(Fixed),
 		MediaFlags:     1,
 		SectorPerChunk: ewf.Segment.Volume.Data.GetSectorCount(),
 		BytesPerSector: ewf.Segment.Volume.Data.GetSectorSize(),
@@ -90,12 +134,222 @@ func CreateEWF(dest io.WriteSeeker) (*EWFCreator, error) {
 	return &EWFCreator{ewf}, nil
 }
 
+// applySectorGeometry records the sector size and sectors per chunk in the volume and data sections.
+func (ewf *EWFWriter) applySectorGeometry() error {
+	if ewf.bytesPerSector == 0 || ewf.sectorsPerChunk == 0 {
+		return fmt.Errorf("invalid sector geometry: %d bytes per sector, %d sectors per chunk", ewf.bytesPerSector, ewf.sectorsPerChunk)
+	}
+
+	chunkSize := uint64(ewf.bytesPerSector) * uint64(ewf.sectorsPerChunk)
+	if chunkSize > math.MaxInt32 {
+		return fmt.Errorf("chunk size %d is too big", chunkSize)
+	}
+
+	if vol, ok := ewf.Segment.Volume.Data.(*EWFVolumeSectionData); ok {
+		vol.SectorSize = ewf.bytesPerSector
+		vol.SectorCount = ewf.sectorsPerChunk
+	}
+	ewf.Segment.Data.BytesPerSector = ewf.bytesPerSector
+	ewf.Segment.Data.SectorPerChunk = ewf.sectorsPerChunk
+
+	ewf.ChunkSize = uint32(chunkSize)
+	ewf.buf = make([]byte, 0, chunkSize)
+
+	return nil
+}
+
+// applyCompressionLevel records the compression level in the volume, data and header sections.
+func (ewf *EWFWriter) applyCompressionLevel() error {
+	var headerValue string
+	switch ewf.compressionLevel {
+	case None:
+		headerValue = EWF_HEADER_VALUES_INDEX_COMPRESSION_NO
+	case Good:
+		ewf.zlibLevel = zlib.BestSpeed
+		headerValue = EWF_HEADER_VALUES_INDEX_COMPRESSION_FASTEST
+	case Best:
+		ewf.zlibLevel = zlib.BestCompression
+		headerValue = EWF_HEADER_VALUES_INDEX_COMPRESSION_BEST
+	default:
+		return fmt.Errorf("unsupported compression level: %v", ewf.compressionLevel)
+	}
+
+	if vol, ok := ewf.Segment.Volume.Data.(*EWFVolumeSectionData); ok {
+		vol.CompressionLevel = ewf.compressionLevel
+	}
+	ewf.Segment.Data.CompressionLevel = uint8(ewf.compressionLevel)
+	ewf.Segment.Header.MediaInfo[string(EWF_HEADER_VALUES_INDEX_COMPRESSION_TYPE)] = headerValue
+
+	return nil
+}
+
+// applyMediaType records the media type in the volume and data sections. Sessions can only be
+// recorded for optical media.
+func (ewf *EWFWriter) applyMediaType() error {
+	if len(ewf.sessions) > 0 {
+		if ewf.mediaType != Optical {
+			return fmt.Errorf("sessions can only be recorded for optical media, media type is 0x%02x", uint8(ewf.mediaType))
+		}
+		if err := shared.ValidateSessions(ewf.sessions); err != nil {
+			return err
+		}
+		if last := ewf.sessions[len(ewf.sessions)-1]; last.Range.First > math.MaxUint32 {
+			return fmt.Errorf("session at sector %d is beyond the sectors the session section can list", last.Range.First)
+		}
+	}
+
+	if vol, ok := ewf.Segment.Volume.Data.(*EWFVolumeSectionData); ok {
+		vol.MediaType = ewf.mediaType
+	}
+	ewf.Segment.Data.MediaType = uint8(ewf.mediaType)
+
+	return nil
+}
+
+// newEncoder returns a chunk encoder with its own compressor
+func (ewf *EWFWriter) newEncoder() (shared.ChunkEncoder, error) {
+	if ewf.compressionLevel == None {
+		return func(p []byte) ([]byte, bool, error) {
+			// uncompressed chunks are followed by their checksum
+			bufc := make([]byte, len(p)+ChecksumSize)
+			copy(bufc, p)
+			binary.LittleEndian.PutUint32(bufc[len(p):], adler32.Checksum(p))
+			return bufc, false, nil
+		}, nil
+	}
+
+	compressor, err := shared.NewZlibCompressorLevel(ewf.zlibLevel)
+	if err != nil {
+		return nil, err
+	}
+	return func(p []byte) ([]byte, bool, error) {
+		bufc, err := compressor.Compress(p)
+		if err != nil {
+			return nil, false, err
+		}
+		// compressor reuses its buffer
+		return append([]byte(nil), bufc...), true, nil
+	}, nil
+}
+
+// checkMaxInFlight validates a limit of the chunk data in flight against the chunk size
+func (ewf *EWFWriter) checkMaxInFlight(maxInFlight int64) error {
+	chunkSize := int64(ewf.bytesPerSector) * int64(ewf.sectorsPerChunk)
+	if maxInFlight < 0 || (maxInFlight > 0 && maxInFlight < chunkSize) {
+		return fmt.Errorf("%d bytes in flight do not hold a chunk of %d bytes", maxInFlight, chunkSize)
+	}
+	return nil
+}
+
+// startEncoders creates the inline encoder or the compression workers
+func (ewf *EWFWriter) startEncoders() error {
+	if ewf.workers <= 1 {
+		encode, err := ewf.newEncoder()
+		if err != nil {
+			return err
+		}
+		ewf.encode = encode
+		return nil
+	}
+
+	// the sector geometry may have been changed after the limit was set
+	if err := ewf.checkMaxInFlight(ewf.maxInFlight); err != nil {
+		return err
+	}
+	maxPending := ewf.workers * 2
+	if ewf.maxInFlight > 0 {
+		maxPending = int(ewf.maxInFlight / int64(ewf.ChunkSize))
+	}
+
+	pipeline, err := shared.NewChunkPipeline(ewf.workers, maxPending, ewf.newEncoder)
+	if err != nil {
+		return err
+	}
+	ewf.pipeline = pipeline
+	return nil
+}
+
+func newEWFHeader(segmentNumber uint16) *EWFHeader {
+	h := &EWFHeader{
+		FieldsStart:   1,
+		SegmentNumber: segmentNumber,
+		FieldsEnd:     0,
+	}
+	copy(h.Signature[:], []byte(EVFSignature))
+	return h
+}
+
 func (creator *EWFCreator) AddMediaInfo(key EWFMediaInfo, value string) {
 	creator.ewfWriter.Segment.Header.MediaInfo[string(key)] = value
 }
 
+// SetCompressionLevel sets how chunks are compressed. With None chunks are stored
+// uncompressed followed by their Adler-32 checksum. Default is Best.
+func (creator *EWFCreator) SetCompressionLevel(level CompressionLevel) {
+	creator.ewfWriter.compressionLevel = level
+}
+
+// SetCompressionWorkers compresses chunks on the given number of goroutines. maxInFlight bounds
+// the bytes of chunk data held in memory while waiting to be compressed or written, 0 keeps two
+// chunks per worker. Chunks are still written in order. A single worker compresses inline.
+// maxInFlight has to hold at least one chunk of the sector geometry set before.
+func (creator *EWFCreator) SetCompressionWorkers(workers int, maxInFlight int64) error {
+	if err := creator.ewfWriter.checkMaxInFlight(maxInFlight); err != nil {
+		return err
+	}
+	creator.ewfWriter.workers = workers
+	creator.ewfWriter.maxInFlight = maxInFlight
+	return nil
+}
+
+// SetSectorGeometry sets the bytes per sector and the number of sectors stored in a chunk.
+// Default is 512 bytes per sector and 64 sectors per chunk.
+func (creator *EWFCreator) SetSectorGeometry(bytesPerSector, sectorsPerChunk uint32) {
+	creator.ewfWriter.bytesPerSector = bytesPerSector
+	creator.ewfWriter.sectorsPerChunk = sectorsPerChunk
+}
+
+// SetMediaType sets the type of the acquired media. Default is Fixed.
+func (creator *EWFCreator) SetMediaType(mediaType MediaType) {
+	creator.ewfWriter.mediaType = mediaType
+}
+
+// SetSessions records the sessions and tracks of optical media in the session section. Only the
+// first sector and the flags of a session are stored, it runs up to the next session. The media
+// type must be Optical.
+func (creator *EWFCreator) SetSessions(sessions []shared.Session) {
+	creator.ewfWriter.sessions = append([]shared.Session(nil), sessions...)
+}
+
+// SetSegmentSize splits the image into segment files of at most maxSize bytes.
+// next is called to open the destination of each segment after the first one.
+// Destinations returned by next are closed by the writer if they implement io.Closer.
+func (creator *EWFCreator) SetSegmentSize(maxSize int64, next NextSegmentFunc) {
+	creator.ewfWriter.maxSegmentSize = maxSize
+	creator.ewfWriter.nextSegment = next
+}
+
 func (creator *EWFCreator) Start() (*EWFWriter, error) {
-	err := creator.ewfWriter.Segment.EWFHeader.Encode(creator.ewfWriter.dest)
+	if creator.ewfWriter.maxSegmentSize > 0 && creator.ewfWriter.nextSegment == nil {
+		return nil, errors.New("segment size is set without a next segment function")
+	}
+
+	err := creator.ewfWriter.applySectorGeometry()
+	if err != nil {
+		return nil, err
+	}
+
+	err = creator.ewfWriter.applyCompressionLevel()
+	if err != nil {
+		return nil, err
+	}
+
+	err = creator.ewfWriter.applyMediaType()
+	if err != nil {
+		return nil, err
+	}
+
+	err = creator.ewfWriter.Segment.EWFHeader.Encode(creator.ewfWriter.dest)
 	if err != nil {
 		return nil, err
 	}
@@ -117,6 +371,17 @@ func (creator *EWFCreator) Start() (*EWFWriter, error) {
 		return nil, err
 	}
 
+	// the compression workers start last, nothing stops them when Start fails
+	err = creator.ewfWriter.startEncoders()
+	if err != nil {
+		return nil, err
+	}
+
+	creator.ewfWriter.segments = append(creator.ewfWriter.segments, &segmentFile{
+		dest:    creator.ewfWriter.dest,
+		segment: creator.ewfWriter.Segment,
+	})
+
 	return creator.ewfWriter, nil
 }
 
@@ -124,60 +389,259 @@ func (ewf *EWFWriter) Write(p []byte) (n int, err error) {
 	ewf.mu.Lock()
 	defer ewf.mu.Unlock()
 
+	return ewf.write(p)
+}
+
+// write adds p to the media, the caller holds ewf.mu
+func (ewf *EWFWriter) write(p []byte) (n int, err error) {
+	if ewf.writeErr != nil {
+		return 0, ewf.writeErr
+	}
+
+	// unreadable data that does not fill its last sector ends the media
+	if l := len(ewf.unreadable); l > 0 {
+		last := ewf.unreadable[l-1]
+		if (last.First+last.Count)*uint64(ewf.bytesPerSector) > ewf.mediaSize {
+			return 0, fmt.Errorf("write after unreadable data that ends within sector %d", last.First+last.Count-1)
+		}
+	}
+
+	_, err = ewf.md5Hasher.Write(p)
+	if err != nil {
+		return
+	}
+
+	_, err = ewf.sha1Hasher.Write(p)
+	if err != nil {
+		return
+	}
+
 	ewf.buf = append(ewf.buf, p...)
+	ewf.mediaSize += uint64(len(p))
 	n = len(p)
 
-	if len(ewf.buf) < DefaultChunkSize {
+	chunkSize := int(ewf.ChunkSize)
+	if len(ewf.buf) < chunkSize {
 		return
 	}
 
-	for len(ewf.buf) >= DefaultChunkSize {
-		err = ewf.writeData(ewf.buf[:DefaultChunkSize])
+	for len(ewf.buf) >= chunkSize {
+		err = ewf.writeData(ewf.buf[:chunkSize])
 		if err != nil {
 			return
 		}
 
-		ewf.buf = ewf.buf[DefaultChunkSize:]
+		ewf.buf = ewf.buf[chunkSize:]
 	}
 
 	return
 }
 
+// WriteUnreadable writes n zero bytes in place of source data that could not be read. The sectors
+// they cover are listed in the errors2 section, the zeros are hashed like the rest of the media.
+// The data written so far must end at a sector boundary, n may end within a sector only for the
+// last sector of the media.
+func (ewf *EWFWriter) WriteUnreadable(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+
+	ewf.mu.Lock()
+	defer ewf.mu.Unlock()
+
+	bps := uint64(ewf.bytesPerSector)
+	if ewf.mediaSize%bps != 0 {
+		return fmt.Errorf("unreadable data must start at a sector boundary, %d bytes written", ewf.mediaSize)
+	}
+	first := ewf.mediaSize / bps
+	count := (uint64(n) + bps - 1) / bps
+	if first+count > math.MaxUint32 {
+		return fmt.Errorf("unreadable sectors %d-%d are beyond the sectors errors2 can list", first, first+count-1)
+	}
+
+	if err := ewf.writeZeros(n); err != nil {
+		return err
+	}
+	ewf.addUnreadable(first, count)
+
+	return nil
+}
+
+// writeZeros writes n zero bytes of media, the caller holds ewf.mu
+func (ewf *EWFWriter) writeZeros(n int64) error {
+	zeros := make([]byte, shared.MinInt64(n, int64(ewf.ChunkSize)))
+	for n > 0 {
+		p := zeros
+		if n < int64(len(p)) {
+			p = p[:n]
+		}
+		if _, err := ewf.write(p); err != nil {
+			return err
+		}
+		n -= int64(len(p))
+	}
+
+	return nil
+}
+
+// addUnreadable records a range of unreadable sectors, joining it to the previous range when adjacent
+func (ewf *EWFWriter) addUnreadable(first, count uint64) {
+	if l := len(ewf.unreadable); l > 0 {
+		last := &ewf.unreadable[l-1]
+		if last.First+last.Count == first {
+			last.Count += count
+			return
+		}
+	}
+	ewf.unreadable = append(ewf.unreadable, shared.SectorRange{First: first, Count: count})
+}
+
+// Errors returns the sector ranges written as unreadable so far
+func (ewf *EWFWriter) Errors() []shared.SectorRange {
+	ewf.mu.Lock()
+	defer ewf.mu.Unlock()
+	return append([]shared.SectorRange(nil), ewf.unreadable...)
+}
+
+// Acquire copies size bytes of src into the image. Sectors that can not be read from src are
+// written zero filled and listed in the errors2 section instead of failing the image.
+// progress may be nil.
+func (ewf *EWFWriter) Acquire(ctx context.Context, src io.ReaderAt, size int64, progress shared.ProgressFunc) error {
+	return shared.Acquire(ctx, ewf, src, size, shared.AcquireOptions{
+		SectorSize: int(ewf.bytesPerSector),
+		BlockSize:  int(ewf.ChunkSize),
+		Progress:   progress,
+	})
+}
+
+// sessionSection returns the session section listing the sessions, nil when there are none
+func (ewf *EWFWriter) sessionSection() (*EWFSessionSection, error) {
+	if len(ewf.sessions) == 0 {
+		return nil, nil
+	}
+
+	if last := ewf.sessions[len(ewf.sessions)-1]; last.Range.First >= ewf.sectorCount() {
+		return nil, fmt.Errorf("session at sector %d starts beyond the %d sectors of the media", last.Range.First, ewf.sectorCount())
+	}
+
+	sessionSec := &EWFSessionSection{
+		Entries: make([]EWFSessionSectionEntry, 0, len(ewf.sessions)),
+	}
+	for _, s := range ewf.sessions {
+		sessionSec.Entries = append(sessionSec.Entries, EWFSessionSectionEntry{
+			Flags:       s.Flags,
+			FirstSector: uint32(s.Range.First),
+		})
+	}
+	return sessionSec, nil
+}
+
+// sessionSize is the number of bytes the session section takes at the end of the last segment
+func (ewf *EWFWriter) sessionSize() int64 {
+	if len(ewf.sessions) == 0 {
+		return 0
+	}
+	return int64(DescriptorSize) +
+		int64(binary.Size(EWFSessionSectionHeader{})) +
+		int64(len(ewf.sessions))*int64(binary.Size(EWFSessionSectionEntry{})) +
+		ChecksumSize
+}
+
+// errors2Section returns the errors2 section listing the unreadable sectors, nil when there are none
+func (ewf *EWFWriter) errors2Section() *EWFErrors2Section {
+	if len(ewf.unreadable) == 0 {
+		return nil
+	}
+
+	errSec := &EWFErrors2Section{
+		Entries: make([]EWFErrors2SectionEntry, 0, len(ewf.unreadable)),
+	}
+	for _, r := range ewf.unreadable {
+		errSec.Entries = append(errSec.Entries, EWFErrors2SectionEntry{
+			FirstSector: uint32(r.First),
+			SectorCount: uint32(r.Count),
+		})
+	}
+	return errSec
+}
+
+// errors2Size is the number of bytes the errors2 section takes at the end of the last segment
+func (ewf *EWFWriter) errors2Size() int64 {
+	if len(ewf.unreadable) == 0 {
+		return 0
+	}
+	return int64(DescriptorSize) +
+		int64(binary.Size(EWFErrors2SectionHeader{})) +
+		int64(len(ewf.unreadable))*int64(binary.Size(EWFErrors2SectionEntry{})) +
+		ChecksumSize
+}
+
+// Close stores the data left in the write buffer and completes the image with its hashes. The
+// compression workers run until Close or the first failed write, a writer that is given up before
+// has to be closed all the same.
 func (ewf *EWFWriter) Close() error {
+	ewf.mu.Lock()
+	if ewf.writeErr != nil {
+		ewf.mu.Unlock()
+		return ewf.writeErr
+	}
 	if len(ewf.buf) > 0 {
-		ewf.mu.Lock()
-		ewf.buf = shared.PadBytes(ewf.buf, DefaultChunkSize)
+		// the last chunk is stored short, filled up to a whole sector. The zeros are not hashed,
+		// the hashes cover the source data only.
+		if partial := len(ewf.buf) % int(ewf.bytesPerSector); partial > 0 {
+			ewf.buf = append(ewf.buf, make([]byte, int(ewf.bytesPerSector)-partial)...)
+		}
 		err := ewf.writeData(ewf.buf)
 		if err != nil {
 			ewf.mu.Unlock()
 			return err
 		}
 		ewf.buf = ewf.buf[:0]
-		ewf.mu.Unlock()
 	}
+	ewf.mu.Unlock()
 
-	tablePosition, err := ewf.Seek(0, io.SeekCurrent)
+	err := ewf.flushPipeline()
 	if err != nil {
 		return err
 	}
 
-	err = ewf.Segment.Sectors.Encode(ewf.dest, uint64(ewf.dataSize), uint64(tablePosition))
+	ewf.Segment.Volume.Data.SetTotalSectorCount(ewf.sectorCount())
+	if vol, ok := ewf.Segment.Volume.Data.(*EWFVolumeSectionData); ok && ewf.mediaSize%uint64(ewf.bytesPerSector) > 0 {
+		vol.MediaSize = ewf.mediaSize
+	}
+
+	sessionSec, err := ewf.sessionSection()
 	if err != nil {
 		return err
 	}
 
-	// volume will be saved in its poisition
-	err = ewf.Segment.Volume.Encode(ewf.dest)
+	err = ewf.writeTables()
 	if err != nil {
 		return err
 	}
 
-	for _, tbl := range ewf.Segment.Tables {
-		//table2 is basically a mirror of the table so the table encodes itself twice.
-		err = tbl.Encode(ewf.dest)
+	if sessionSec != nil {
+		err = sessionSec.Encode(ewf.dest)
 		if err != nil {
 			return err
 		}
+		ewf.Segment.Session = sessionSec
+	}
+
+	if errSec := ewf.errors2Section(); errSec != nil {
+		err = errSec.Encode(ewf.dest)
+		if err != nil {
+			return err
+		}
+		ewf.Segment.Errors2 = errSec
+	}
+
+	if ltree := ewf.ltreeSection(); ltree != nil {
+		err = ltree.Encode(ewf.dest)
+		if err != nil {
+			return err
+		}
+		ewf.Segment.Ltree = ltree
 	}
 
 	copy(ewf.Segment.Digest.MD5[:], ewf.md5Hasher.Sum(nil))
@@ -193,16 +657,188 @@ func (ewf *EWFWriter) Close() error {
 		return err
 	}
 
-	ewf.Segment.Data.ChunkCount = ewf.Segment.Volume.Data.GetChunkCount()
-	ewf.Segment.Data.Sectors = uint64(ewf.Segment.Volume.Data.GetSectorCount() * ewf.Segment.Volume.Data.GetChunkCount())
-	err = ewf.Segment.Data.Encode(ewf.dest)
+	// segments after the first one already carry a data section at their start
+	if len(ewf.segments) == 1 {
+		ewf.Segment.Data.fromVolume(ewf.Segment.Volume.Data)
+		err = ewf.Segment.Data.Encode(ewf.dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ewf.Segment.Done.Encode(ewf.dest)
 	if err != nil {
 		return err
 	}
 
-	err = ewf.Segment.Done.Encode(ewf.dest)
+	return ewf.finalizeSegments()
+}
 
-	return err
+// sectorCount returns the number of sectors of the data written so far, a partial sector counts as a whole one
+func (ewf *EWFWriter) sectorCount() uint64 {
+	return (ewf.mediaSize + uint64(ewf.bytesPerSector) - 1) / uint64(ewf.bytesPerSector)
+}
+
+// writeTables completes the sectors section of the current segment and writes its tables.
+func (ewf *EWFWriter) writeTables() error {
+	tablePosition, err := ewf.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	err = ewf.Segment.Sectors.Encode(ewf.dest, uint64(ewf.dataSize), uint64(tablePosition))
+	if err != nil {
+		return err
+	}
+
+	for _, tbl := range ewf.Segment.Tables {
+		//table2 is basically a mirror of the table so the table encodes itself twice.
+		err = tbl.Encode(ewf.dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// finalizeSegments rewrites the volume of the first segment and the data sections of the
+// following segments with the final chunk count, then closes the segments opened by the writer.
+func (ewf *EWFWriter) finalizeSegments() error {
+	for _, sf := range ewf.segments {
+		var err error
+		if sf.dataOffset > 0 {
+			sf.segment.Data.fromVolume(sf.segment.Volume.Data)
+			err = sf.segment.Data.rewrite(sf.dest, sf.dataOffset)
+		} else {
+			// volume will be saved in its poisition
+			err = sf.segment.Volume.Encode(sf.dest)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sf := range ewf.segments {
+		if !sf.openedByWriter {
+			continue
+		}
+		if closer, ok := sf.dest.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// rollover closes the current segment with a next section and continues with a new segment file.
+// As in EnCase images the header and volume sections are kept in the first segment, the following
+// segments start with a data section that repeats the volume values for the readers of the format.
+func (ewf *EWFWriter) rollover() error {
+	err := ewf.writeTables()
+	if err != nil {
+		return err
+	}
+
+	err = new(EWFNextSection).Encode(ewf.dest)
+	if err != nil {
+		return err
+	}
+
+	segmentNumber := ewf.Segment.EWFHeader.SegmentNumber + 1
+	dest, err := ewf.nextSegment(segmentNumber)
+	if err != nil {
+		return fmt.Errorf("failed to open segment %d: %w", segmentNumber, err)
+	}
+
+	prev := ewf.Segment
+	seg, err := NewEWFSegment(nil)
+	if err != nil {
+		return err
+	}
+	seg.EWFHeader = newEWFHeader(segmentNumber)
+	seg.EWFHeader.Signature = prev.EWFHeader.Signature
+	seg.Header = prev.Header
+	seg.Volume = prev.Volume
+	seg.Sectors = new(EWFSectorsSection)
+	seg.Tables = []*EWFTableSection{
+		newTable(),
+	}
+	seg.Digest = prev.Digest
+	seg.Hash = prev.Hash
+	data := *prev.Data
+	seg.Data = &data
+	seg.Done = prev.Done
+
+	ewf.dest = dest
+	ewf.Segment = seg
+	ewf.dataSize = 0
+
+	err = seg.EWFHeader.Encode(dest)
+	if err != nil {
+		return err
+	}
+
+	// the data section takes the place of the volume and is rewritten on close
+	seg.Data.fromVolume(seg.Volume.Data)
+	err = seg.Data.Encode(dest)
+	if err != nil {
+		return err
+	}
+	dataOffset, err := dest.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	dataOffset -= int64(binary.Size(seg.Data))
+
+	err = seg.Sectors.Encode(dest, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	ewf.segments = append(ewf.segments, &segmentFile{
+		dest:           dest,
+		segment:        seg,
+		dataOffset:     dataOffset,
+		openedByWriter: true,
+	})
+
+	return nil
+}
+
+// segmentTrailerSize is the number of bytes needed to close a segment holding the given
+// number of chunks: its tables and the largest set of sections that may follow them.
+func segmentTrailerSize(entries uint32) int64 {
+	tableCount := int64(entries/maxTableLength) + 2
+	tableHeader := int64(binary.Size(EWFTableSectionHeader{}))
+	tables := 2*tableCount*(int64(DescriptorSize)+tableHeader+ChecksumSize) + 2*int64(entries)*Uint32Size
+
+	last := 4*int64(DescriptorSize) +
+		int64(binary.Size(EWFDigestSection{})) +
+		int64(binary.Size(EWFHashSection{})) +
+		int64(binary.Size(EWFDataSection{}))
+
+	return tables + last
+}
+
+// needsRollover reports whether a chunk of chunkSize bytes at position would exceed the segment size.
+func (ewf *EWFWriter) needsRollover(position int64, chunkSize int) bool {
+	if ewf.maxSegmentSize <= 0 {
+		return false
+	}
+
+	var entries uint32
+	for _, t := range ewf.Segment.Tables {
+		entries += t.Header.NumEntries
+	}
+	if entries == 0 {
+		// at least one chunk goes into every segment
+		return false
+	}
+
+	return position+int64(chunkSize)+segmentTrailerSize(entries+1)+ewf.sessionSize()+ewf.errors2Size()+ewf.ltreeSize() > ewf.maxSegmentSize
 }
 
 // Seek implements vfs.FileDescriptionImpl.Seek.
@@ -210,19 +846,93 @@ func (ewf *EWFWriter) Seek(offset int64, whence int) (ret int64, err error) {
 	return ewf.dest.Seek(offset, whence)
 }
 
-func (ewf *EWFWriter) writeData(p []byte) error {
+// writeData encodes and stores p. The first error stops the compression workers, later writes
+// return it.
+func (ewf *EWFWriter) writeData(p []byte) (err error) {
+	if ewf.writeErr != nil {
+		return ewf.writeErr
+	}
 	if len(p) == 0 {
 		return nil
 	}
+	defer func() {
+		if err != nil {
+			ewf.writeErr = err
+			ewf.stopEncoders()
+		}
+	}()
+
+	if ewf.pipeline == nil {
+		bufc, compressed, err := ewf.encode(p)
+		if err != nil {
+			return err
+		}
+		return ewf.writeChunk(bufc, compressed)
+	}
+
+	for ewf.pipeline.Full() {
+		if err := ewf.writeEncodedChunk(ewf.pipeline.Next()); err != nil {
+			return err
+		}
+	}
+
+	// p is a window of the write buffer
+	ewf.pipeline.Submit(append([]byte(nil), p...))
+
+	for ewf.pipeline.Ready() {
+		if err := ewf.writeEncodedChunk(ewf.pipeline.Next()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushPipeline writes the chunks waiting in the pipeline and stops the compression workers
+func (ewf *EWFWriter) flushPipeline() error {
+	if ewf.pipeline == nil {
+		return nil
+	}
+	defer ewf.stopEncoders()
+
+	for c := ewf.pipeline.Next(); c != nil; c = ewf.pipeline.Next() {
+		if err := ewf.writeEncodedChunk(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// stopEncoders stops the compression workers after the chunks submitted to them are encoded
+func (ewf *EWFWriter) stopEncoders() {
+	if ewf.pipeline == nil {
+		return
+	}
+	ewf.pipeline.Close()
+	ewf.pipeline = nil
+}
+
+func (ewf *EWFWriter) writeEncodedChunk(c *shared.EncodedChunk) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	return ewf.writeChunk(c.Encoded, c.Compressed)
+}
+
+// writeChunk stores the encoded chunk bufc and adds it to the table
+func (ewf *EWFWriter) writeChunk(bufc []byte, compressed bool) error {
 	position, err := ewf.Seek(0, io.SeekCurrent)
 	if err != nil {
 		return err
 	}
-	var bufc []byte
-	bufc, err = ewf.compressor.Compress(p)
-	if err != nil {
-		return err
+	if ewf.needsRollover(position, len(bufc)) {
+		if err := ewf.rollover(); err != nil {
+			return err
+		}
+		position, err = ewf.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
 	}
 
 	n, err := ewf.dest.Write(bufc)
@@ -233,16 +943,10 @@ func (ewf *EWFWriter) writeData(p []byte) error {
 
 	// EVF1 table entries only store a 31-bit relative offset; segment/table logic
 	// will handle BaseOffset and splitting as needed.
-	if err := ewf.Segment.addTableEntry(position); err != nil {
+	if err := ewf.Segment.addTableEntry(position, compressed); err != nil {
 		return fmt.Errorf("failed to add table entry: %w", err)
 	}
 	ewf.Segment.Volume.Data.IncrementChunkCount()
 
-	_, err = ewf.md5Hasher.Write(p)
-	if err != nil {
-		return err
-	}
-
-	_, err = ewf.sha1Hasher.Write(p)
-	return err
+	return nil
 }
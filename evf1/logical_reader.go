@@ -0,0 +1,67 @@
+package evf1
+
+import (
+	"errors"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// ErrNotLogical is returned when opening an image that is not a logical evidence file as one
+var ErrNotLogical = errors.New("not a logical evidence file")
+
+// LogicalReader reads the files of a logical evidence file (L01). It implements fs.FS, paths are
+// relative to the root of the file entry tree.
+type LogicalReader struct {
+	*shared.LogicalFS
+
+	// EWF reads the media the file data is stored in
+	EWF *EWFReader
+}
+
+// OpenLogical opens the segment files of a logical evidence file, checksums are not validated
+func OpenLogical(fhs ...io.ReadSeeker) (*LogicalReader, error) {
+	return OpenLogicalWithOptions(shared.OpenOptions{}, fhs...)
+}
+
+// OpenLogicalWithOptions opens the segment files of a logical evidence file and decodes its file
+// entry tree. In strict mode the ltree section is validated as well.
+func OpenLogicalWithOptions(opts shared.OpenOptions, fhs ...io.ReadSeeker) (*LogicalReader, error) {
+	ewf, err := OpenEWFWithOptions(opts, fhs...)
+	if err != nil {
+		return nil, err
+	}
+	if string(ewf.First.EWFHeader.Signature[:]) != LVFSignature {
+		return nil, ErrNotLogical
+	}
+
+	ltree, err := ewf.ltree()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := shared.ParseSingleFiles(ltree.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogicalReader{
+		LogicalFS: shared.NewLogicalFS(ewf, root),
+		EWF:       ewf,
+	}, nil
+}
+
+// ltree decodes the segments up to the one holding the ltree section
+func (ewf *EWFReader) ltree() (*EWFLtreeSection, error) {
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.Ltree != nil {
+			return seg.Ltree, nil
+		}
+	}
+
+	return nil, errors.New("logical evidence file has no ltree section")
+}
@@ -0,0 +1,68 @@
+package evf1
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// CreateLogical returns a creator of a logical evidence file (L01). Files are added to the
+// writer with AddFS or AddDirectory, their data is stored in the media and the file entry tree in
+// the ltree section when the writer is closed.
+func CreateLogical(dest io.WriteSeeker) (*EWFCreator, error) {
+	creator, err := CreateEWF(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	ewf := creator.ewfWriter
+	copy(ewf.Segment.EWFHeader.Signature[:], []byte(LVFSignature))
+	ewf.mediaType = Logical
+	ewf.logical = shared.NewLogicalTree(ewf, func() int64 {
+		ewf.mu.Lock()
+		defer ewf.mu.Unlock()
+		return int64(ewf.mediaSize)
+	})
+
+	return creator, nil
+}
+
+// AddFS stores the directories and regular files of fsys under the root of the file entry tree.
+// Other file types are skipped.
+func (ewf *EWFWriter) AddFS(fsys fs.FS) error {
+	if ewf.logical == nil {
+		return errors.New("files can only be added to logical evidence files")
+	}
+	return ewf.logical.AddFS(fsys)
+}
+
+// AddDirectory stores the directory at path with its directories and regular files under the
+// root of the file entry tree
+func (ewf *EWFWriter) AddDirectory(path string) error {
+	if ewf.logical == nil {
+		return errors.New("files can only be added to logical evidence files")
+	}
+	return ewf.logical.AddDirectory(path)
+}
+
+// ltreeSection returns the ltree section of the file entry tree, nil when the image is not logical
+func (ewf *EWFWriter) ltreeSection() *EWFLtreeSection {
+	if ewf.logical == nil {
+		return nil
+	}
+	return &EWFLtreeSection{
+		Data: shared.FormatSingleFiles(ewf.logical.Root, int64(ewf.mediaSize)),
+	}
+}
+
+// ltreeSize bounds the number of bytes the ltree section takes at the end of the last segment
+func (ewf *EWFWriter) ltreeSize() int64 {
+	if ewf.logical == nil {
+		return 0
+	}
+	// single files data is UTF-16, a byte of UTF-8 takes two bytes at most
+	return int64(DescriptorSize) + int64(binary.Size(EWFLtreeSectionHeader{})) + 2*ewf.logical.SingleFilesReserve()
+}
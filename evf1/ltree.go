@@ -0,0 +1,129 @@
+package evf1
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// EWFLtreeSection holds the single files data of a logical evidence file (L01), the tree of the
+// file entries whose data is stored in the media.
+type EWFLtreeSection struct {
+	Header *EWFLtreeSectionHeader
+	// Data is the UTF-16 little-endian single files data
+	Data []byte
+}
+
+type EWFLtreeSectionHeader struct {
+	// IntegrityHash is the MD5 of the single files data
+	IntegrityHash [16]uint8
+	DataSize      uint64
+	// Checksum is the Adler-32 of the header with a zero checksum
+	Checksum uint32
+	Unknown  [20]uint8
+}
+
+func (d *EWFLtreeSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, segment *EWFSegment) error {
+	_, err := fh.Seek(section.DataOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	header := EWFLtreeSectionHeader{}
+	err = binary.Read(fh, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	d.Header = &header
+
+	if uint64(binary.Size(header))+header.DataSize > section.Size {
+		return fmt.Errorf("ltree section at 0x%x has %d bytes of data, more than the section holds", section.offset, header.DataSize)
+	}
+
+	d.Data = make([]byte, header.DataSize)
+	_, err = io.ReadFull(fh, d.Data)
+	if err != nil {
+		return err
+	}
+
+	if segment.strict {
+		return d.verify(section, segment.EWFHeader.SegmentNumber)
+	}
+
+	return nil
+}
+
+func (d *EWFLtreeSection) Encode(ewf io.WriteSeeker) error {
+	currentPosition, err := ewf.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if d.Header == nil {
+		d.Header = &EWFLtreeSectionHeader{}
+	}
+	d.Header.IntegrityHash = md5.Sum(d.Data)
+	d.Header.DataSize = uint64(len(d.Data))
+	d.Header.Checksum, err = d.Header.checksum()
+	if err != nil {
+		return err
+	}
+
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_LTREE)
+	desc.Size = uint64(binary.Size(d.Header)+len(d.Data)) + DescriptorSize
+	desc.Next = desc.Size + uint64(currentPosition)
+
+	_, desc.Checksum, err = shared.WriteWithSum(ewf, desc)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(ewf, binary.LittleEndian, d.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = ewf.Write(d.Data)
+	return err
+}
+
+// checksum returns the Adler-32 of the header with a zero checksum
+func (h *EWFLtreeSectionHeader) checksum() (uint32, error) {
+	zeroed := *h
+	zeroed.Checksum = 0
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, &zeroed); err != nil {
+		return 0, err
+	}
+	return adler32.Checksum(buf.Bytes()), nil
+}
+
+// verify validates the header checksum and the integrity hash of the data
+func (d *EWFLtreeSection) verify(section *EWFSectionDescriptor, segmentNumber uint16) error {
+	sum, err := d.Header.checksum()
+	if err != nil {
+		return err
+	}
+	if sum != d.Header.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "ltree header",
+			Stored:        d.Header.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	if md5.Sum(d.Data) != d.Header.IntegrityHash {
+		return fmt.Errorf("segment %d: ltree section at 0x%x does not match its integrity hash", segmentNumber, section.offset)
+	}
+
+	return nil
+}
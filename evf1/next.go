@@ -0,0 +1,29 @@
+package evf1
+
+import (
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+type EWFNextSection struct {
+}
+
+func (d *EWFNextSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor) error {
+	//next has no data
+	return nil
+}
+
+func (d *EWFNextSection) Encode(ewf io.WriteSeeker) (err error) {
+	currentPosition, err := ewf.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	// next points to itself like done, the reader continues with the following segment file
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_NEXT)
+	desc.Size = DescriptorSize
+	desc.Next = uint64(currentPosition)
+	_, _, err = shared.WriteWithSum(ewf, desc)
+	return
+}
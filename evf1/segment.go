@@ -1,11 +1,15 @@
 package evf1
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"sort"
+
+	"github.com/asalih/go-ewf/shared"
 )
 
 type EWFHeader struct {
@@ -23,6 +27,27 @@ func (e *EWFHeader) Encode(ewf io.WriteSeeker) error {
 	return binary.Write(ewf, binary.LittleEndian, e)
 }
 
+// TableFallback records a damaged table section that was replaced by its table2 mirror, or a
+// table whose mirror is valid as well but lists other chunks
+type TableFallback struct {
+	Segment uint16
+	// TableOffset is the offset of the damaged table section in the segment file
+	TableOffset int64
+	// MirrorOffset is the offset of the table2 section used instead
+	MirrorOffset int64
+	// Mismatch is set when both sections are valid but differ, the table is used then
+	Mismatch bool
+	// Reason is why the table could not be used
+	Reason error
+}
+
+func (f *TableFallback) String() string {
+	if f.Mismatch {
+		return fmt.Sprintf("segment %d: table at 0x%x differs from table2 at 0x%x, table used: %v", f.Segment, f.TableOffset, f.MirrorOffset, f.Reason)
+	}
+	return fmt.Sprintf("segment %d: table at 0x%x replaced by table2 at 0x%x: %v", f.Segment, f.TableOffset, f.MirrorOffset, f.Reason)
+}
+
 type EWFSegment struct {
 	EWFHeader *EWFHeader
 	Header    *EWFHeaderSection
@@ -31,17 +56,34 @@ type EWFSegment struct {
 	Tables    []*EWFTableSection
 	Digest    *EWFDigestSection
 	Hash      *EWFHashSection
+	Errors2   *EWFErrors2Section
+	Session   *EWFSessionSection
+	Ltree     *EWFLtreeSection
 	Data      *EWFDataSection
+	Next      *EWFNextSection
 	Done      *EWFDoneSection
 
 	SectionDescriptors []*EWFSectionDescriptor
 
+	// TableFallbacks lists the tables that were replaced by their table2 mirror or differ from it,
+	// the tables are validated in strict mode only
+	TableFallbacks []*TableFallback
+
 	fh           io.ReadSeeker
+	strict       bool
+	recover      bool
 	isDecoded    bool
 	chunkCount   int64
 	sectorCount  int64
 	sectorOffset int64
 	tableOffsets []int64
+
+	// ra reads the chunks and table entries of the segment file, safe for concurrent use
+	ra io.ReaderAt
+	// chunks caches the decompressed chunks of the image, nil when caching is disabled
+	chunks *shared.ChunkCache
+	// recovered is set when the tables were rebuilt by scanning the sectors sections
+	recovered bool
 }
 
 func NewEWFSegment(fh io.ReadSeeker) (*EWFSegment, error) {
@@ -52,6 +94,8 @@ func NewEWFSegment(fh io.ReadSeeker) (*EWFSegment, error) {
 	}
 
 	if fh != nil {
+		seg.ra = shared.NewReaderAt(fh)
+
 		ewfHeader := new(EWFHeader)
 		err := ewfHeader.Decode(fh)
 		if err != nil {
@@ -72,18 +116,63 @@ func (seg *EWFSegment) Decode(link *EWFSegment) error {
 		return nil
 	}
 
-	offset := int64(0)
-	sectorOffset := int64(0)
-
 	if link != nil && link.Volume != nil {
 		seg.Volume = link.Volume
 	}
 
+	err := seg.decodeSections()
+	if err == nil {
+		err = seg.resolveTables()
+	}
+	if err != nil {
+		// checksum mismatches of strict mode are not a truncated segment
+		var checksumErr *shared.ChecksumError
+		if !seg.recover || errors.As(err, &checksumErr) {
+			return err
+		}
+		if err := seg.recoverChunks(); err != nil {
+			return fmt.Errorf("segment %d: %w", seg.EWFHeader.SegmentNumber, err)
+		}
+	}
+
+	sectorOffset := int64(0)
+	for _, t := range seg.Tables {
+		if sectorOffset != 0 {
+			seg.tableOffsets = append(seg.tableOffsets, sectorOffset)
+		}
+		t.SectorOffset = sectorOffset
+		sectorOffset += t.SectorCount
+
+		seg.chunkCount += int64(t.Header.NumEntries)
+	}
+
+	seg.sectorCount = seg.chunkCount * int64(seg.Volume.Data.GetSectorCount())
+	if link != nil {
+		seg.sectorOffset = link.sectorOffset + link.sectorCount
+	}
+	seg.isDecoded = true
+
+	return nil
+}
+
+// decodeSections reads the sections of the segment from the current position of the file up to
+// the done section or the last section that points to itself
+func (seg *EWFSegment) decodeSections() error {
+	offset := int64(0)
+
 	for {
 		section, err := NewEWFSectionDescriptor(seg.fh)
 		if err != nil {
 			return err
 		}
+		var descriptorErr error
+		if seg.strict {
+			descriptorErr = section.verifyChecksum(seg.EWFHeader.SegmentNumber)
+			// a damaged table descriptor is resolved with the table2 mirror
+			if descriptorErr != nil && section.Type != EWF_SECTION_TYPE_TABLE && section.Type != EWF_SECTION_TYPE_TABLE2 {
+				return descriptorErr
+			}
+		}
 		seg.SectionDescriptors = append(seg.SectionDescriptors, section)
 
 		switch section.Type {
@@ -117,15 +206,24 @@ func (seg *EWFSegment) Decode(link *EWFSegment) error {
 			if err := table.Decode(seg.fh, section, seg); err != nil {
 				return err
 			}
+			table.descriptorErr = descriptorErr
 
-			if sectorOffset != 0 {
-				seg.tableOffsets = append(seg.tableOffsets, sectorOffset)
-			}
+			seg.Tables = append(seg.Tables, table)
 
-			table.SectorOffset = sectorOffset
-			sectorOffset += table.SectorCount
+		case EWF_SECTION_TYPE_TABLE2:
+			if len(seg.Tables) == 0 || seg.Tables[len(seg.Tables)-1].mirror != nil {
+				break
+			}
+			primary := seg.Tables[len(seg.Tables)-1]
 
-			seg.Tables = append(seg.Tables, table)
+			mirror := new(EWFTableSection)
+			if err := mirror.Decode(seg.fh, section, seg); err != nil {
+				return err
+			}
+			mirror.descriptorErr = descriptorErr
+			// chunk data ends where the table it mirrors starts
+			mirror.dataSection = primary.Section
+			primary.mirror = mirror
 
 		case EWF_SECTION_TYPE_DIGEST:
 			dig := new(EWFDigestSection)
@@ -141,6 +239,27 @@ func (seg *EWFSegment) Decode(link *EWFSegment) error {
 			}
 			seg.Hash = hashSec
 
+		case EWF_SECTION_TYPE_ERRORS2:
+			errSec := new(EWFErrors2Section)
+			if err := errSec.Decode(seg.fh, section, seg); err != nil {
+				return err
+			}
+			seg.Errors2 = errSec
+
+		case EWF_SECTION_TYPE_SESSION:
+			sessionSec := new(EWFSessionSection)
+			if err := sessionSec.Decode(seg.fh, section, seg); err != nil {
+				return err
+			}
+			seg.Session = sessionSec
+
+		case EWF_SECTION_TYPE_LTREE:
+			ltree := new(EWFLtreeSection)
+			if err := ltree.Decode(seg.fh, section, seg); err != nil {
+				return err
+			}
+			seg.Ltree = ltree
+
 		case EWF_SECTION_TYPE_DATA:
 			dataSec := new(EWFDataSection)
 			if err := dataSec.Decode(seg.fh, section); err != nil {
@@ -148,6 +267,13 @@ func (seg *EWFSegment) Decode(link *EWFSegment) error {
 			}
 			seg.Data = dataSec
 
+		case EWF_SECTION_TYPE_NEXT:
+			nextSec := new(EWFNextSection)
+			if err := nextSec.Decode(seg.fh, section); err != nil {
+				return err
+			}
+			seg.Next = nextSec
+
 		case EWF_SECTION_TYPE_DONE:
 			doneSec := new(EWFDoneSection)
 			if err := doneSec.Decode(seg.fh, section); err != nil {
@@ -163,6 +289,10 @@ func (seg *EWFSegment) Decode(link *EWFSegment) error {
 		if section.Next == uint64(offset) || section.Type == EWF_SECTION_TYPE_DONE {
 			break
 		}
+		// the sectors descriptor of an interrupted acquisition is never completed
+		if section.Next < uint64(section.offset) {
+			return fmt.Errorf("%s section at 0x%x points back to 0x%x", section.Type, section.offset, section.Next)
+		}
 
 		// Update the offset and seek to the next section
 		offset = int64(section.Next)
@@ -171,15 +301,194 @@ func (seg *EWFSegment) Decode(link *EWFSegment) error {
 		}
 	}
 
-	for _, t := range seg.Tables {
-		seg.chunkCount += int64(t.Header.NumEntries)
+	return nil
+}
+
+// recoverChunks replaces the tables of a segment whose sections could not be read up to the end,
+// e.g. of an interrupted acquisition, by tables of the chunks found in its sectors sections
+func (seg *EWFSegment) recoverChunks() error {
+	if seg.Volume == nil {
+		return errors.New("no volume section to recover the chunks with")
+	}
+	fileSize, err := seg.fh.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
 	}
 
-	seg.sectorCount = seg.chunkCount * int64(seg.Volume.Data.GetSectorCount())
-	if link != nil {
-		seg.sectorOffset = link.sectorOffset + link.sectorCount
+	layout := shared.ChunkLayout{
+		ChunkSize: int(seg.Volume.Data.GetSectorCount() * seg.Volume.Data.GetSectorSize()),
+		Checksum:  true,
+	}
+
+	seg.Tables = nil
+	seg.TableFallbacks = nil
+	for _, section := range seg.SectionDescriptors {
+		if section.Type != EWF_SECTION_TYPE_SECTORS {
+			continue
+		}
+
+		// the size of the sectors section is written after its chunks
+		end := fileSize
+		if section.Size > 0 && section.DataOffset+int64(section.Size) < end {
+			end = section.DataOffset + int64(section.Size)
+		}
+		chunks, err := shared.ScanChunks(seg.ra, section.DataOffset, end, layout)
+		if err != nil {
+			return err
+		}
+		if err := seg.addRecoveredTables(chunks); err != nil {
+			return err
+		}
+	}
+	seg.recovered = true
+
+	return nil
+}
+
+// addRecoveredTables adds tables listing the chunks found in a sectors section. The last chunk of
+// a table is measured up to where the data of the table ends.
+func (seg *EWFSegment) addRecoveredTables(chunks []shared.ScannedChunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	first := len(seg.Tables)
+	seg.Tables = append(seg.Tables, newTable())
+	for _, c := range chunks {
+		if err := seg.addTableEntry(c.Offset, c.Compressed); err != nil {
+			return err
+		}
+	}
+
+	last := chunks[len(chunks)-1]
+	for i := first; i < len(seg.Tables); i++ {
+		t := seg.Tables[i]
+		dataEnd := last.Offset + last.Size
+		if i+1 < len(seg.Tables) {
+			dataEnd = int64(seg.Tables[i+1].Header.BaseOffset)
+		}
+
+		t.fh = seg.fh
+		t.Segment = seg
+		// there is no table section, checksum errors of its chunks report where it would start
+		t.Section = &EWFSectionDescriptor{fh: seg.fh, offset: dataEnd}
+		t.dataSection = t.Section
+		t.BaseOffset = int64(t.Header.BaseOffset)
+		t.SectorCount = int64(t.Header.NumEntries) * int64(seg.Volume.Data.GetSectorCount())
+		t.SectorOffset = -1 // uninitialized
+		t.Size = t.SectorCount * int64(seg.Volume.Data.GetSectorSize())
+	}
+
+	return nil
+}
+
+// maxIdentifierSections bounds the section descriptors read to find the GUID of a segment
+const maxIdentifierSections = 16
+
+// setIdentifier returns the GUID of the acquisition, stored in the volume section of the first
+// segment and in the data section of the others. It is zero when the segment does not record
+// one. Only the sections before the chunk data are read.
+func (seg *EWFSegment) setIdentifier() ([16]byte, error) {
+	var guid [16]byte
+	offset := int64(binary.Size(EWFHeader{}))
+	for i := 0; i < maxIdentifierSections; i++ {
+		var desc EWFSectionDescriptorData
+		if err := binary.Read(io.NewSectionReader(seg.ra, offset, int64(DescriptorSize)), binary.LittleEndian, &desc); err != nil {
+			return guid, err
+		}
+		data := io.NewSectionReader(seg.ra, offset+int64(DescriptorSize), int64(desc.Size-DescriptorSize))
+
+		switch string(bytes.TrimRight(desc.Type[:], "\x00")) {
+		case EWF_SECTION_TYPE_VOLUME, EWF_SECTION_TYPE_DISK:
+			// the short volume layout has no GUID
+			if desc.Size-DescriptorSize != 0x41C {
+				return guid, nil
+			}
+			var volume EWFVolumeSectionData
+			if err := binary.Read(data, binary.LittleEndian, &volume); err != nil {
+				return guid, err
+			}
+			return volume.UUID, nil
+
+		case EWF_SECTION_TYPE_DATA:
+			var dataSec EWFDataSection
+			if err := binary.Read(data, binary.LittleEndian, &dataSec); err != nil {
+				return guid, err
+			}
+			return dataSec.GUID, nil
+
+		case EWF_SECTION_TYPE_SECTORS, EWF_SECTION_TYPE_TABLE, EWF_SECTION_TYPE_TABLE2,
+			EWF_SECTION_TYPE_NEXT, EWF_SECTION_TYPE_DONE:
+			return guid, nil
+		}
+
+		if desc.Next <= uint64(offset) {
+			return guid, nil
+		}
+		offset = int64(desc.Next)
+	}
+	return guid, nil
+}
+
+// endsWithNext reports whether the last section of the segment is a next section, so another
+// segment follows it. Only the section descriptors are read.
+func (seg *EWFSegment) endsWithNext() (bool, error) {
+	offset := int64(binary.Size(EWFHeader{}))
+	for {
+		var desc EWFSectionDescriptorData
+		if err := binary.Read(io.NewSectionReader(seg.ra, offset, int64(DescriptorSize)), binary.LittleEndian, &desc); err != nil {
+			return false, err
+		}
+
+		switch string(bytes.TrimRight(desc.Type[:], "\x00")) {
+		case EWF_SECTION_TYPE_NEXT:
+			return true, nil
+		case EWF_SECTION_TYPE_DONE:
+			return false, nil
+		}
+
+		// the last section points to itself
+		if desc.Next <= uint64(offset) {
+			return false, nil
+		}
+		offset = int64(desc.Next)
+	}
+}
+
+// resolveTables validates the tables and replaces damaged ones by their table2 mirror. A damaged
+// table without a valid mirror is an error in strict mode and used as it is otherwise. A valid
+// table whose valid mirror lists other chunks is reported as a fallback and used.
+func (seg *EWFSegment) resolveTables() error {
+	for i, t := range seg.Tables {
+		damaged := t.validate()
+		var mirrorDamaged error
+		if t.mirror != nil {
+			mirrorDamaged = t.mirror.validate()
+		}
+
+		switch {
+		case damaged != nil && t.mirror != nil && mirrorDamaged == nil:
+			seg.TableFallbacks = append(seg.TableFallbacks, &TableFallback{
+				Segment:      seg.EWFHeader.SegmentNumber,
+				TableOffset:  t.Section.offset,
+				MirrorOffset: t.mirror.Section.offset,
+				Reason:       damaged,
+			})
+			seg.Tables[i] = t.mirror
+
+		case damaged != nil && seg.strict:
+			return damaged
+
+		case t.mirror != nil && mirrorDamaged == nil && !t.matches(t.mirror):
+			seg.TableFallbacks = append(seg.TableFallbacks, &TableFallback{
+				Segment:      seg.EWFHeader.SegmentNumber,
+				TableOffset:  t.Section.offset,
+				MirrorOffset: t.mirror.Section.offset,
+				Mismatch:     true,
+				Reason:       errors.New("table and table2 list different chunks"),
+			})
+		}
 	}
-	seg.isDecoded = true
 
 	return nil
 }
@@ -213,11 +522,12 @@ func (seg *EWFSegment) ReadSectors(sector int64, count int) ([]byte, error) {
 	return buf, nil
 }
 
-// addTableEntry records a chunk at absolute file offset `absoluteOffset`.
+// addTableEntry records a chunk at absolute file offset `absoluteOffset`, compressed sets the
+// entry's compression flag.
 //
 // EVF1 table entries only have 31 bits for the offset (MSB is compression flag),
 // so we must use the table header `BaseOffset` and store a 31-bit relative offset.
-func (seg *EWFSegment) addTableEntry(absoluteOffset int64) error {
+func (seg *EWFSegment) addTableEntry(absoluteOffset int64, compressed bool) error {
 	if absoluteOffset < 0 {
 		return fmt.Errorf("invalid negative chunk offset: %d", absoluteOffset)
 	}
@@ -249,8 +559,10 @@ func (seg *EWFSegment) addTableEntry(absoluteOffset int64) error {
 	}
 
 	t.Header.NumEntries++
-	// data is always written as zlib-compressed in this writer
-	e := uint32(rel) | (1 << 31)
+	e := uint32(rel)
+	if compressed {
+		e |= 1 << 31
+	}
 	t.Entries.Data = append(t.Entries.Data, e)
 
 	return nil
@@ -0,0 +1,178 @@
+package evf1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// EWFSessionSection lists the sessions and tracks of optical media by their first sector,
+// a session runs up to the next one.
+type EWFSessionSection struct {
+	Header  *EWFSessionSectionHeader
+	Entries []EWFSessionSectionEntry
+	Footer  *EWFSessionSectionFooter
+
+	// damaged is the checksum mismatch of the section, nil when the checksums match
+	damaged error
+}
+
+type EWFSessionSectionHeader struct {
+	NumEntries uint32
+	Unknown    [28]uint8
+	Checksum   uint32
+}
+
+type EWFSessionSectionEntry struct {
+	Flags       uint32
+	FirstSector uint32
+	Unknown     [24]uint8
+}
+
+type EWFSessionSectionFooter struct {
+	Checksum uint32
+}
+
+func (d *EWFSessionSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, segment *EWFSegment) error {
+	_, err := fh.Seek(section.DataOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	header := EWFSessionSectionHeader{}
+	err = binary.Read(fh, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	d.Header = &header
+
+	entrySize := int64(binary.Size(EWFSessionSectionEntry{}))
+	if int64(binary.Size(header))+int64(header.NumEntries)*entrySize > int64(section.Size) {
+		return fmt.Errorf("session section at 0x%x has %d entries, more than the section holds", section.offset, header.NumEntries)
+	}
+
+	d.Entries = make([]EWFSessionSectionEntry, header.NumEntries)
+	err = binary.Read(fh, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return err
+	}
+
+	footer := EWFSessionSectionFooter{}
+	err = binary.Read(fh, binary.LittleEndian, &footer)
+	if err != nil {
+		return err
+	}
+	d.Footer = &footer
+
+	// sessions of a damaged section are not reported, strict mode fails to open the image
+	d.damaged = d.verifyChecksums(section, segment.EWFHeader.SegmentNumber)
+	if segment.strict {
+		return d.damaged
+	}
+
+	return nil
+}
+
+func (d *EWFSessionSection) Encode(ewf io.WriteSeeker) error {
+	currentPosition, err := ewf.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if d.Header == nil {
+		d.Header = &EWFSessionSectionHeader{}
+	}
+	if d.Footer == nil {
+		d.Footer = &EWFSessionSectionFooter{}
+	}
+	d.Header.NumEntries = uint32(len(d.Entries))
+
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_SESSION)
+	desc.Size = uint64(binary.Size(d.Header)+binary.Size(d.Entries)+binary.Size(d.Footer)) + DescriptorSize
+	desc.Next = desc.Size + uint64(currentPosition)
+
+	_, desc.Checksum, err = shared.WriteWithSum(ewf, desc)
+	if err != nil {
+		return err
+	}
+
+	_, d.Header.Checksum, err = shared.WriteWithSum(ewf, d.Header)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = binary.Write(buf, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return err
+	}
+	// only entries data
+	d.Footer.Checksum = adler32.Checksum(buf.Bytes())
+	err = binary.Write(buf, binary.LittleEndian, d.Footer.Checksum)
+	if err != nil {
+		return err
+	}
+
+	_, err = ewf.Write(buf.Bytes())
+	return err
+}
+
+// verifyChecksums validates the checksums of the header and the entries
+func (d *EWFSessionSection) verifyChecksums(section *EWFSectionDescriptor, segmentNumber uint16) error {
+	sum, err := shared.Checksum(d.Header)
+	if err != nil {
+		return err
+	}
+	if sum != d.Header.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "session header",
+			Stored:        d.Header.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, d.Entries); err != nil {
+		return err
+	}
+	sum = adler32.Checksum(buf.Bytes())
+	if sum != d.Footer.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "session entries",
+			Stored:        d.Footer.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	return nil
+}
+
+// Sessions returns the sessions of media with totalSectors sectors, an error when the section
+// is damaged
+func (d *EWFSessionSection) Sessions(totalSectors uint64) ([]shared.Session, error) {
+	if d.damaged != nil {
+		return nil, d.damaged
+	}
+
+	sessions := make([]shared.Session, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		sessions = append(sessions, shared.Session{
+			Range: shared.SectorRange{First: uint64(e.FirstSector)},
+			Flags: e.Flags,
+		})
+	}
+	if err := shared.SetSessionCounts(sessions, totalSectors); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
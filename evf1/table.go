@@ -2,11 +2,14 @@ package evf1
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash/adler32"
 	"io"
 	"math"
+	"sync"
 
 	"github.com/asalih/go-ewf/shared"
 )
@@ -76,6 +79,16 @@ type EWFTableSection struct {
 	SectorOffset int64
 	Size         int64
 	Offset       int64
+
+	// dataSection is the section the last chunk is measured against, for a table2 it is
+	// the table it mirrors
+	dataSection *EWFSectionDescriptor
+	// mirror is the table2 section that follows the table
+	mirror *EWFTableSection
+	// descriptorErr is the checksum mismatch of the section descriptor found in strict mode
+	descriptorErr error
+	// entriesMu guards the lazy loading of the entries
+	entriesMu sync.Mutex
 }
 
 func newTable() *EWFTableSection {
@@ -90,6 +103,7 @@ func (d *EWFTableSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor
 	d.fh = fh
 	d.Segment = segment
 	d.Section = section
+	d.dataSection = section
 
 	if _, err := d.fh.Seek(d.Section.DataOffset, io.SeekStart); err != nil {
 		return err
@@ -182,38 +196,154 @@ func (t *EWFTableSection) readData() error {
 }
 
 func (t *EWFTableSection) getEntry(index int64) (entryPosition uint32, err error) {
-	if t.Header.NumEntries > 0 && len(t.Entries.Data) > 0 {
-		return t.Entries.Data[index], nil
+	err = t.loadEntries()
+	if err != nil {
+		return
+	}
+	return t.Entries.Data[index], nil
+}
+
+// loadEntries reads the table entries once, concurrent reads of chunks wait for the first one
+func (t *EWFTableSection) loadEntries() error {
+	t.entriesMu.Lock()
+	defer t.entriesMu.Unlock()
+
+	if t.Header.NumEntries == 0 || len(t.Entries.Data) > 0 {
+		return nil
 	}
 
-	cpos, err := t.fh.Seek(0, io.SeekCurrent)
+	entries := make([]uint32, t.Header.NumEntries)
+	r := io.NewSectionReader(t.Segment.ra, t.Entries.position, int64(binary.Size(entries)))
+	if err := binary.Read(r, binary.LittleEndian, &entries); err != nil {
+		return err
+	}
+	t.Entries.Data = entries
+	return nil
+}
+
+// validate checks the checksums of the section descriptor, the table header and entries and that the entries point to
+// chunk data before the end of the section the chunks are measured against
+func (t *EWFTableSection) validate() error {
+	if t.descriptorErr != nil {
+		return t.descriptorErr
+	}
+
+	sum, err := shared.Checksum(t.Header)
 	if err != nil {
-		return
+		return err
+	}
+	if sum != t.Header.Checksum {
+		return t.checksumError("table header", -1, t.Header.Checksum, sum)
 	}
-	defer func() {
-		// revert back to initial position
-		_, errs := t.fh.Seek(cpos, io.SeekStart)
-		if err == nil {
-			err = errs
-		}
-	}()
 
-	_, err = t.fh.Seek(t.Entries.position, io.SeekStart)
+	if int64(binary.Size(t.Header))+int64(t.Header.NumEntries)*Uint32Size > int64(t.Section.Size) {
+		return fmt.Errorf("table at 0x%x has %d entries, more than the section holds", t.Section.offset, t.Header.NumEntries)
+	}
+
+	err = t.verifyEntriesChecksum()
 	if err != nil {
-		return
+		return err
+	}
+
+	sectionEnd := t.dataSection.end()
+	for i, entry := range t.Entries.Data {
+		if chunkOffset := t.BaseOffset + int64(entry&0x7FFFFFFF); chunkOffset >= sectionEnd {
+			return fmt.Errorf("table at 0x%x entry %d points to 0x%x, beyond the table section", t.Section.offset, i, chunkOffset)
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the table lists the same chunks as other
+func (t *EWFTableSection) matches(other *EWFTableSection) bool {
+	if t.Header.NumEntries != other.Header.NumEntries || t.Header.BaseOffset != other.Header.BaseOffset {
+		return false
 	}
+	if t.loadEntries() != nil || other.loadEntries() != nil {
+		return false
+	}
+	for i, entry := range t.Entries.Data {
+		if other.Entries.Data[i] != entry {
+			return false
+		}
+	}
+	return true
+}
 
-	t.Entries.Data = make([]uint32, t.Header.NumEntries)
-	err = binary.Read(t.fh, binary.LittleEndian, &t.Entries.Data)
+// verifyEntriesChecksum validates the checksum of the table entries
+func (t *EWFTableSection) verifyEntriesChecksum() error {
+	err := t.loadEntries()
 	if err != nil {
-		return
+		return err
 	}
-	entryPosition = t.Entries.Data[index]
-	return
+
+	// entries are followed by their checksum, images of older versions may not have it
+	entriesSize := int64(binary.Size(t.Entries.Data))
+	if int64(binary.Size(t.Header))+entriesSize+ChecksumSize > int64(t.Section.Size) {
+		return nil
+	}
+
+	footer := EWFTableSectionFooter{}
+	r := io.NewSectionReader(t.Segment.ra, t.Entries.position+entriesSize, ChecksumSize)
+	if err := binary.Read(r, binary.LittleEndian, &footer); err != nil {
+		return err
+	}
+	t.Footer = &footer
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, t.Entries.Data); err != nil {
+		return err
+	}
+	sum := adler32.Checksum(buf.Bytes())
+	if sum != footer.Checksum {
+		return t.checksumError("table entries", -1, footer.Checksum, sum)
+	}
+
+	return nil
+}
+
+// checksumError describes a checksum mismatch of the table or of one of its chunks
+func (t *EWFTableSection) checksumError(section string, chunk int64, stored, computed uint32) error {
+	if chunk >= 0 {
+		chunk = t.imageChunk(chunk)
+	}
+	return &shared.ChecksumError{
+		Segment:       t.Segment.EWFHeader.SegmentNumber,
+		SectionOffset: t.Section.offset,
+		Chunk:         chunk,
+		Section:       section,
+		Stored:        stored,
+		Computed:      computed,
+	}
+}
+
+// imageChunk returns the index in the image of the chunk at index chunk of the table
+func (t *EWFTableSection) imageChunk(chunk int64) int64 {
+	return chunk + (t.Segment.sectorOffset+t.SectorOffset)/int64(t.Segment.Volume.Data.GetSectorCount())
 }
 
+// readChunk returns the data of the chunk at index chunk of the table, from the chunk cache
+// when the reader has one
 func (t *EWFTableSection) readChunk(chunk int64) ([]byte, error) {
+	if t.Segment.chunks == nil || chunk < 0 || chunk >= int64(t.Header.NumEntries) {
+		return t.decodeChunk(chunk)
+	}
 
+	key := t.imageChunk(chunk)
+	if data, ok := t.Segment.chunks.Get(key); ok {
+		return data, nil
+	}
+	data, err := t.decodeChunk(chunk)
+	if err != nil {
+		return nil, err
+	}
+	t.Segment.chunks.Add(key, data)
+	return data, nil
+}
+
+// decodeChunk reads and decompresses the chunk at index chunk of the table
+func (t *EWFTableSection) decodeChunk(chunk int64) ([]byte, error) {
 	if chunk < 0 || chunk >= int64(t.Header.NumEntries) {
 		return nil, errors.New("invalid chunk index")
 	}
@@ -244,19 +374,43 @@ func (t *EWFTableSection) readChunk(chunk int64) ([]byte, error) {
 	// Non compressed chunks have a 4 byte checksum
 	if !compressed {
 		chunkSize -= ChecksumSize
-	}
 
-	if _, err := t.fh.Seek(int64(chunkOffset), io.SeekStart); err != nil {
-		return nil, err
+		// size of the last chunk is measured up to the table section which may not
+		// directly follow the chunk data
+		maxChunkSize := int64(t.Segment.Volume.Data.GetSectorCount()) * int64(t.Segment.Volume.Data.GetSectorSize())
+		if chunkSize > maxChunkSize {
+			chunkSize = maxChunkSize
+		}
+		if t.Segment.strict {
+			chunkSize += ChecksumSize
+		}
 	}
 
 	buf := make([]byte, chunkSize)
-	if _, err := io.ReadFull(t.fh, buf); err != nil {
+	if _, err := io.ReadFull(io.NewSectionReader(t.Segment.ra, chunkOffset, chunkSize), buf); err != nil {
 		return nil, err
 	}
 
 	if compressed {
-		return shared.DecompressZlib(buf)
+		data, err := shared.DecompressZlib(buf)
+		if errors.Is(err, zlib.ErrChecksum) && t.Segment.strict {
+			// stored checksum is the last 4 bytes of the zlib stream
+			stored := binary.BigEndian.Uint32(buf[len(buf)-ChecksumSize:])
+			return nil, t.checksumError("chunk", chunk, stored, adler32.Checksum(data))
+		}
+		return data, err
+	}
+
+	if t.Segment.strict {
+		if len(buf) < ChecksumSize {
+			return nil, errors.New("chunk too short for a checksum")
+		}
+		data := buf[:len(buf)-ChecksumSize]
+		stored := binary.LittleEndian.Uint32(buf[len(data):])
+		if sum := adler32.Checksum(data); sum != stored {
+			return nil, t.checksumError("chunk", chunk, stored, sum)
+		}
+		return data, nil
 	}
 
 	return buf, nil
@@ -264,12 +418,13 @@ func (t *EWFTableSection) readChunk(chunk int64) ([]byte, error) {
 
 // Helper function to calculate the size of the last chunk
 func (t *EWFTableSection) calculateLastChunkSize(chunkOffset int64) int64 {
-	if chunkOffset < t.Section.offset {
-		return t.Section.offset - chunkOffset
+	section := t.dataSection
+	if chunkOffset < section.offset {
+		return section.offset - chunkOffset
 	}
 
-	if chunkOffset < t.Section.offset+int64(t.Section.Size) {
-		return t.Section.offset + int64(t.Section.Size) - chunkOffset
+	if chunkOffset < section.end() {
+		return section.end() - chunkOffset
 	}
 
 	return -1
@@ -300,6 +455,13 @@ func (ets *EWFTableSection) readSectors(sector uint64, count uint64) ([]byte, er
 		if err != nil {
 			return buf, err
 		}
+		// the last chunk of the image may be short
+		if chunkEnd > uint64(len(buf)) {
+			chunkEnd = uint64(len(buf))
+		}
+		if chunkPos > chunkEnd {
+			chunkPos = chunkEnd
+		}
 		if chunkPos != 0 || tableSectors != uint64(chunkSectorCount) {
 			buf = buf[chunkPos:chunkEnd]
 		}
@@ -11,6 +11,8 @@ type EWFVolume interface {
 	GetSectorSize() uint32
 	GetSectorCount() uint32
 	GetChunkCount() uint32
+	GetTotalSectorCount() uint64
+	SetTotalSectorCount(uint64)
 	IncrementChunkCount()
 	GetChecksum() uint32
 	SetChecksum(uint32)
@@ -38,23 +40,25 @@ func DefaultVolume() *EWFVolumeSectionData {
 	return &EWFVolumeSectionData{
 		MediaType:        Fixed,
 		Reserved1:        [3]uint8{},
-		SectorCount:      64,
-		SectorSize:       512,
+		SectorCount:      DefaultSectorsPerChunk,
+		SectorSize:       DefaultSectorSize,
 		MediaFlags:       Image,
 		Unknown1:         [3]uint8{},
 		CompressionLevel: None,
 		Unknown3:         [3]uint8{},
 		UUID:             [16]uint8{},
-		Pad:              [963]uint8{},
+		Pad:              [955]uint8{},
 		Signature:        [5]byte{},
 	}
 }
 
-func (e *EWFVolumeSectionSpecData) GetSectorSize() uint32  { return e.SectorSize }
-func (e *EWFVolumeSectionSpecData) GetSectorCount() uint32 { return e.SectorCount }
-func (e *EWFVolumeSectionSpecData) GetChunkCount() uint32  { return e.ChunkCount }
-func (e *EWFVolumeSectionSpecData) GetChecksum() uint32    { return e.Checksum }
-func (e *EWFVolumeSectionSpecData) SetChecksum(c uint32)   { e.Checksum = c }
+func (e *EWFVolumeSectionSpecData) GetSectorSize() uint32        { return e.SectorSize }
+func (e *EWFVolumeSectionSpecData) GetSectorCount() uint32       { return e.SectorCount }
+func (e *EWFVolumeSectionSpecData) GetChunkCount() uint32        { return e.ChunkCount }
+func (e *EWFVolumeSectionSpecData) GetTotalSectorCount() uint64  { return uint64(e.TotalSectorCount) }
+func (e *EWFVolumeSectionSpecData) SetTotalSectorCount(c uint64) { e.TotalSectorCount = uint32(c) }
+func (e *EWFVolumeSectionSpecData) GetChecksum() uint32          { return e.Checksum }
+func (e *EWFVolumeSectionSpecData) SetChecksum(c uint32)         { e.Checksum = c }
 func (e *EWFVolumeSectionSpecData) IncrementChunkCount() {
 	e.ChunkCount++
 	e.TotalSectorCount = e.ChunkCount * e.SectorCount
@@ -80,16 +84,22 @@ type EWFVolumeSectionData struct {
 	ErrorGranularity uint32
 	Unknown4         uint32
 	UUID             [16]byte
-	Pad              [963]byte
-	Signature        [5]byte
-	Checksum         uint32
+	// MediaSize is the number of bytes of media that is not a whole number of sectors, 0 when it
+	// is not recorded. It is written by this package only, in space of the section other
+	// producers leave empty. Other readers see the last sector filled up with zeros.
+	MediaSize uint64
+	Pad       [955]byte
+	Signature [5]byte
+	Checksum  uint32
 }
 
-func (e *EWFVolumeSectionData) GetSectorSize() uint32  { return e.SectorSize }
-func (e *EWFVolumeSectionData) GetSectorCount() uint32 { return e.SectorCount }
-func (e *EWFVolumeSectionData) GetChunkCount() uint32  { return e.ChunkCount }
-func (e *EWFVolumeSectionData) GetChecksum() uint32    { return e.Checksum }
-func (e *EWFVolumeSectionData) SetChecksum(c uint32)   { e.Checksum = c }
+func (e *EWFVolumeSectionData) GetSectorSize() uint32        { return e.SectorSize }
+func (e *EWFVolumeSectionData) GetSectorCount() uint32       { return e.SectorCount }
+func (e *EWFVolumeSectionData) GetChunkCount() uint32        { return e.ChunkCount }
+func (e *EWFVolumeSectionData) GetTotalSectorCount() uint64  { return e.TotalSectorCount }
+func (e *EWFVolumeSectionData) SetTotalSectorCount(c uint64) { e.TotalSectorCount = c }
+func (e *EWFVolumeSectionData) GetChecksum() uint32          { return e.Checksum }
+func (e *EWFVolumeSectionData) SetChecksum(c uint32)         { e.Checksum = c }
 func (e *EWFVolumeSectionData) IncrementChunkCount() {
 	e.ChunkCount++
 	e.TotalSectorCount = uint64(e.ChunkCount) * uint64(e.GetSectorCount())
@@ -1,6 +1,28 @@
 package evf1
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/asalih/go-ewf/shared"
+)
 
 func TestEVF1TableBaseOffsetAnd31BitRelativeOffsets(t *testing.T) {
 	seg, err := NewEWFSegment(nil)
@@ -17,13 +39,13 @@ func TestEVF1TableBaseOffsetAnd31BitRelativeOffsets(t *testing.T) {
 	const nearLimit = int64(0x7FFFFFF0) // within 31-bit range if base is small
 	const beyondLimit = int64(0x80000010)
 
-	if err := seg.addTableEntry(base); err != nil {
+	if err := seg.addTableEntry(base, true); err != nil {
 		t.Fatalf("addTableEntry(base): %v", err)
 	}
-	if err := seg.addTableEntry(nearLimit); err != nil {
+	if err := seg.addTableEntry(nearLimit, true); err != nil {
 		t.Fatalf("addTableEntry(nearLimit): %v", err)
 	}
-	if err := seg.addTableEntry(beyondLimit); err != nil {
+	if err := seg.addTableEntry(beyondLimit, true); err != nil {
 		t.Fatalf("addTableEntry(beyondLimit): %v", err)
 	}
 
@@ -69,3 +91,2223 @@ func TestEVF1TableBaseOffsetAnd31BitRelativeOffsets(t *testing.T) {
 	}
 }
 
+
+func TestEVF1WriterRollsOverSegments(t *testing.T) {
+	// 40 chunks of incompressible data, a few chunks fit into a segment.
+	data := make([]byte, 40*DefaultChunkSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	tmpDir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(tmpDir, fmt.Sprintf("split.E%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.AddMediaInfo(EWF_HEADER_VALUES_INDEX_CASE_NUMBER, "SPLIT")
+
+	const maxSegmentSize = 300 * 1024
+	creator.SetSegmentSize(maxSegmentSize, func(segmentNumber uint16) (io.WriteSeeker, error) {
+		return os.Create(segmentPath(segmentNumber))
+	})
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(tmpDir, "split.E*"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("expected at least 3 segments, got %d", len(paths))
+	}
+
+	fhs := make([]io.ReadSeeker, 0, len(paths))
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if st.Size() > maxSegmentSize {
+			t.Fatalf("segment %s exceeds maximum size: %d", p, st.Size())
+		}
+
+		rf, err := os.Open(p)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer rf.Close()
+		fhs = append(fhs, rf)
+	}
+
+	reader, err := OpenEWF(fhs...)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	if reader.Size() != int64(len(data)) {
+		t.Fatalf("size mismatch: got %d want %d", reader.Size(), len(data))
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	for i := 0; i < len(paths); i++ {
+		seg, _, err := reader.Segment(i)
+		if err != nil {
+			t.Fatalf("Segment(%d): %v", i, err)
+		}
+		if got := int(seg.EWFHeader.SegmentNumber); got != i+1 {
+			t.Fatalf("segment number mismatch: got %d want %d", got, i+1)
+		}
+		last := i == len(paths)-1
+		if (seg.Done != nil) != last || (seg.Next != nil) == last {
+			t.Fatalf("segment %d has unexpected next/done sections", i+1)
+		}
+		if last && seg.Digest == nil {
+			t.Fatalf("last segment has no digest section")
+		}
+
+		// header and volume open the first segment, a data section repeating the volume the others
+		want := []string{EWF_SECTION_TYPE_HEADER, EWF_SECTION_TYPE_HEADER, EWF_SECTION_TYPE_VOLUME, EWF_SECTION_TYPE_SECTORS}
+		if i > 0 {
+			want = []string{EWF_SECTION_TYPE_DATA, EWF_SECTION_TYPE_SECTORS}
+			if seg.Data == nil || seg.Data.ChunkCount != reader.First.Volume.Data.GetChunkCount() ||
+				seg.Data.Sectors != reader.First.Volume.Data.GetTotalSectorCount() {
+				t.Fatalf("segment %d has no data section matching the volume: %+v", i+1, seg.Data)
+			}
+		}
+		for j, typ := range want {
+			if got := seg.SectionDescriptors[j].Type; got != typ {
+				t.Fatalf("segment %d section %d is %q, want %q", i+1, j, got, typ)
+			}
+		}
+	}
+}
+
+func TestEVF1WriterCompressionLevels(t *testing.T) {
+	// Small tables so the last chunk of a table is followed by other chunks.
+	old := maxTableLength
+	maxTableLength = 2
+	defer func() { maxTableLength = old }()
+
+	data := make([]byte, 5*DefaultChunkSize)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	tests := []struct {
+		level       CompressionLevel
+		headerValue string
+		compressed  bool
+	}{
+		{None, EWF_HEADER_VALUES_INDEX_COMPRESSION_NO, false},
+		{Good, EWF_HEADER_VALUES_INDEX_COMPRESSION_FASTEST, true},
+		{Best, EWF_HEADER_VALUES_INDEX_COMPRESSION_BEST, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(CompressionLevels[tt.headerValue], func(t *testing.T) {
+			ewfPath := filepath.Join(t.TempDir(), "level.E01")
+			f, err := os.Create(ewfPath)
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+
+			creator, err := CreateEWF(f)
+			if err != nil {
+				t.Fatalf("CreateEWF: %v", err)
+			}
+			creator.SetCompressionLevel(tt.level)
+
+			w, err := creator.Start()
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("file close: %v", err)
+			}
+
+			rf, err := os.Open(ewfPath)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer rf.Close()
+
+			reader, err := OpenEWF(rf)
+			if err != nil {
+				t.Fatalf("OpenEWF: %v", err)
+			}
+
+			vol, ok := reader.First.Volume.Data.(*EWFVolumeSectionData)
+			if !ok {
+				t.Fatalf("unexpected volume type %T", reader.First.Volume.Data)
+			}
+			if vol.CompressionLevel != tt.level {
+				t.Fatalf("volume compression level mismatch: got %v want %v", vol.CompressionLevel, tt.level)
+			}
+			if got := reader.First.Header.MediaInfo[string(EWF_HEADER_VALUES_INDEX_COMPRESSION_TYPE)]; got != tt.headerValue {
+				t.Fatalf("header compression type mismatch: got %q want %q", got, tt.headerValue)
+			}
+
+			for _, tbl := range reader.First.Tables {
+				entry, err := tbl.getEntry(0)
+				if err != nil {
+					t.Fatalf("getEntry: %v", err)
+				}
+				if (entry>>31 == 1) != tt.compressed {
+					t.Fatalf("table entry compressed flag mismatch: %#x", entry)
+				}
+			}
+
+			readAll := make([]byte, len(data))
+			if _, err := io.ReadFull(reader, readAll); err != nil {
+				t.Fatalf("ReadFull: %v", err)
+			}
+			if !bytes.Equal(data, readAll) {
+				t.Fatalf("data mismatch after full read")
+			}
+		})
+	}
+}
+
+func TestEVF1WriterParallelCompression(t *testing.T) {
+	old := maxTableLength
+	maxTableLength = 16
+	defer func() { maxTableLength = old }()
+
+	// mix of compressible and random chunks so workers finish out of order
+	data := make([]byte, 64*DefaultChunkSize)
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < len(data); i += DefaultChunkSize {
+		if (i/DefaultChunkSize)%3 == 0 {
+			rnd.Read(data[i : i+DefaultChunkSize])
+		}
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "parallel.E01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	// the in flight limit has to hold a chunk
+	if err := creator.SetCompressionWorkers(4, DefaultChunkSize-1); err == nil {
+		t.Fatalf("expected an error for an in flight limit below one chunk")
+	}
+	if err := creator.SetCompressionWorkers(4, 6*DefaultChunkSize); err != nil {
+		t.Fatalf("SetCompressionWorkers: %v", err)
+	}
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// odd write sizes so chunks are cut from the middle of writes
+	for off := 0; off < len(data); off += 10000 {
+		end := off + 10000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[off:end]); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWF(rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	if md5.Sum(data) != reader.First.Digest.MD5 {
+		t.Fatalf("stored MD5 does not match the written data")
+	}
+	if sha1.Sum(data) != reader.First.Digest.SHA1 {
+		t.Fatalf("stored SHA1 does not match the written data")
+	}
+}
+
+// fullDestination fails writes once limit bytes are written
+type fullDestination struct {
+	io.WriteSeeker
+	limit int
+}
+
+func (d *fullDestination) Write(p []byte) (int, error) {
+	if len(p) > d.limit {
+		return 0, errors.New("no space left")
+	}
+	d.limit -= len(p)
+	return d.WriteSeeker.Write(p)
+}
+
+func TestEVF1WriterStopsWorkersOnWriteError(t *testing.T) {
+	data := make([]byte, 32*DefaultChunkSize)
+	rand.New(rand.NewSource(21)).Read(data)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "full.E01"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	creator, err := CreateEWF(&fullDestination{f, 8 * DefaultChunkSize})
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	if err := creator.SetCompressionWorkers(4, 0); err != nil {
+		t.Fatalf("SetCompressionWorkers: %v", err)
+	}
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	_, writeErr := w.Write(data)
+	if writeErr == nil {
+		t.Fatalf("expected the write to fail")
+	}
+	// the writer is given up, nothing else stops the workers
+	if w.pipeline != nil {
+		t.Fatalf("compression workers still running after a failed write")
+	}
+	if _, err := w.Write(data[:1]); err != writeErr {
+		t.Fatalf("write after a failure: got %v, want %v", err, writeErr)
+	}
+	if err := w.Close(); err != writeErr {
+		t.Fatalf("Close after a failure: got %v, want %v", err, writeErr)
+	}
+}
+
+func TestEVF1WriterSectorGeometry(t *testing.T) {
+	const bytesPerSector, sectorsPerChunk = 4096, 128
+	chunkSize := bytesPerSector * sectorsPerChunk
+
+	data := make([]byte, 3*chunkSize)
+	rnd := rand.New(rand.NewSource(3))
+	rnd.Read(data[:chunkSize])
+	for i := chunkSize; i < len(data); i++ {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "4kn.E01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSectorGeometry(bytesPerSector, sectorsPerChunk)
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWF(rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	vol := reader.First.Volume.Data
+	if vol.GetSectorSize() != bytesPerSector || vol.GetSectorCount() != sectorsPerChunk {
+		t.Fatalf("volume geometry mismatch: got %d/%d", vol.GetSectorSize(), vol.GetSectorCount())
+	}
+	if vol.GetChunkCount() != 3 {
+		t.Fatalf("volume chunk count mismatch: got %d want 3", vol.GetChunkCount())
+	}
+	if d := reader.First.Data; d.BytesPerSector != bytesPerSector || d.SectorPerChunk != sectorsPerChunk {
+		t.Fatalf("data geometry mismatch: got %d/%d", d.BytesPerSector, d.SectorPerChunk)
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	bad, err := os.Create(filepath.Join(t.TempDir(), "bad.E01"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer bad.Close()
+
+	creator, err = CreateEWF(bad)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSectorGeometry(0, sectorsPerChunk)
+	if _, err := creator.Start(); err == nil {
+		t.Fatalf("expected Start to fail with zero bytes per sector")
+	}
+}
+
+func TestEVF1WriterStoresShortLastChunk(t *testing.T) {
+	// neither chunk nor sector aligned
+	data := make([]byte, 2*DefaultChunkSize+1000)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	for _, level := range []CompressionLevel{None, Best} {
+		ewfPath := filepath.Join(t.TempDir(), "short.E01")
+		f, err := os.Create(ewfPath)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+
+		creator, err := CreateEWF(f)
+		if err != nil {
+			t.Fatalf("CreateEWF: %v", err)
+		}
+		creator.SetCompressionLevel(level)
+
+		w, err := creator.Start()
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("file close: %v", err)
+		}
+
+		rf, err := os.Open(ewfPath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer rf.Close()
+
+		reader, err := OpenEWF(rf)
+		if err != nil {
+			t.Fatalf("OpenEWF: %v", err)
+		}
+
+		wantSectors := uint64(len(data)+DefaultSectorSize-1) / DefaultSectorSize
+		if got := reader.First.Volume.Data.GetTotalSectorCount(); got != wantSectors {
+			t.Fatalf("volume sector count mismatch: got %d want %d", got, wantSectors)
+		}
+		if got := reader.First.Data.Sectors; got != wantSectors {
+			t.Fatalf("data sector count mismatch: got %d want %d", got, wantSectors)
+		}
+		if got := reader.First.Volume.Data.GetChunkCount(); got != 3 {
+			t.Fatalf("chunk count mismatch: got %d want 3", got)
+		}
+
+		last, err := reader.First.Tables[0].readChunk(2)
+		if err != nil {
+			t.Fatalf("readChunk: %v", err)
+		}
+		// the stored chunk fills up the last sector, the volume records the size of the source
+		if len(last) != 1024 {
+			t.Fatalf("last chunk size mismatch: got %d want 1024", len(last))
+		}
+		if got := reader.First.Volume.Data.(*EWFVolumeSectionData).MediaSize; got != uint64(len(data)) {
+			t.Fatalf("recorded media size mismatch: got %d want %d", got, len(data))
+		}
+		if reader.Size() != int64(len(data)) {
+			t.Fatalf("size mismatch: got %d want %d", reader.Size(), len(data))
+		}
+
+		wantMD5 := md5.Sum(data)
+		wantSHA1 := sha1.Sum(data)
+		if reader.First.Digest.MD5 != wantMD5 || reader.First.Digest.SHA1 != wantSHA1 {
+			t.Fatalf("digest does not match the source data")
+		}
+
+		readAll := make([]byte, len(data))
+		if _, err := io.ReadFull(reader, readAll); err != nil {
+			t.Fatalf("ReadFull: %v", err)
+		}
+		if !bytes.Equal(data, readAll) {
+			t.Fatalf("data mismatch after full read")
+		}
+	}
+}
+
+func TestEVF1VerifyHashes(t *testing.T) {
+	data := make([]byte, 3*DefaultChunkSize+700)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	ewfPath := filepath.Join(t.TempDir(), "verify.E01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	// uncompressed chunks so the data can be altered in place
+	creator.SetCompressionLevel(None)
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	verify := func() *shared.HashVerification {
+		rf, err := os.Open(ewfPath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer rf.Close()
+
+		reader, err := OpenEWF(rf)
+		if err != nil {
+			t.Fatalf("OpenEWF: %v", err)
+		}
+
+		var processed int64
+		result, err := reader.VerifyHashes(context.Background(), func(p, total int64) {
+			processed = p
+		})
+		if err != nil {
+			t.Fatalf("VerifyHashes: %v", err)
+		}
+		if processed != int64(len(data)) || result.BytesRead != int64(len(data)) {
+			t.Fatalf("processed %d bytes, read %d bytes, want %d", processed, result.BytesRead, len(data))
+		}
+		return result
+	}
+
+	result := verify()
+	wantMD5 := md5.Sum(data)
+	wantSHA1 := sha1.Sum(data)
+	if !result.MD5.Match() || !result.SHA1.Match() || result.Mismatch() {
+		t.Fatalf("stored hashes do not match: %+v", result)
+	}
+	if !bytes.Equal(result.MD5.Computed, wantMD5[:]) || !bytes.Equal(result.SHA1.Computed, wantSHA1[:]) {
+		t.Fatalf("computed hashes do not match the source data")
+	}
+
+	// alter a byte of the first chunk
+	raw, err := os.ReadFile(ewfPath)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	idx := bytes.Index(raw, data[:64])
+	if idx < 0 {
+		t.Fatalf("chunk data not found in the image")
+	}
+	raw[idx] ^= 0xff
+	if err := os.WriteFile(ewfPath, raw, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	result = verify()
+	if !result.Mismatch() || result.MD5.Match() || result.SHA1.Match() {
+		t.Fatalf("expected a hash mismatch: %+v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+	reader, err := OpenEWF(rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	if _, err := reader.VerifyHashes(ctx, nil); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestEVF1StrictChecksums(t *testing.T) {
+	data := make([]byte, 4*DefaultChunkSize+100)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	dir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(dir, fmt.Sprintf("strict.E%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	// uncompressed chunks carry their checksum as a trailer
+	creator.SetCompressionLevel(None)
+	creator.SetSegmentSize(3*DefaultChunkSize, func(n uint16) (io.WriteSeeker, error) {
+		return os.Create(segmentPath(n))
+	})
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	open := func(strict bool) (*EWFReader, error) {
+		var fhs []io.ReadSeeker
+		for n := uint16(1); ; n++ {
+			fh, err := os.Open(segmentPath(n))
+			if os.IsNotExist(err) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { fh.Close() })
+			fhs = append(fhs, fh)
+		}
+		if len(fhs) < 2 {
+			t.Fatalf("expected multiple segments, got %d", len(fhs))
+		}
+		return OpenEWFWithOptions(shared.OpenOptions{Strict: strict}, fhs...)
+	}
+	corrupt := func(n uint16, off int64) {
+		raw, err := os.ReadFile(segmentPath(n))
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		raw[off] ^= 0xff
+		if err := os.WriteFile(segmentPath(n), raw, 0o644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+
+	reader, err := open(true)
+	if err != nil {
+		t.Fatalf("strict open of a valid image: %v", err)
+	}
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("strict read of a valid image: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	// chunk data of the first chunk in the second segment
+	seg, _, err := reader.Segment(1)
+	if err != nil {
+		t.Fatalf("Segment: %v", err)
+	}
+	table := seg.Tables[0]
+	entry, err := table.getEntry(0)
+	if err != nil {
+		t.Fatalf("getEntry: %v", err)
+	}
+	firstChunk := int64(reader.First.Volume.Data.GetChunkCount()) - int64(seg.chunkCount)
+	tableOffset := table.Section.offset
+	corrupt(2, table.BaseOffset+int64(entry&0x7FFFFFFF)+10)
+
+	reader, err = open(false)
+	if err != nil {
+		t.Fatalf("lenient open: %v", err)
+	}
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("lenient read of a corrupt chunk: %v", err)
+	}
+
+	reader, err = open(true)
+	if err != nil {
+		t.Fatalf("strict open with a corrupt chunk: %v", err)
+	}
+	_, err = io.ReadFull(reader, readAll)
+	var csErr *shared.ChecksumError
+	if !errors.As(err, &csErr) {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+	if csErr.Segment != 2 || csErr.Chunk != firstChunk || csErr.SectionOffset != tableOffset || csErr.Section != "chunk" {
+		t.Fatalf("unexpected checksum error: %+v", csErr)
+	}
+
+	// checksum of the table header, table2 is used instead
+	corrupt(2, table.Section.DataOffset+20)
+	if _, err := open(false); err != nil {
+		t.Fatalf("lenient open with a corrupt table: %v", err)
+	}
+	reader, err = open(true)
+	if err != nil {
+		t.Fatalf("strict open with a corrupt table: %v", err)
+	}
+	fallbacks, err := reader.TableFallbacks()
+	if err != nil {
+		t.Fatalf("TableFallbacks: %v", err)
+	}
+	if len(fallbacks) != 1 || fallbacks[0].Segment != 2 || fallbacks[0].TableOffset != tableOffset {
+		t.Fatalf("unexpected table fallbacks: %v", fallbacks)
+	}
+
+	// checksum of the table2 header as well
+	corrupt(2, table.mirror.Section.DataOffset+20)
+	if _, err := open(false); err != nil {
+		t.Fatalf("lenient open with a corrupt table2: %v", err)
+	}
+	_, err = open(true)
+	if !errors.As(err, &csErr) || csErr.Section != "table header" || csErr.SectionOffset != tableOffset {
+		t.Fatalf("expected a table header checksum error, got %v", err)
+	}
+
+	// checksum of the volume section descriptor
+	var volumeOffset int64 = -1
+	for _, desc := range reader.First.SectionDescriptors {
+		if desc.Type == EWF_SECTION_TYPE_VOLUME {
+			volumeOffset = desc.offset
+		}
+	}
+	corrupt(1, volumeOffset+int64(DescriptorSize)-1)
+	_, err = open(true)
+	if !errors.As(err, &csErr) || csErr.Section != "section descriptor" || csErr.Segment != 1 || csErr.SectionOffset != volumeOffset {
+		t.Fatalf("expected a descriptor checksum error, got %v", err)
+	}
+}
+
+func TestEVF1TableFallback(t *testing.T) {
+	data := make([]byte, 3*DefaultChunkSize+100)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	path := filepath.Join(t.TempDir(), "fallback.E01")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	open := func(strict bool) *EWFReader {
+		fh, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { fh.Close() })
+		reader, err := OpenEWFWithOptions(shared.OpenOptions{Strict: strict}, fh)
+		if err != nil {
+			t.Fatalf("OpenEWF: %v", err)
+		}
+		return reader
+	}
+
+	reader := open(true)
+	fallbacks, err := reader.TableFallbacks()
+	if err != nil {
+		t.Fatalf("TableFallbacks: %v", err)
+	}
+	if len(fallbacks) != 0 {
+		t.Fatalf("unexpected fallbacks for a valid image: %v", fallbacks)
+	}
+
+	// point the second entry of the table beyond the table section
+	table := reader.First.Tables[0]
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	raw := append([]byte(nil), original...)
+	entries := raw[table.Entries.position : table.Entries.position+int64(table.Header.NumEntries)*Uint32Size]
+	binary.LittleEndian.PutUint32(entries[Uint32Size:], 0x7FFFFFFF)
+	// keep the entries checksum valid, only the offset is out of range
+	binary.LittleEndian.PutUint32(raw[table.Entries.position+int64(len(entries)):], adler32.Checksum(entries))
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	// tables are validated without strict mode as well
+	readAll := make([]byte, len(data))
+	for _, strict := range []bool{false, true} {
+		reader = open(strict)
+		fallbacks, err = reader.TableFallbacks()
+		if err != nil {
+			t.Fatalf("TableFallbacks: %v", err)
+		}
+		if len(fallbacks) != 1 || fallbacks[0].Segment != 1 || fallbacks[0].TableOffset != table.Section.offset ||
+			fallbacks[0].Reason == nil || !strings.Contains(fallbacks[0].Reason.Error(), "beyond the table section") {
+			t.Fatalf("unexpected table fallbacks, strict %v: %v", strict, fallbacks)
+		}
+
+		if _, err := io.ReadFull(reader, readAll); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(data, readAll) {
+			t.Fatalf("data mismatch after table2 fallback, strict %v", strict)
+		}
+	}
+
+	// the checksum of the table section descriptor, strict mode falls back to table2
+	raw = append([]byte(nil), original...)
+	raw[table.Section.offset+int64(DescriptorSize)-1] ^= 0xff
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	reader = open(true)
+	fallbacks, err = reader.TableFallbacks()
+	if err != nil {
+		t.Fatalf("TableFallbacks: %v", err)
+	}
+	var csErr *shared.ChecksumError
+	if len(fallbacks) != 1 || fallbacks[0].TableOffset != table.Section.offset ||
+		!errors.As(fallbacks[0].Reason, &csErr) || csErr.Section != "section descriptor" {
+		t.Fatalf("unexpected table fallbacks: %v", fallbacks)
+	}
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after table2 fallback")
+	}
+
+	// a valid table2 that lists other chunks than the valid table
+	if err := os.WriteFile(path, original, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	raw = append([]byte(nil), original...)
+	mirror := table.mirror
+	entries = raw[mirror.Entries.position : mirror.Entries.position+int64(mirror.Header.NumEntries)*Uint32Size]
+	binary.LittleEndian.PutUint32(entries[Uint32Size:], binary.LittleEndian.Uint32(entries)|1<<31)
+	binary.LittleEndian.PutUint32(raw[mirror.Entries.position+int64(len(entries)):], adler32.Checksum(entries))
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	reader = open(true)
+	fallbacks, err = reader.TableFallbacks()
+	if err != nil {
+		t.Fatalf("TableFallbacks: %v", err)
+	}
+	if len(fallbacks) != 1 || !fallbacks[0].Mismatch || fallbacks[0].TableOffset != table.Section.offset ||
+		fallbacks[0].MirrorOffset != mirror.Section.offset {
+		t.Fatalf("unexpected table fallbacks: %v", fallbacks)
+	}
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch, table2 used instead of the table")
+	}
+}
+
+func TestEVF1Errors2SectionRoundTrip(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "errors2.bin"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	errSec := &EWFErrors2Section{Entries: []EWFErrors2SectionEntry{
+		{FirstSector: 100, SectorCount: 8},
+		{FirstSector: 4096, SectorCount: 1},
+	}}
+	if err := errSec.Encode(f); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	section, err := NewEWFSectionDescriptor(f)
+	if err != nil {
+		t.Fatalf("NewEWFSectionDescriptor: %v", err)
+	}
+	if section.Type != EWF_SECTION_TYPE_ERRORS2 {
+		t.Fatalf("unexpected section type %q", section.Type)
+	}
+
+	seg := &EWFSegment{EWFHeader: &EWFHeader{SegmentNumber: 1}, strict: true}
+	decoded := new(EWFErrors2Section)
+	if err := decoded.Decode(f, section, seg); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	ranges, err := decoded.Ranges()
+	if err != nil {
+		t.Fatalf("Ranges: %v", err)
+	}
+	want := []shared.SectorRange{{First: 100, Count: 8}, {First: 4096, Count: 1}}
+	if len(ranges) != len(want) {
+		t.Fatalf("got %d ranges, want %d", len(ranges), len(want))
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Fatalf("range %d: got %+v, want %+v", i, ranges[i], want[i])
+		}
+	}
+
+	// corrupt the first entry, the entries checksum no longer matches
+	if _, err := f.WriteAt([]byte{0xff}, section.DataOffset+int64(binary.Size(EWFErrors2SectionHeader{}))); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var csErr *shared.ChecksumError
+	if err := new(EWFErrors2Section).Decode(f, section, seg); !errors.As(err, &csErr) || csErr.Section != "errors2 entries" {
+		t.Fatalf("expected an errors2 entries checksum error, got %v", err)
+	}
+
+	// lenient mode opens the section but does not report its ranges
+	seg.strict = false
+	damaged := new(EWFErrors2Section)
+	if err := damaged.Decode(f, section, seg); err != nil {
+		t.Fatalf("lenient Decode: %v", err)
+	}
+	if _, err := damaged.Ranges(); !errors.As(err, &csErr) {
+		t.Fatalf("expected a checksum error from Ranges, got %v", err)
+	}
+}
+
+// badSectorReader fails every read that touches one of the bad sectors
+type badSectorReader struct {
+	data       []byte
+	sectorSize int64
+	bad        map[int64]bool
+}
+
+func (r *badSectorReader) ReadAt(p []byte, off int64) (int, error) {
+	for s := off / r.sectorSize; s*r.sectorSize < off+int64(len(p)); s++ {
+		if r.bad[s] {
+			return 0, fmt.Errorf("unreadable sector %d", s)
+		}
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestEVF1WriterAcquireUnreadableSectors(t *testing.T) {
+	data := make([]byte, 3*DefaultChunkSize+700)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	lastSector := int64(len(data)) / DefaultSectorSize
+	src := &badSectorReader{
+		data:       data,
+		sectorSize: DefaultSectorSize,
+		bad:        map[int64]bool{10: true, 11: true, 12: true, 100: true, lastSector: true},
+	}
+
+	// unreadable sectors are stored zero filled
+	expected := append([]byte(nil), data...)
+	for s := range src.bad {
+		start := s * DefaultSectorSize
+		end := shared.MinInt64(start+DefaultSectorSize, int64(len(expected)))
+		copy(expected[start:end], make([]byte, end-start))
+	}
+
+	path := filepath.Join(t.TempDir(), "acquire.E01")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := w.Acquire(context.Background(), src, int64(len(data)), nil); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	want := []shared.SectorRange{{First: 10, Count: 3}, {First: 100, Count: 1}, {First: uint64(lastSector), Count: 1}}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer fh.Close()
+	reader, err := OpenEWFWithOptions(shared.OpenOptions{Strict: true}, fh)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	ranges, err := reader.Errors()
+	if err != nil {
+		t.Fatalf("Errors: %v", err)
+	}
+	if len(ranges) != len(want) {
+		t.Fatalf("got ranges %+v, want %+v", ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Fatalf("got ranges %+v, want %+v", ranges, want)
+		}
+	}
+
+	if reader.Size() != int64(len(data)) {
+		t.Fatalf("size mismatch: got %d, want %d", reader.Size(), len(data))
+	}
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(expected, readAll) {
+		t.Fatalf("data mismatch, unreadable sectors are not zero filled")
+	}
+
+	// stored hashes cover the zero filled data
+	result, err := reader.VerifyHashes(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("VerifyHashes: %v", err)
+	}
+	md5Sum := md5.Sum(expected)
+	if result.Mismatch() || !bytes.Equal(result.MD5.Stored, md5Sum[:]) {
+		t.Fatalf("unexpected hash verification: %+v", result)
+	}
+
+	// reads touching the unreadable sectors fail when asked to
+	if _, err := fh.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	reader, err = OpenEWFWithOptions(shared.OpenOptions{UnreadableSectorErrors: true}, fh)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	buf := make([]byte, 8*DefaultSectorSize)
+	n, err := reader.ReadAt(buf, 5*DefaultSectorSize)
+	var usErr *shared.UnreadableSectorError
+	if !errors.Is(err, shared.ErrUnreadableSector) || !errors.As(err, &usErr) || usErr.Range != want[0] {
+		t.Fatalf("expected an unreadable sector error, got %v", err)
+	}
+	if n != 5*DefaultSectorSize || !bytes.Equal(buf[:n], data[5*DefaultSectorSize:10*DefaultSectorSize]) {
+		t.Fatalf("read %d bytes before the unreadable sectors, want %d", n, 5*DefaultSectorSize)
+	}
+	if n, err := reader.ReadAt(buf, lastSector*DefaultSectorSize); n != 0 || !errors.Is(err, shared.ErrUnreadableSector) {
+		t.Fatalf("expected an unreadable sector error at the last sector, got %d, %v", n, err)
+	}
+	result, err = reader.VerifyHashes(context.Background(), nil)
+	if err != nil || result.Mismatch() {
+		t.Fatalf("VerifyHashes with unreadable sector errors: %+v, %v", result, err)
+	}
+}
+
+func TestEVF1WriterUnreadableNeedsSectorBoundary(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "boundary.E01"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := w.Write(make([]byte, 100)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.WriteUnreadable(DefaultSectorSize); err == nil {
+		t.Fatalf("expected an error for unreadable data off a sector boundary")
+	}
+
+	// unreadable data that ends within a sector ends the media
+	if _, err := w.Write(make([]byte, DefaultSectorSize-100)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.WriteUnreadable(100); err != nil {
+		t.Fatalf("WriteUnreadable: %v", err)
+	}
+	if _, err := w.Write(make([]byte, 10)); err == nil {
+		t.Fatalf("expected an error for data after a partial unreadable sector")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if want := []shared.SectorRange{{First: 1, Count: 1}}; len(w.Errors()) != 1 || w.Errors()[0] != want[0] {
+		t.Fatalf("got ranges %+v, want %+v", w.Errors(), want)
+	}
+}
+
+// closedReader fails every read as a closed file does
+type closedReader struct{}
+
+func (closedReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: "source", Err: fs.ErrClosed}
+}
+
+func TestEVF1WriterAcquireSourceErrors(t *testing.T) {
+	data := make([]byte, 2*DefaultChunkSize)
+	rand.New(rand.NewSource(5)).Read(data)
+
+	cases := []struct {
+		name string
+		src  io.ReaderAt
+		size int64
+	}{
+		{"short source", bytes.NewReader(data), int64(len(data)) + DefaultSectorSize},
+		{"closed source", closedReader{}, int64(len(data))},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "source.E01"))
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			defer f.Close()
+
+			creator, err := CreateEWF(f)
+			if err != nil {
+				t.Fatalf("CreateEWF: %v", err)
+			}
+			w, err := creator.Start()
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			if err := w.Acquire(context.Background(), tc.src, tc.size, nil); err == nil {
+				t.Fatalf("expected an acquisition error")
+			}
+			if ranges := w.Errors(); len(ranges) != 0 {
+				t.Fatalf("source errors recorded as unreadable sectors: %+v", ranges)
+			}
+		})
+	}
+}
+
+func TestEVF1WriterSessions(t *testing.T) {
+	const bytesPerSector, sectorsPerChunk = 2048, 16
+	data := make([]byte, 100*bytesPerSector)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "cd.E01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSectorGeometry(bytesPerSector, sectorsPerChunk)
+	creator.SetMediaType(Optical)
+	creator.SetSessions([]shared.Session{
+		{Range: shared.SectorRange{First: 0}, Flags: shared.SessionFlagAudioTrack},
+		{Range: shared.SectorRange{First: 40}},
+	})
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWFWithOptions(shared.OpenOptions{Strict: true}, rf)
+	if err != nil {
+		t.Fatalf("OpenEWFWithOptions: %v", err)
+	}
+	if got := reader.First.Data.MediaType; got != uint8(Optical) {
+		t.Fatalf("data media type: got 0x%02x", got)
+	}
+	if vol, ok := reader.First.Volume.Data.(*EWFVolumeSectionData); !ok || vol.MediaType != Optical {
+		t.Fatalf("volume media type is not optical")
+	}
+
+	sessions, err := reader.Sessions()
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	want := []shared.Session{
+		{Range: shared.SectorRange{First: 0, Count: 40}, Flags: shared.SessionFlagAudioTrack},
+		{Range: shared.SectorRange{First: 40, Count: 60}},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("got %d sessions, want %d", len(sessions), len(want))
+	}
+	for i := range want {
+		if sessions[i] != want[i] {
+			t.Fatalf("session %d: got %+v, want %+v", i, sessions[i], want[i])
+		}
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	bad, err := os.Create(filepath.Join(t.TempDir(), "fixed.E01"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer bad.Close()
+
+	creator, err = CreateEWF(bad)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSessions([]shared.Session{{Range: shared.SectorRange{First: 0}}})
+	if _, err := creator.Start(); err == nil {
+		t.Fatalf("expected Start to fail with sessions for fixed media")
+	}
+}
+
+// writeLogicalFixture writes media as an L01 with the given single files text
+func writeLogicalFixture(t *testing.T, ewfPath string, media []byte, singleFiles string) {
+	t.Helper()
+
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetMediaType(Logical)
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := w.Write(media); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// the ltree section takes the place of the done section
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	reader, err := OpenEWF(f)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	descs := reader.First.SectionDescriptors
+	done := descs[len(descs)-1]
+	if done.Type != EWF_SECTION_TYPE_DONE {
+		t.Fatalf("last section is %q", done.Type)
+	}
+	if _, err := f.Seek(done.offset, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	u16 := shared.UTF8ToUTF16([]byte(singleFiles))[2:]
+	if err := (&EWFLtreeSection{Data: u16}).Encode(f); err != nil {
+		t.Fatalf("ltree Encode: %v", err)
+	}
+	if err := new(EWFDoneSection).Encode(f); err != nil {
+		t.Fatalf("done Encode: %v", err)
+	}
+
+	if _, err := f.WriteAt([]byte(LVFSignature), 0); err != nil {
+		t.Fatalf("write signature: %v", err)
+	}
+}
+
+// checkLogicalFiles checks that logical holds the files with their data and modification time.
+// The Sys of a file is the *shared.LogicalEntry whose hashes and other times it is expected to
+// be recorded with, stored hashes have to match the data of files without one.
+func checkLogicalFiles(t *testing.T, logical *LogicalReader, files fstest.MapFS) {
+	t.Helper()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	if err := fstest.TestFS(logical, names...); err != nil {
+		t.Fatalf("TestFS: %v", err)
+	}
+
+	for name, file := range files {
+		got, err := fs.ReadFile(logical, name)
+		if err != nil {
+			t.Fatalf("ReadFile %s: %v", name, err)
+		}
+		if !bytes.Equal(got, file.Data) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+
+		entry, err := logical.Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup %s: %v", name, err)
+		}
+		if entry.IsDir || entry.Size != int64(len(file.Data)) {
+			t.Fatalf("%s: unexpected entry %+v", name, entry)
+		}
+		if !entry.ModTime.Equal(file.ModTime) {
+			t.Fatalf("%s: mod time %v, want %v", name, entry.ModTime, file.ModTime)
+		}
+
+		want, ok := file.Sys.(*shared.LogicalEntry)
+		if !ok {
+			if md5Hash := fmt.Sprintf("%x", md5.Sum(file.Data)); entry.MD5 != "" && entry.MD5 != md5Hash {
+				t.Fatalf("%s: MD5 %q, want %q", name, entry.MD5, md5Hash)
+			}
+			if sha1Hash := fmt.Sprintf("%x", sha1.Sum(file.Data)); entry.SHA1 != "" && entry.SHA1 != sha1Hash {
+				t.Fatalf("%s: SHA1 %q, want %q", name, entry.SHA1, sha1Hash)
+			}
+			continue
+		}
+		if entry.MD5 != want.MD5 || entry.SHA1 != want.SHA1 {
+			t.Fatalf("%s: hashes %q %q, want %q %q", name, entry.MD5, entry.SHA1, want.MD5, want.SHA1)
+		}
+		if !entry.CreationTime.Equal(want.CreationTime) || !entry.AccessTime.Equal(want.AccessTime) ||
+			!entry.ChangeTime.Equal(want.ChangeTime) {
+			t.Fatalf("%s: creation, access and change time %v %v %v, want %v %v %v", name,
+				entry.CreationTime, entry.AccessTime, entry.ChangeTime, want.CreationTime, want.AccessTime, want.ChangeTime)
+		}
+	}
+}
+
+func TestEVF1LogicalReader(t *testing.T) {
+	readme := []byte("hello world\n")
+	notes := []byte("some notes, 24 bytes\x00\x01\x02\x03")
+	media := append(append([]byte(nil), readme...), notes...)
+
+	readmeMD5 := md5.Sum(readme)
+	types := "p\tn\tid\topr\tsrc\tsub\tcid\tls\tbe\tlo\tpo\tha\tmo\tcr\twr\tac\tdl"
+	singleFiles := strings.Join([]string{
+		"5",
+		"rec",
+		"tb\tcl",
+		fmt.Sprintf("%d\t1", len(media)),
+		"",
+		"entry",
+		"4\t1",
+		types,
+		"0\t2",
+		"1\t\t1\t0\t1\t0\t0\t0\t\t\t\t\t0\t0\t0\t0\t0",
+		"0\t1",
+		"1\tdocs\t2\t0\t1\t0\t0\t0\t\t\t\t\t1600000000\t1500000000\t1600000000\t1650000000\t0",
+		"0\t0",
+		fmt.Sprintf("0\treadme.txt\t3\t0\t1\t0\t0\t%d\t1 0 %x\t\t\t%x\t1600000100\t1500000100\t1600000200\t1650000100\t0", len(readme), len(readme), readmeMD5),
+		"0\t0",
+		fmt.Sprintf("0\tnotes.bin\t4\t0\t1\t0\t0\t%d\t1 %x %x\t\t\t\t0\t0\t1600000300\t0\t0", len(notes), len(readme), len(notes)),
+		"",
+	}, "\n")
+
+	ewfPath := filepath.Join(t.TempDir(), "files.L01")
+	writeLogicalFixture(t, ewfPath, media, singleFiles)
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	logical, err := OpenLogicalWithOptions(shared.OpenOptions{Strict: true}, rf)
+	if err != nil {
+		t.Fatalf("OpenLogicalWithOptions: %v", err)
+	}
+
+	checkLogicalFiles(t, logical, fstest.MapFS{
+		"docs/readme.txt": {Data: readme, ModTime: time.Unix(1600000200, 0), Sys: &shared.LogicalEntry{
+			MD5:          fmt.Sprintf("%x", readmeMD5),
+			CreationTime: time.Unix(1500000100, 0),
+			AccessTime:   time.Unix(1650000100, 0),
+			ChangeTime:   time.Unix(1600000100, 0),
+		}},
+		"notes.bin": {Data: notes, ModTime: time.Unix(1600000300, 0), Sys: &shared.LogicalEntry{}},
+	})
+
+	var walked []string
+	err = fs.WalkDir(logical, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkDir: %v", err)
+	}
+	if want := ".,docs,docs/readme.txt,notes.bin"; strings.Join(walked, ",") != want {
+		t.Fatalf("walked %v, want %s", walked, want)
+	}
+
+	info, err := fs.Stat(logical, "docs")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if !info.IsDir() || !info.ModTime().Equal(time.Unix(1600000000, 0)) {
+		t.Fatalf("unexpected docs info: dir %v, mod time %v", info.IsDir(), info.ModTime())
+	}
+
+	if _, err := fs.Stat(logical, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	// disk images are not logical evidence
+	diskPath := filepath.Join(t.TempDir(), "disk.E01")
+	df, err := os.Create(diskPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer df.Close()
+	creator, err := CreateEWF(df)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := w.Write(media); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := df.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	if _, err := OpenLogical(df); !errors.Is(err, ErrNotLogical) {
+		t.Fatalf("expected ErrNotLogical, got %v", err)
+	}
+}
+
+func TestEVF1LogicalWriter(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+	big := make([]byte, 2*DefaultChunkSize+17)
+	rand.New(rand.NewSource(5)).Read(big)
+
+	files := fstest.MapFS{
+		"a.txt":            {Data: []byte("first file\n"), ModTime: modTime},
+		"sub/b.bin":        {Data: big, ModTime: modTime.Add(time.Hour)},
+		"sub/empty":        {ModTime: modTime},
+		"sub/deeper/c.txt": {Data: []byte("nested"), ModTime: modTime},
+	}
+	// the times of files read from logical evidence are kept
+	for _, file := range files {
+		file.Sys = &shared.LogicalEntry{
+			MD5:  fmt.Sprintf("%x", md5.Sum(file.Data)),
+			SHA1: fmt.Sprintf("%x", sha1.Sum(file.Data)),
+		}
+	}
+	a := files["a.txt"].Sys.(*shared.LogicalEntry)
+	a.CreationTime, a.AccessTime, a.ChangeTime = modTime.Add(-time.Hour), modTime.Add(time.Minute), modTime.Add(time.Second)
+
+	collected := t.TempDir()
+	xPath := filepath.Join(collected, "x.txt")
+	if err := os.WriteFile(xPath, []byte("from a directory"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	xAccessTime := modTime.Add(2 * time.Hour)
+	if err := os.Chtimes(xPath, xAccessTime, modTime); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(tmpDir, fmt.Sprintf("files.L%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateLogical(f)
+	if err != nil {
+		t.Fatalf("CreateLogical: %v", err)
+	}
+	creator.SetCompressionLevel(None)
+	creator.SetSegmentSize(48*1024, func(segmentNumber uint16) (io.WriteSeeker, error) {
+		return os.Create(segmentPath(segmentNumber))
+	})
+
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if err := w.AddFS(files); err != nil {
+		t.Fatalf("AddFS: %v", err)
+	}
+	if err := w.AddDirectory(collected); err != nil {
+		t.Fatalf("AddDirectory: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(tmpDir, "files.L*"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(paths) < 2 {
+		t.Fatalf("expected the files to span segments, got %d", len(paths))
+	}
+
+	fhs := make([]io.ReadSeeker, 0, len(paths))
+	for _, p := range paths {
+		rf, err := os.Open(p)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer rf.Close()
+		fhs = append(fhs, rf)
+	}
+
+	logical, err := OpenLogicalWithOptions(shared.OpenOptions{Strict: true}, fhs...)
+	if err != nil {
+		t.Fatalf("OpenLogicalWithOptions: %v", err)
+	}
+
+	checkLogicalFiles(t, logical, files)
+
+	// the creation, access and change time of files of the operating system are taken from stat
+	dirName := filepath.Base(collected)
+	checkLogicalFiles(t, logical, fstest.MapFS{
+		dirName + "/x.txt": {Data: []byte("from a directory"), ModTime: modTime},
+	})
+	entry, err := logical.Lookup(dirName + "/x.txt")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	switch runtime.GOOS {
+	case "linux", "darwin", "windows":
+		if !entry.AccessTime.Equal(xAccessTime) {
+			t.Fatalf("x.txt: access time %v, want %v", entry.AccessTime, xAccessTime)
+		}
+	}
+
+	// the media holds the data of all files
+	total := int64(len("from a directory"))
+	for _, file := range files {
+		total += int64(len(file.Data))
+	}
+	if size := logical.EWF.Size(); size != total {
+		t.Fatalf("media size %d", size)
+	}
+
+	disk, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	if err := disk.ewfWriter.AddFS(files); err == nil {
+		t.Fatalf("expected AddFS to fail for a disk image")
+	}
+}
+
+func TestEVF1ChunkCache(t *testing.T) {
+	data := make([]byte, 4*DefaultChunkSize)
+	rand.New(rand.NewSource(19)).Read(data)
+
+	ewfPath := filepath.Join(t.TempDir(), "cache.E01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	defer f.Close()
+
+	reader, err := OpenEWFWithOptions(shared.OpenOptions{ChunkCacheSize: 2}, f)
+	if err != nil {
+		t.Fatalf("OpenEWFWithOptions: %v", err)
+	}
+	// opening reads the last chunk to find the media size
+	base := reader.ChunkCacheStats()
+
+	readAt := func(off int64, size int) {
+		t.Helper()
+		buf := make([]byte, size)
+		if _, err := reader.ReadAt(buf, off); err != nil {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(buf, data[off:off+int64(size)]) {
+			t.Fatalf("data mismatch at %d", off)
+		}
+	}
+	stats := func() shared.ChunkCacheStats {
+		s := reader.ChunkCacheStats()
+		return shared.ChunkCacheStats{Hits: s.Hits - base.Hits, Misses: s.Misses - base.Misses}
+	}
+
+	// small reads of one chunk decompress it once
+	for off := int64(0); off < DefaultChunkSize; off += 512 {
+		readAt(off, 512)
+	}
+	if got, want := stats(), (shared.ChunkCacheStats{Hits: DefaultChunkSize/512 - 1, Misses: 1}); got != want {
+		t.Fatalf("stats after reading chunk 0: %+v, want %+v", got, want)
+	}
+
+	// chunks 1 and 2 evict chunk 0, chunk 2 stays cached
+	readAt(DefaultChunkSize, 512)
+	readAt(2*DefaultChunkSize, 512)
+	readAt(0, 512)
+	readAt(2*DefaultChunkSize+512, 512)
+	if got, want := stats(), (shared.ChunkCacheStats{Hits: DefaultChunkSize / 512, Misses: 4}); got != want {
+		t.Fatalf("stats after eviction: %+v, want %+v", got, want)
+	}
+
+	// a read across a chunk boundary finds chunk 0 and reads chunk 1
+	readAt(DefaultChunkSize-256, 512)
+	if got, want := stats(), (shared.ChunkCacheStats{Hits: DefaultChunkSize/512 + 1, Misses: 5}); got != want {
+		t.Fatalf("stats after boundary read: %+v, want %+v", got, want)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	uncached, err := OpenEWF(f)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	buf := make([]byte, 512)
+	if _, err := uncached.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if s := uncached.ChunkCacheStats(); s != (shared.ChunkCacheStats{}) {
+		t.Fatalf("reader without a cache counted %+v", s)
+	}
+}
+
+// onlyReadSeeker hides the io.ReaderAt of a file
+type onlyReadSeeker struct {
+	io.ReadSeeker
+}
+
+func TestEVF1ConcurrentReadAt(t *testing.T) {
+	data := make([]byte, 12*DefaultChunkSize)
+	rand.New(rand.NewSource(20)).Read(data)
+
+	dir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(dir, fmt.Sprintf("concurrent.E%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSegmentSize(4*DefaultChunkSize, func(n uint16) (io.WriteSeeker, error) {
+		return os.Create(segmentPath(n))
+	})
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "concurrent.E*"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("expected at least 3 segments, got %d", len(paths))
+	}
+
+	open := func(opts shared.OpenOptions, wrap bool) *EWFReader {
+		fhs := make([]io.ReadSeeker, 0, len(paths))
+		for _, p := range paths {
+			rf, err := os.Open(p)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { rf.Close() })
+			if wrap {
+				fhs = append(fhs, onlyReadSeeker{rf})
+			} else {
+				fhs = append(fhs, rf)
+			}
+		}
+		reader, err := OpenEWFWithOptions(opts, fhs...)
+		if err != nil {
+			t.Fatalf("OpenEWFWithOptions: %v", err)
+		}
+		return reader
+	}
+
+	tests := []struct {
+		name   string
+		reader *EWFReader
+	}{
+		{"ReaderAt", open(shared.OpenOptions{}, false)},
+		{"ReadSeeker", open(shared.OpenOptions{}, true)},
+		{"ChunkCache", open(shared.OpenOptions{ChunkCacheSize: 3}, false)},
+		{"Strict", open(shared.OpenOptions{Strict: true}, false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// segments after the first are decoded by the first reads touching them
+			var wg sync.WaitGroup
+			errs := make(chan error, 16)
+			for g := 0; g < 16; g++ {
+				wg.Add(1)
+				go func(seed int64) {
+					defer wg.Done()
+					rnd := rand.New(rand.NewSource(seed))
+					buf := make([]byte, 2*DefaultChunkSize)
+					for i := 0; i < 20; i++ {
+						off := rnd.Int63n(int64(len(data)))
+						size := 1 + rnd.Intn(len(buf))
+						n, err := tt.reader.ReadAt(buf[:size], off)
+						if err != nil && err != io.EOF {
+							errs <- fmt.Errorf("ReadAt(%d, %d): %w", off, size, err)
+							return
+						}
+						if !bytes.Equal(buf[:n], data[off:off+int64(n)]) {
+							errs <- fmt.Errorf("ReadAt(%d, %d): data mismatch", off, size)
+							return
+						}
+						if n < size && off+int64(n) != int64(len(data)) {
+							errs <- fmt.Errorf("ReadAt(%d, %d): short read of %d bytes", off, size, n)
+							return
+						}
+					}
+				}(int64(g))
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEVF1OpenEWFFileAndReaderAt(t *testing.T) {
+	data := make([]byte, 10*DefaultChunkSize+300)
+	rand.New(rand.NewSource(21)).Read(data)
+
+	dir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(dir, fmt.Sprintf("image.E%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSegmentSize(4*DefaultChunkSize, func(n uint16) (io.WriteSeeker, error) {
+		return os.Create(segmentPath(n))
+	})
+	w, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+	// not a segment of the set
+	if err := os.WriteFile(filepath.Join(dir, "image.raw"), data, 0o644); err != nil {
+		t.Fatalf("write raw: %v", err)
+	}
+
+	paths, err := shared.SegmentPaths(segmentPath(1))
+	if err != nil {
+		t.Fatalf("SegmentPaths: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("expected at least 3 segments, got %v", paths)
+	}
+
+	verify := func(reader *EWFReader) {
+		t.Helper()
+		if reader.SegmentCount() != len(paths) {
+			t.Fatalf("SegmentCount = %d, want %d", reader.SegmentCount(), len(paths))
+		}
+		got := make([]byte, len(data))
+		if _, err := reader.ReadAt(got, 0); err != nil && err != io.EOF {
+			t.Fatalf("ReadAt: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("data mismatch")
+		}
+	}
+
+	reader, err := OpenEWFFile(segmentPath(1), shared.OpenOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("OpenEWFFile: %v", err)
+	}
+	verify(reader)
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := reader.ReadAt(make([]byte, 16), 0); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("ReadAt after Close: %v, want os.ErrClosed", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if _, err := OpenEWFFile(filepath.Join(dir, "missing.E01"), shared.OpenOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("OpenEWFFile of a missing file: %v", err)
+	}
+
+	segments := make([]shared.SegmentReaderAt, 0, len(paths))
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("read segment: %v", err)
+		}
+		segments = append(segments, shared.SegmentReaderAt{ReaderAt: bytes.NewReader(b), Size: int64(len(b))})
+	}
+	reader, err = OpenEWFReaderAt(shared.OpenOptions{}, segments...)
+	if err != nil {
+		t.Fatalf("OpenEWFReaderAt: %v", err)
+	}
+	verify(reader)
+}
+
+func TestEVF1SegmentSetValidation(t *testing.T) {
+	data := make([]byte, 10*DefaultChunkSize)
+	rand.New(rand.NewSource(24)).Read(data)
+	dir := t.TempDir()
+
+	// two acquisitions of the same data, split the same way
+	acquire := func(name string) []string {
+		segmentPath := func(n uint16) string {
+			return filepath.Join(dir, fmt.Sprintf("%s.E%02d", name, n))
+		}
+		f, err := os.Create(segmentPath(1))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		creator, err := CreateEWF(f)
+		if err != nil {
+			t.Fatalf("CreateEWF: %v", err)
+		}
+		creator.SetSegmentSize(3*DefaultChunkSize, func(n uint16) (io.WriteSeeker, error) {
+			return os.Create(segmentPath(n))
+		})
+		w, err := creator.Start()
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("file close: %v", err)
+		}
+
+		paths, err := shared.SegmentPaths(segmentPath(1))
+		if err != nil {
+			t.Fatalf("SegmentPaths: %v", err)
+		}
+		if len(paths) < 4 {
+			t.Fatalf("expected at least 4 segments, got %d", len(paths))
+		}
+		return paths
+	}
+	first := acquire("first")
+	second := acquire("second")
+
+	open := func(paths ...string) (*EWFReader, error) {
+		fhs := make([]io.ReadSeeker, 0, len(paths))
+		for _, p := range paths {
+			rf, err := os.Open(p)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { rf.Close() })
+			fhs = append(fhs, rf)
+		}
+		return OpenEWF(fhs...)
+	}
+
+	reader, err := open(first...)
+	if err != nil {
+		t.Fatalf("OpenEWF of the complete set: %v", err)
+	}
+	got := make([]byte, len(data))
+	if _, err := reader.ReadAt(got, 0); err != nil && err != io.EOF {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("data mismatch")
+	}
+
+	last := uint16(len(first))
+	tests := []struct {
+		name  string
+		paths []string
+		want  shared.SegmentSetError
+	}{
+		{"missing", append([]string{first[0], first[1]}, first[3:]...), shared.SegmentSetError{Missing: []uint16{3}}},
+		{"missing first", first[1:], shared.SegmentSetError{Missing: []uint16{1}}},
+		{"missing last", first[:last-1], shared.SegmentSetError{Missing: []uint16{last}}},
+		{"duplicate", append([]string{first[0], first[1]}, first[1:]...), shared.SegmentSetError{Duplicate: []uint16{2}}},
+		{"foreign", append([]string{first[0], first[1], second[2]}, first[3:]...), shared.SegmentSetError{Foreign: []uint16{3}}},
+		{"foreign and missing", append([]string{first[0], second[1]}, first[3:]...), shared.SegmentSetError{Missing: []uint16{3}, Foreign: []uint16{2}}},
+	}
+	for _, tt := range tests {
+		_, err := open(tt.paths...)
+		var setErr *shared.SegmentSetError
+		if !errors.As(err, &setErr) {
+			t.Fatalf("%s: got %v, want a *shared.SegmentSetError", tt.name, err)
+		}
+		if fmt.Sprint(*setErr) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *setErr, tt.want)
+		}
+	}
+
+	// the files that follow a gap are still found by name
+	for _, tt := range []struct {
+		name   string
+		remove string
+		first  string
+		want   shared.SegmentSetError
+	}{
+		{"missing file", first[2], first[0], shared.SegmentSetError{Missing: []uint16{3}}},
+		{"missing last file", second[last-1], second[0], shared.SegmentSetError{Missing: []uint16{last}}},
+	} {
+		if err := os.Remove(tt.remove); err != nil {
+			t.Fatalf("remove: %v", err)
+		}
+		_, err := OpenEWFFile(tt.first, shared.OpenOptions{})
+		var setErr *shared.SegmentSetError
+		if !errors.As(err, &setErr) {
+			t.Fatalf("%s: got %v, want a *shared.SegmentSetError", tt.name, err)
+		}
+		if fmt.Sprint(*setErr) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *setErr, tt.want)
+		}
+	}
+}
+
+func TestEVF1RecoverInterruptedImage(t *testing.T) {
+	// compressible chunks followed by random ones
+	// the last chunk is short and does not end on a sector boundary
+	const tail = 1000
+	data := make([]byte, 10*DefaultChunkSize+tail)
+	for i := 0; i < 5*DefaultChunkSize; i++ {
+		data[i] = byte(i / 512)
+	}
+	rand.New(rand.NewSource(25)).Read(data[5*DefaultChunkSize:])
+
+	// acquire writes the data, the acquisition stops before Close unless complete is set
+	acquire := func(t *testing.T, dir string, level CompressionLevel, segmentSize int64, complete bool) []string {
+		segmentPath := func(n uint16) string {
+			return filepath.Join(dir, fmt.Sprintf("image.E%02d", n))
+		}
+		var files []*os.File
+		t.Cleanup(func() {
+			for _, f := range files {
+				f.Close()
+			}
+		})
+		create := func(n uint16) (*os.File, error) {
+			f, err := os.Create(segmentPath(n))
+			if err == nil {
+				files = append(files, f)
+			}
+			return f, err
+		}
+
+		f, err := create(1)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		creator, err := CreateEWF(f)
+		if err != nil {
+			t.Fatalf("CreateEWF: %v", err)
+		}
+		creator.SetCompressionLevel(level)
+		if segmentSize > 0 {
+			creator.SetSegmentSize(segmentSize, func(n uint16) (io.WriteSeeker, error) {
+				return create(n)
+			})
+		}
+		w, err := creator.Start()
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if complete {
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+		}
+
+		paths, err := shared.SegmentPaths(segmentPath(1))
+		if err != nil {
+			t.Fatalf("SegmentPaths: %v", err)
+		}
+		return paths
+	}
+
+	open := func(t *testing.T, paths []string, opts shared.OpenOptions) (*EWFReader, error) {
+		files, err := shared.OpenSegmentFiles(paths[0])
+		if err != nil {
+			t.Fatalf("OpenSegmentFiles: %v", err)
+		}
+		t.Cleanup(func() { shared.CloseFiles(files) })
+		fhs := make([]io.ReadSeeker, len(files))
+		for i, f := range files {
+			fhs[i] = f
+		}
+		return OpenEWFWithOptions(opts, fhs...)
+	}
+
+	checkRecovered := func(t *testing.T, reader *EWFReader, size int64) {
+		t.Helper()
+		if reader.Size() != size {
+			t.Fatalf("size %d, want %d", reader.Size(), size)
+		}
+		if got := reader.Recovery().Size; got != size {
+			t.Fatalf("recovered size %d, want %d", got, size)
+		}
+		got := make([]byte, size)
+		if _, err := reader.ReadAt(got, 0); err != nil && err != io.EOF {
+			t.Fatalf("ReadAt: %v", err)
+		}
+		if !bytes.Equal(got, data[:size]) {
+			t.Fatalf("recovered data mismatch")
+		}
+		if _, err := reader.ReadAt(make([]byte, 1), size); err != io.EOF {
+			t.Fatalf("read beyond the recovered data: %v, want EOF", err)
+		}
+	}
+
+	for _, level := range []CompressionLevel{Best, None} {
+		t.Run(fmt.Sprintf("level %d", level), func(t *testing.T) {
+			t.Run("interrupted", func(t *testing.T) {
+				paths := acquire(t, t.TempDir(), level, 0, false)
+
+				if _, err := open(t, paths, shared.OpenOptions{}); err == nil {
+					t.Fatalf("interrupted image opened without recovery")
+				}
+				reader, err := open(t, paths, shared.OpenOptions{Recover: true})
+				if err != nil {
+					t.Fatalf("open in recovery mode: %v", err)
+				}
+				// the writer holds the short last chunk until Close
+				checkRecovered(t, reader, int64(len(data)-tail))
+
+				recovery := reader.Recovery()
+				if recovery.RecordedSize != 0 || fmt.Sprint(recovery.Segments) != "[1]" || !recovery.Truncated() {
+					t.Fatalf("recovery %+v, want segment 1 scanned without a recorded size", recovery)
+				}
+			})
+
+			t.Run("truncated chunk", func(t *testing.T) {
+				paths := acquire(t, t.TempDir(), level, 0, false)
+				info, err := os.Stat(paths[0])
+				if err != nil {
+					t.Fatalf("stat: %v", err)
+				}
+				// the last chunk is cut short
+				if err := os.Truncate(paths[0], info.Size()-100); err != nil {
+					t.Fatalf("truncate: %v", err)
+				}
+
+				reader, err := open(t, paths, shared.OpenOptions{Recover: true})
+				if err != nil {
+					t.Fatalf("open in recovery mode: %v", err)
+				}
+				checkRecovered(t, reader, int64(len(data)-tail-DefaultChunkSize))
+			})
+
+			t.Run("segments", func(t *testing.T) {
+				paths := acquire(t, t.TempDir(), level, 3*DefaultChunkSize, false)
+				if len(paths) < 3 {
+					t.Fatalf("expected at least 3 segments, got %d", len(paths))
+				}
+
+				reader, err := open(t, paths, shared.OpenOptions{Recover: true, Strict: true})
+				if err != nil {
+					t.Fatalf("open in recovery mode: %v", err)
+				}
+				checkRecovered(t, reader, int64(len(data)-tail))
+				if got, want := fmt.Sprint(reader.Recovery().Segments), fmt.Sprintf("[%d]", len(paths)); got != want {
+					t.Fatalf("scanned segments %s, want %s", got, want)
+				}
+			})
+
+			t.Run("complete", func(t *testing.T) {
+				paths := acquire(t, t.TempDir(), level, 3*DefaultChunkSize, true)
+
+				reader, err := open(t, paths, shared.OpenOptions{Recover: true})
+				if err != nil {
+					t.Fatalf("open in recovery mode: %v", err)
+				}
+				checkRecovered(t, reader, int64(len(data)))
+				if recovery := reader.Recovery(); recovery.Truncated() || recovery.RecordedSize != int64(len(data)) {
+					t.Fatalf("recovery %+v of a complete image", recovery)
+				}
+			})
+		})
+	}
+}
@@ -13,9 +13,11 @@ var (
 )
 
 const (
-	DefaultChunkSize = 32768
-	ChecksumSize     = 4
-	Uint32Size       = 4
+	DefaultSectorSize      = 512
+	DefaultSectorsPerChunk = 64
+	DefaultChunkSize       = DefaultSectorSize * DefaultSectorsPerChunk
+	ChecksumSize           = 4
+	Uint32Size             = 4
 )
 
 const defaultMaxTableLength uint32 = 16375
@@ -43,6 +45,7 @@ const (
 	EWF_SECTION_TYPE_FINAL_INFORMATION    EWFSectionType = 14
 	EWF_SECTION_TYPE_DONE                 EWFSectionType = 15
 	EWF_SECTION_TYPE_ANALYTICAL_DATA      EWFSectionType = 16
+	EWF_SECTION_TYPE_SINGLE_FILES_DATA    EWFSectionType = 32
 )
 
 // String implements the Stringer interface for EWFSectionType
@@ -80,6 +83,8 @@ func (t EWFSectionType) String() string {
 		return "done"
 	case EWF_SECTION_TYPE_ANALYTICAL_DATA:
 		return "analytical_data"
+	case EWF_SECTION_TYPE_SINGLE_FILES_DATA:
+		return "single_files_data"
 	default:
 		return "unknown"
 	}
@@ -26,6 +26,10 @@ const (
 	EWF_DEVICE_INFO_NUMBER_OF_SMART_LOGS EWFDeviceInformationKey = "ls"
 	EWF_DEVICE_INFO_BYTES_PER_SEC        EWFDeviceInformationKey = "bp"
 	EWF_DEVICE_INFO_IS_PHYSICAL          EWFDeviceInformationKey = "ph"
+	// EWF_DEVICE_INFO_MEDIA_SIZE is the number of bytes of media that is not a whole number of
+	// sectors. It is written by this package only, other readers ignore it and see the last
+	// sector filled up with zeros.
+	EWF_DEVICE_INFO_MEDIA_SIZE EWFDeviceInformationKey = "ms"
 )
 
 var DeviceInformationIdentifiers = map[EWFDeviceInformationKey]string{
@@ -41,8 +45,18 @@ var DeviceInformationIdentifiers = map[EWFDeviceInformationKey]string{
 	EWF_DEVICE_INFO_NUMBER_OF_SMART_LOGS: "SMART or ATA logs",
 	EWF_DEVICE_INFO_BYTES_PER_SEC:        "Bytes per Sector",
 	EWF_DEVICE_INFO_IS_PHYSICAL:          "Is physical",
+	EWF_DEVICE_INFO_MEDIA_SIZE:           "Media size",
 }
 
+// Values of EWF_DEVICE_INFO_DRIVE_TYPE
+const (
+	EWF_DRIVE_TYPE_FIXED     = "f"
+	EWF_DRIVE_TYPE_REMOVABLE = "r"
+	EWF_DRIVE_TYPE_OPTICAL   = "c"
+	EWF_DRIVE_TYPE_MEMORY    = "m"
+	EWF_DRIVE_TYPE_LOGICAL   = "l"
+)
+
 type EWFDeviceInformationSection struct {
 	NumberOfObjects string
 	ObjectName      string
@@ -155,3 +169,21 @@ func (c *EWFDeviceInformationSection) GetSectorSize() (int, error) {
 	}
 	return strconv.Atoi(strings.TrimSpace(bp))
 }
+
+func (c *EWFDeviceInformationSection) GetTotalSectorCount() (int64, error) {
+	ts, ok := c.KeyValue[string(EWF_DEVICE_INFO_NUMBER_OF_SECTORS)]
+	if !ok {
+		return 0, errors.New("device info has no sector count")
+	}
+	return strconv.ParseInt(strings.TrimSpace(ts), 10, 64)
+}
+
+// GetMediaSize returns the number of bytes of media that is not a whole number of sectors, 0 when
+// it is not recorded
+func (c *EWFDeviceInformationSection) GetMediaSize() (int64, error) {
+	ms, ok := c.KeyValue[string(EWF_DEVICE_INFO_MEDIA_SIZE)]
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseInt(strings.TrimSpace(ms), 10, 64)
+}
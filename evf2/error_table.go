@@ -0,0 +1,193 @@
+package evf2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// EWFErrorTableSection lists the sector ranges that could not be read during acquisition,
+// the sectors are stored zero filled.
+type EWFErrorTableSection struct {
+	Header  *EWFErrorTableSectionHeader
+	Entries []EWFErrorTableSectionEntry
+	Footer  *EWFErrorTableSectionFooter
+
+	// damaged is the checksum mismatch of the section, nil when the checksums match
+	damaged error
+}
+
+type EWFErrorTableSectionHeader struct {
+	NumEntries uint32
+	Unknown    [12]uint8
+	Checksum   uint32
+}
+
+type EWFErrorTableSectionEntry struct {
+	FirstSector uint64
+	SectorCount uint32
+	Unknown     uint32
+}
+
+type EWFErrorTableSectionFooter struct {
+	Checksum uint32
+}
+
+func (d *EWFErrorTableSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, segment *EWFSegment) error {
+	_, err := fh.Seek(section.DataOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	header := EWFErrorTableSectionHeader{}
+	err = binary.Read(fh, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	d.Header = &header
+
+	headerSize := binary.Size(header)
+	headerSize += calculatePadding(headerSize)
+	entrySize := int64(binary.Size(EWFErrorTableSectionEntry{}))
+	if int64(headerSize)+int64(header.NumEntries)*entrySize > int64(section.Size) {
+		return fmt.Errorf("error table at 0x%x has %d entries, more than the section holds", section.offset, header.NumEntries)
+	}
+
+	_, err = fh.Seek(section.DataOffset+int64(headerSize), io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	d.Entries = make([]EWFErrorTableSectionEntry, header.NumEntries)
+	err = binary.Read(fh, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return err
+	}
+
+	footer := EWFErrorTableSectionFooter{}
+	err = binary.Read(fh, binary.LittleEndian, &footer)
+	if err != nil {
+		return err
+	}
+	d.Footer = &footer
+
+	// ranges of a damaged section are not reported, strict mode fails to open the image
+	d.damaged = d.verifyChecksums(section, segment.EWFHeader.SegmentNumber)
+	if segment.strict {
+		return d.damaged
+	}
+
+	return nil
+}
+
+func (d *EWFErrorTableSection) Encode(ewf io.Writer, previousDescriptorPosition int64) (dataN int, descN int, err error) {
+	if d.Header == nil {
+		d.Header = &EWFErrorTableSectionHeader{}
+	}
+	if d.Footer == nil {
+		d.Footer = &EWFErrorTableSectionFooter{}
+	}
+	d.Header.NumEntries = uint32(len(d.Entries))
+
+	bbuf := bytes.NewBuffer(nil)
+	_, d.Header.Checksum, err = shared.WriteWithSum(bbuf, d.Header)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	headerPad, headerPaddingSize := alignSizeTo16Bytes(bbuf.Len())
+	_, err = bbuf.Write(headerPad)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	headerLen := bbuf.Len()
+	err = binary.Write(bbuf, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// only entries data
+	d.Footer.Checksum = adler32.Checksum(bbuf.Bytes()[headerLen:])
+	err = binary.Write(bbuf, binary.LittleEndian, d.Footer)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	footerPad, footerPaddingSize := alignSizeTo16Bytes(binary.Size(d.Footer))
+	_, err = bbuf.Write(footerPad)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dataN, err = ewf.Write(bbuf.Bytes())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_ERROR_TABLE)
+
+	desc.DataSize = uint64(dataN)
+	desc.PreviousOffset = uint64(previousDescriptorPosition)
+	desc.PaddingSize = uint32(headerPaddingSize + footerPaddingSize)
+
+	descN, desc.Checksum, err = shared.WriteWithSum(ewf, desc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return dataN, descN, nil
+}
+
+// verifyChecksums validates the checksums of the header and the entries
+func (d *EWFErrorTableSection) verifyChecksums(section *EWFSectionDescriptor, segmentNumber uint16) error {
+	sum, err := shared.Checksum(d.Header)
+	if err != nil {
+		return err
+	}
+	if sum != d.Header.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "error table header",
+			Stored:        d.Header.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, d.Entries); err != nil {
+		return err
+	}
+	sum = adler32.Checksum(buf.Bytes())
+	if sum != d.Footer.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "error table entries",
+			Stored:        d.Footer.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	return nil
+}
+
+// Ranges returns the unreadable sector ranges, an error when the section is damaged
+func (d *EWFErrorTableSection) Ranges() ([]shared.SectorRange, error) {
+	if d.damaged != nil {
+		return nil, d.damaged
+	}
+
+	ranges := make([]shared.SectorRange, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		ranges = append(ranges, shared.SectorRange{First: e.FirstSector, Count: uint64(e.SectorCount)})
+	}
+	return ranges, nil
+}
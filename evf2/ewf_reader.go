@@ -2,10 +2,13 @@ package evf2
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sort"
+	"sync"
 
 	"github.com/asalih/go-ewf/shared"
 )
@@ -21,21 +24,79 @@ type EWFReader struct {
 	decompressor shared.Decompressor
 	segments     *list.List
 	position     int64
+
+	// unreadable are the sector ranges reads fail on, set by OpenOptions.UnreadableSectorErrors
+	unreadable []shared.SectorRange
+	// chunks caches decompressed chunks, set by OpenOptions.ChunkCacheSize
+	chunks *shared.ChunkCache
+	// mu serializes the lazy decoding of segments, ReadAt is safe for concurrent use
+	mu sync.Mutex
+	// files are the segment files opened by OpenEWFFile, closed by Close
+	files []*os.File
+	// recovery is what could be read of an image opened with OpenOptions.Recover
+	recovery *shared.Recovery
 }
 
+// OpenEWF opens the segment files of an image, checksums are not validated
 func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
+	return OpenEWFWithOptions(shared.OpenOptions{}, fhs...)
+}
+
+// OpenEWFFile opens the image whose first segment file is at path together with the segment
+// files that follow it, e.g. image.E02 and image.E03 for image.E01. Close closes the files.
+func OpenEWFFile(path string, opts shared.OpenOptions) (*EWFReader, error) {
+	files, err := shared.OpenSegmentFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fhs := make([]io.ReadSeeker, len(files))
+	for i, f := range files {
+		fhs[i] = f
+	}
+	ewf, err := OpenEWFWithOptions(opts, fhs...)
+	if err != nil {
+		_ = shared.CloseFiles(files)
+		return nil, err
+	}
+	ewf.files = files
+	return ewf, nil
+}
+
+// OpenEWFReaderAt opens the segment files of an image that are read with positional reads only,
+// so the segments do not need a file position shared by all reads
+func OpenEWFReaderAt(opts shared.OpenOptions, segments ...shared.SegmentReaderAt) (*EWFReader, error) {
+	fhs := make([]io.ReadSeeker, len(segments))
+	for i, segment := range segments {
+		fhs[i] = io.NewSectionReader(segment.ReaderAt, 0, segment.Size)
+	}
+	return OpenEWFWithOptions(opts, fhs...)
+}
+
+// OpenEWFWithOptions opens the segment files of an image. In strict mode all segments are decoded
+// and their section descriptor and table checksums are validated before returning.
+func OpenEWFWithOptions(opts shared.OpenOptions, fhs ...io.ReadSeeker) (*EWFReader, error) {
 	ewf := &EWFReader{
 		segments:  list.New(),
 		ChunkSize: 0,
 		EWFSize:   0,
 	}
 
+	ewf.chunks = shared.NewChunkCache(opts.ChunkCacheSize)
+
 	allSegments := make([]*EWFSegment, 0)
 	for _, file := range fhs {
 		segment, err := NewEWFSegment(file)
+		if opts.Recover && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			// a segment file created right before the acquisition stopped holds no data
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		segment.strict = opts.Strict
+		segment.recover = opts.Recover
+		segment.chunks = ewf.chunks
 
 		allSegments = append(allSegments, segment)
 	}
@@ -47,6 +108,9 @@ func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
 	if len(allSegments) == 0 {
 		return nil, errors.New("failed to load EWF")
 	}
+	if err := validateSegments(allSegments); err != nil {
+		return nil, err
+	}
 
 	ewf.First = allSegments[0]
 	switch ewf.First.EWFHeader.CompressionMethod {
@@ -73,6 +137,14 @@ func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
 		return nil, fmt.Errorf("failed to load EWF")
 	}
 
+	if opts.Strict || opts.Recover {
+		for i := 1; i < ewf.segments.Len(); i++ {
+			if _, _, err := ewf.Segment(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	sc, err := ewf.First.CaseData.GetSectorCount()
 	if err != nil {
 		return nil, err
@@ -84,15 +156,116 @@ func OpenEWF(fhs ...io.ReadSeeker) (*EWFReader, error) {
 
 	ewf.ChunkSize = uint32(sc) * uint32(ss)
 
+	// media size may not be a multiple of the chunk size, the last chunk is short then
 	cc, err := ewf.First.CaseData.GetChunkCount()
 	if err != nil {
 		return nil, err
 	}
 	ewf.EWFSize = int64(cc) * int64(ewf.ChunkSize)
+	if ts, err := ewf.First.DeviceInformation.GetTotalSectorCount(); err == nil && ts > 0 {
+		ewf.EWFSize = ts * int64(ss)
+		// the last sector of media that is not a whole number of sectors is filled up with zeros
+		if ms, err := ewf.First.DeviceInformation.GetMediaSize(); err == nil && ms > ewf.EWFSize-int64(ss) && ms < ewf.EWFSize {
+			ewf.EWFSize = ms
+		}
+	}
+
+	if opts.Recover {
+		ewf.recovery, err = ewf.recover()
+		if err != nil {
+			return nil, err
+		}
+		ewf.EWFSize = ewf.recovery.Size
+	}
+
+	if opts.UnreadableSectorErrors {
+		ewf.unreadable, err = ewf.Errors()
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(ewf.unreadable, func(i, j int) bool {
+			return ewf.unreadable[i].First < ewf.unreadable[j].First
+		})
+	}
 
 	return ewf, nil
 }
 
+// validateSegments checks that the segments are one complete set with the same set identifier,
+// the error is a *shared.SegmentSetError
+func validateSegments(segments []*EWFSegment) error {
+	numbers := make([]uint16, len(segments))
+	ids := make([][]byte, len(segments))
+	for i, seg := range segments {
+		numbers[i] = seg.EWFHeader.SegmentNumber
+		ids[i] = seg.EWFHeader.SetIdentifier[:]
+	}
+
+	// the segments are sorted, the acquisition continues after the last one when it ends with a
+	// next section. Recovery expects the segment an interrupted acquisition did not write.
+	last := segments[len(segments)-1]
+	continued := !last.recover && last.endsWithNext()
+	return shared.ValidateSegmentSet(numbers, ids, continued)
+}
+
+// recover returns how much of the media can be read from the decoded segments
+func (ewf *EWFReader) recover() (*shared.Recovery, error) {
+	recovery := &shared.Recovery{RecordedSize: ewf.EWFSize}
+
+	var chunkCount int64
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		chunkCount += seg.chunkCount
+		if seg.recovered {
+			recovery.Segments = append(recovery.Segments, seg.EWFHeader.SegmentNumber)
+		}
+	}
+	if chunkCount == 0 {
+		return recovery, nil
+	}
+
+	end, err := ewf.lastChunkEnd()
+	if err != nil {
+		return nil, err
+	}
+	recovery.Size = end
+	if recovery.RecordedSize > 0 && recovery.RecordedSize < end {
+		recovery.Size = recovery.RecordedSize
+	}
+
+	return recovery, nil
+}
+
+// lastChunkEnd returns the media offset where the data of the last chunk ends
+func (ewf *EWFReader) lastChunkEnd() (int64, error) {
+	var chunkCount int64
+	var last *EWFSegment
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return 0, err
+		}
+		chunkCount += seg.chunkCount
+		if len(seg.Tables) > 0 {
+			last = seg
+		}
+	}
+	if last == nil || chunkCount == 0 {
+		return 0, errors.New("image has no chunks")
+	}
+
+	tbl := last.Tables[len(last.Tables)-1]
+	buf, err := tbl.readChunk(int64(tbl.Header.NumEntries) - 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return (chunkCount-1)*int64(ewf.ChunkSize) + int64(len(buf)), nil
+}
+
 func (ewf *EWFReader) Metadata() map[string]interface{} {
 	cd := make(map[string]string)
 	for k, v := range ewf.First.CaseData.KeyValue {
@@ -128,6 +301,44 @@ func (ewf *EWFReader) Size() int64 {
 }
 
 func (ewf *EWFReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if len(ewf.unreadable) == 0 || off < 0 {
+		return ewf.readAt(p, off)
+	}
+
+	// reads stop at the first unreadable sector
+	sectorSize, err := ewf.First.DeviceInformation.GetSectorSize()
+	if err != nil {
+		return 0, err
+	}
+	r, start, ok := shared.FindUnreadable(ewf.unreadable, int64(sectorSize), off, int64(len(p)))
+	if !ok {
+		return ewf.readAt(p, off)
+	}
+	if start > off {
+		n, err = ewf.readAt(p[:start-off], off)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, &shared.UnreadableSectorError{Range: r}
+}
+
+// readAt reads the media, unreadable sectors read as the zeros stored for them
+func (ewf *EWFReader) readAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= ewf.EWFSize {
+		return 0, io.EOF
+	}
+
+	// reads stop at the end of the media
+	var eof error
+	if int64(len(p)) > ewf.EWFSize-off {
+		p = p[:ewf.EWFSize-off]
+		eof = io.EOF
+	}
+
 	sectorSize, err := ewf.First.DeviceInformation.GetSectorSize()
 	if err != nil {
 		return 0, err
@@ -169,7 +380,98 @@ func (ewf *EWFReader) ReadAt(p []byte, off int64) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	return n, nil
+	return n, eof
+}
+
+// VerifyHashes reads the Size() bytes of source data and compares their MD5 and SHA1 to the
+// hashes stored in the md5_hash and sha1_hash sections. The zeros that fill up the last sector of a
+// source that is not a multiple of the sector size are not hashed. progress may be nil.
+func (ewf *EWFReader) VerifyHashes(ctx context.Context, progress shared.ProgressFunc) (*shared.HashVerification, error) {
+	var storedMD5, storedSHA1 []byte
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.MD5Hash != nil {
+			storedMD5 = seg.MD5Hash.Hash[:]
+		}
+		if seg.SHA1Hash != nil {
+			storedSHA1 = seg.SHA1Hash.Hash[:]
+		}
+	}
+
+	// hashes cover the zero filled unreadable sectors
+	return shared.VerifyHashes(ctx, shared.ReaderAtFunc(ewf.readAt), ewf.EWFSize, storedMD5, storedSHA1, progress)
+}
+
+// Errors decodes all segments and returns the sector ranges that could not be read during
+// acquisition. The sectors are stored zero filled and are not media content. A damaged error
+// table is reported as a *shared.ChecksumError.
+func (ewf *EWFReader) Errors() ([]shared.SectorRange, error) {
+	var ranges []shared.SectorRange
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.ErrorTable != nil {
+			segRanges, err := seg.ErrorTable.Ranges()
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, segRanges...)
+		}
+	}
+
+	return ranges, nil
+}
+
+// Sessions decodes all segments and returns the sessions and tracks of optical media, nil when
+// the image has no session table. A damaged session table is reported as a *shared.ChecksumError.
+func (ewf *EWFReader) Sessions() ([]shared.Session, error) {
+	sectorSize, err := ewf.First.DeviceInformation.GetSectorSize()
+	if err != nil {
+		return nil, err
+	}
+	totalSectors := uint64((ewf.EWFSize + int64(sectorSize) - 1) / int64(sectorSize))
+
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.SessionTable != nil {
+			return seg.SessionTable.Sessions(totalSectors)
+		}
+	}
+
+	return nil, nil
+}
+
+// Close closes the segment files opened by OpenEWFFile. Segments passed to the other open
+// functions are left to the caller.
+func (ewf *EWFReader) Close() error {
+	files := ewf.files
+	ewf.files = nil
+	return shared.CloseFiles(files)
+}
+
+// SegmentCount returns the number of segment files of the image
+func (ewf *EWFReader) SegmentCount() int {
+	return ewf.segments.Len()
+}
+
+// Recovery reports how much of the media could be read when the image was opened with
+// OpenOptions.Recover, nil when it was opened without it
+func (ewf *EWFReader) Recovery() *shared.Recovery {
+	return ewf.recovery
+}
+
+// ChunkCacheStats returns the hits and misses of the chunk cache, zero when the image was opened
+// without one
+func (ewf *EWFReader) ChunkCacheStats() shared.ChunkCacheStats {
+	return ewf.chunks.Stats()
 }
 
 // Seek implements vfs.FileDescriptionImpl.Seek.
@@ -196,6 +498,9 @@ func (ewf *EWFReader) Seek(offset int64, whence int) (ret int64, err error) {
 }
 
 func (ewf *EWFReader) Segment(index int) (*EWFSegment, *list.Element, error) {
+	ewf.mu.Lock()
+	defer ewf.mu.Unlock()
+
 	elem, ok := shared.GetListElement(ewf.segments, index)
 	if !ok {
 		return nil, nil, errors.New("not found")
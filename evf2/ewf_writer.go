@@ -1,11 +1,16 @@
 package evf2
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
 	"io"
+	"math"
 	"runtime"
 	"strconv"
 	"sync"
@@ -15,6 +20,7 @@ import (
 )
 
 var _ shared.EWFWriter = &EWFWriter{}
+var _ shared.AcquisitionWriter = &EWFWriter{}
 
 type writer struct {
 	position int64
@@ -32,16 +38,36 @@ type EWFWriter struct {
 	mu   sync.Mutex
 	dest *writer
 
-	dataPadSize int
-	dataSize    uint64
-	buf         []byte
-	compressor  *shared.ZlibCompressor
+	dataPadSize     int
+	dataSize        uint64
+	mediaSize       uint64
+	totalSize       uint64
+	buf             []byte
+	bytesPerSector  uint32
+	sectorsPerChunk uint32
+	encode          shared.ChunkEncoder
+
+	errorGranularity uint32
+	readRetries      int
+	// unreadable are the sector ranges written zero filled, listed in the error table
+	unreadable []shared.SectorRange
+	// sessions are the sessions and tracks of optical media, listed in the session table
+	sessions []shared.Session
+
+	workers     int
+	maxInFlight int64
+	pipeline    *shared.ChunkPipeline
+	// writeErr is the first error storing data, the encoders are stopped once it is set
+	writeErr error
 
 	previousDescriptorPosition int64
 
 	md5Hasher  hash.Hash
 	sha1Hasher hash.Hash
 
+	maxSegmentSize int64
+	nextSegment    NextSegmentFunc
+
 	Segment       *EWFSegment
 	SegmentOffset uint32
 	ChunkSize     uint32
@@ -49,24 +75,25 @@ type EWFWriter struct {
 	chunkCount uint64
 }
 
+// NextSegmentFunc opens the destination of the given segment number when the writer
+// rolls over to a new segment file (Ex02, Ex03, ...).
+type NextSegmentFunc func(segmentNumber uint16) (io.Writer, error)
+
 type EWFCreator struct {
 	ewfWriter *EWFWriter
 }
 
 func CreateEWF(dest io.Writer) (*EWFCreator, error) {
 	ewf := &EWFWriter{
-		dest:          &writer{fh: dest},
-		buf:           make([]byte, 0, DefaultChunkSize),
-		SegmentOffset: 0,
-		ChunkSize:     0,
-	}
-
-	compressor, err := shared.NewZlibCompressor()
-	if err != nil {
-		return nil, err
+		dest:            &writer{fh: dest},
+		buf:             make([]byte, 0, DefaultChunkSize),
+		bytesPerSector:  DefaultSectorSize,
+		sectorsPerChunk: DefaultSectorsPerChunk,
+		SegmentOffset:   0,
+		ChunkSize:       DefaultChunkSize,
 	}
-	ewf.compressor = compressor
 
+	var err error
 	ewf.Segment, err = NewEWFSegment(nil)
 	if err != nil {
 		return nil, err
@@ -74,10 +101,14 @@ func CreateEWF(dest io.Writer) (*EWFCreator, error) {
 	ewf.Segment.EWFHeader = &EWFHeader{
 		MajorVersion:      2,
 		MinorVersion:      1,
-		SegmentNumber:     1, // TODO: this number increments for each file chunk like E0n
+		SegmentNumber:     1,
 		CompressionMethod: EWF_COMPRESSION_METHOD_ZLIB,
 	}
 	copy(ewf.Segment.EWFHeader.Signature[:], []byte(EVF2Signature))
+	// all segments of the image share the set identifier
+	if _, err := rand.Read(ewf.Segment.EWFHeader.SetIdentifier[:]); err != nil {
+		return nil, err
+	}
 
 	ewf.Segment.CaseData = &EWFCaseDataSection{}
 	ewf.Segment.CaseData.NumberOfObjects = "1"
@@ -106,7 +137,7 @@ func CreateEWF(dest io.Writer) (*EWFCreator, error) {
 		string(EWF_DEVICE_INFO_SERIAL_NUMBER):        "",
 		string(EWF_DEVICE_INFO_DRIVE_LABEL):          "",
 		string(EWF_DEVICE_INFO_NUMBER_OF_HPA):        "",
-		string(EWF_DEVICE_INFO_DRIVE_TYPE):           "f",
+		string(EWF_DEVICE_INFO_DRIVE_TYPE):           EWF_DRIVE_TYPE_FIXED,
 		string(EWF_DEVICE_INFO_MUMBER_OF_PALM):       "",
 		string(EWF_DEVICE_INFO_IS_PHYSICAL):          "1",
 	}
@@ -135,80 +166,524 @@ func (creator *EWFCreator) AddDeviceInformation(key EWFDeviceInformationKey, val
 	creator.ewfWriter.Segment.DeviceInformation.KeyValue[string(key)] = value
 }
 
+// SetCompressionWorkers compresses chunks on the given number of goroutines. maxInFlight bounds
+// the bytes of chunk data held in memory while waiting to be compressed or written, 0 keeps two
+// chunks per worker. Chunks are still written in order. A single worker compresses inline.
+// maxInFlight has to hold at least one chunk of the sector geometry set before.
+func (creator *EWFCreator) SetCompressionWorkers(workers int, maxInFlight int64) error {
+	if err := creator.ewfWriter.checkMaxInFlight(maxInFlight); err != nil {
+		return err
+	}
+	creator.ewfWriter.workers = workers
+	creator.ewfWriter.maxInFlight = maxInFlight
+	return nil
+}
+
+// SetSectorGeometry sets the bytes per sector and the number of sectors stored in a chunk.
+// Default is 512 bytes per sector and 64 sectors per chunk.
+func (creator *EWFCreator) SetSectorGeometry(bytesPerSector, sectorsPerChunk uint32) {
+	creator.ewfWriter.bytesPerSector = bytesPerSector
+	creator.ewfWriter.sectorsPerChunk = sectorsPerChunk
+}
+
+// SetErrorGranularity sets the number of sectors Acquire reads again and zero fills as a unit when
+// the source fails to read. It is recorded in the case data and must divide the sectors per chunk.
+// Default is the sectors per chunk.
+func (creator *EWFCreator) SetErrorGranularity(sectors uint32) {
+	creator.ewfWriter.errorGranularity = sectors
+}
+
+// SetReadRetries sets how many more times Acquire reads a failing unit of the source before it is
+// zero filled. Default is 0.
+func (creator *EWFCreator) SetReadRetries(retries int) {
+	creator.ewfWriter.readRetries = retries
+}
+
+// SetSessions records the sessions and tracks of optical media in the session table. Only the
+// first sector and the flags of a session are stored, it runs up to the next session. The drive
+// type device information must be EWF_DRIVE_TYPE_OPTICAL.
+func (creator *EWFCreator) SetSessions(sessions []shared.Session) {
+	creator.ewfWriter.sessions = append([]shared.Session(nil), sessions...)
+}
+
+// SetSegmentSize splits the image into segment files of at most maxSize bytes.
+// next is called to open the destination of each segment after the first one.
+// Destinations returned by next are closed by the writer if they implement io.Closer.
+func (creator *EWFCreator) SetSegmentSize(maxSize int64, next NextSegmentFunc) {
+	creator.ewfWriter.maxSegmentSize = maxSize
+	creator.ewfWriter.nextSegment = next
+}
+
+// Start writes the beginning of the first segment. totalSize must be the exact number of bytes
+// written to the image, the device information and case data at the start of every segment
+// record it as the media size ahead of the data. Write fails past it and Close fails short of it.
 func (creator *EWFCreator) Start(totalSize int64) (*EWFWriter, error) {
-	err := creator.ewfWriter.Segment.EWFHeader.Encode(creator.ewfWriter.dest)
+	if creator.ewfWriter.maxSegmentSize > 0 && creator.ewfWriter.nextSegment == nil {
+		return nil, errors.New("segment size is set without a next segment function")
+	}
+
+	bytesPerSector := creator.ewfWriter.bytesPerSector
+	sectorsPerChunk := creator.ewfWriter.sectorsPerChunk
+	if bytesPerSector == 0 || sectorsPerChunk == 0 {
+		return nil, fmt.Errorf("invalid sector geometry: %d bytes per sector, %d sectors per chunk", bytesPerSector, sectorsPerChunk)
+	}
+
+	errorGranularity := creator.ewfWriter.errorGranularity
+	if errorGranularity == 0 {
+		errorGranularity = sectorsPerChunk
+	}
+	if errorGranularity > sectorsPerChunk || sectorsPerChunk%errorGranularity != 0 {
+		return nil, fmt.Errorf("error granularity of %d sectors does not divide %d sectors per chunk", errorGranularity, sectorsPerChunk)
+	}
+	if creator.ewfWriter.readRetries < 0 {
+		return nil, fmt.Errorf("invalid read retries: %d", creator.ewfWriter.readRetries)
+	}
+	creator.ewfWriter.errorGranularity = errorGranularity
+
+	chunkSize := int64(bytesPerSector) * int64(sectorsPerChunk)
+	if chunkSize > math.MaxInt32 {
+		return nil, fmt.Errorf("chunk size %d is too big", chunkSize)
+	}
+	creator.ewfWriter.ChunkSize = uint32(chunkSize)
+	creator.ewfWriter.buf = make([]byte, 0, chunkSize)
+
+	if totalSize < 0 {
+		return nil, fmt.Errorf("invalid total size: %d", totalSize)
+	}
+	creator.ewfWriter.totalSize = uint64(totalSize)
+
+	// a partial sector at the end counts as a whole one
+	numSectors := totalSize / int64(bytesPerSector)
+	if totalSize%int64(bytesPerSector) > 0 {
+		numSectors++
+	}
+
+	if sessions := creator.ewfWriter.sessions; len(sessions) > 0 {
+		driveType := creator.ewfWriter.Segment.DeviceInformation.KeyValue[string(EWF_DEVICE_INFO_DRIVE_TYPE)]
+		if driveType != EWF_DRIVE_TYPE_OPTICAL {
+			return nil, fmt.Errorf("sessions can only be recorded for optical media, drive type is %q", driveType)
+		}
+		if err := shared.ValidateSessions(sessions); err != nil {
+			return nil, err
+		}
+		if last := sessions[len(sessions)-1]; last.Range.First >= uint64(numSectors) {
+			return nil, fmt.Errorf("session at sector %d starts beyond the %d sectors of the media", last.Range.First, numSectors)
+		}
+	}
+
+	numChunks := totalSize / chunkSize
+	if totalSize%chunkSize > 0 {
+		numChunks++
+	}
+
+	creator.AddDeviceInformation(EWF_DEVICE_INFO_BYTES_PER_SEC, strconv.FormatUint(uint64(bytesPerSector), 10))
+	creator.AddDeviceInformation(EWF_DEVICE_INFO_NUMBER_OF_SECTORS, strconv.FormatInt(numSectors, 10))
+	if totalSize%int64(bytesPerSector) > 0 {
+		creator.AddDeviceInformation(EWF_DEVICE_INFO_MEDIA_SIZE, strconv.FormatInt(totalSize, 10))
+	}
+
+	creator.AddCaseData(EWF_CASE_DATA_NUMBER_OF_CHUNKS, strconv.FormatInt(numChunks, 10))
+	creator.AddCaseData(EWF_CASE_DATA_NUMBER_OF_SECTORS_PC, strconv.FormatUint(uint64(sectorsPerChunk), 10))
+	creator.AddCaseData(EWF_CASE_DATA_ERROR_GRANULARITY, strconv.FormatUint(uint64(errorGranularity), 10))
+
+	err := creator.ewfWriter.writeSegmentStart()
 	if err != nil {
 		return nil, err
 	}
 
-	headerPad, _ := alignSizeTo16Bytes(binary.Size(creator.ewfWriter.Segment.EWFHeader))
-	_, err = creator.ewfWriter.dest.Write(headerPad)
+	// the compression workers start last, nothing stops them when Start fails
+	err = creator.ewfWriter.startEncoders()
 	if err != nil {
 		return nil, err
 	}
 
-	numChunks := totalSize / DefaultChunkSize
-	if totalSize%DefaultChunkSize > 0 {
-		numChunks++
-	}
+	return creator.ewfWriter, nil
+}
 
-	creator.AddDeviceInformation(EWF_DEVICE_INFO_BYTES_PER_SEC, "512")
-	creator.AddDeviceInformation(EWF_DEVICE_INFO_NUMBER_OF_SECTORS, strconv.FormatInt(numChunks*64, 10))
-	_, descN, err := creator.ewfWriter.Segment.DeviceInformation.Encode(creator.ewfWriter.dest, 0)
+// newEncoder returns a chunk encoder with its own compressor
+func (ewf *EWFWriter) newEncoder() (shared.ChunkEncoder, error) {
+	compressor, err := shared.NewZlibCompressor()
 	if err != nil {
 		return nil, err
 	}
+	return func(p []byte) ([]byte, bool, error) {
+		bufc, err := compressor.Compress(p)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// compression has bigger output
+		if len(bufc) > len(p) {
+			return p, false, nil
+		}
+
+		// compressor reuses its buffer
+		return append([]byte(nil), bufc...), true, nil
+	}, nil
+}
+
+// checkMaxInFlight validates a limit of the chunk data in flight against the chunk size
+func (ewf *EWFWriter) checkMaxInFlight(maxInFlight int64) error {
+	chunkSize := int64(ewf.bytesPerSector) * int64(ewf.sectorsPerChunk)
+	if maxInFlight < 0 || (maxInFlight > 0 && maxInFlight < chunkSize) {
+		return fmt.Errorf("%d bytes in flight do not hold a chunk of %d bytes", maxInFlight, chunkSize)
+	}
+	return nil
+}
 
-	creator.ewfWriter.previousDescriptorPosition = creator.ewfWriter.dest.position - int64(descN)
+// startEncoders creates the inline encoder or the compression workers
+func (ewf *EWFWriter) startEncoders() error {
+	if ewf.workers <= 1 {
+		encode, err := ewf.newEncoder()
+		if err != nil {
+			return err
+		}
+		ewf.encode = encode
+		return nil
+	}
 
-	creator.AddCaseData(EWF_CASE_DATA_NUMBER_OF_CHUNKS, strconv.FormatInt(numChunks, 10))
-	creator.AddCaseData(EWF_CASE_DATA_NUMBER_OF_SECTORS_PC, "64")
-	creator.AddCaseData(EWF_CASE_DATA_ERROR_GRANULARITY, "64")
-	_, descN, err = creator.ewfWriter.Segment.CaseData.Encode(creator.ewfWriter.dest, creator.ewfWriter.previousDescriptorPosition)
+	// the sector geometry may have been changed after the limit was set
+	if err := ewf.checkMaxInFlight(ewf.maxInFlight); err != nil {
+		return err
+	}
+	maxPending := ewf.workers * 2
+	if ewf.maxInFlight > 0 {
+		maxPending = int(ewf.maxInFlight / int64(ewf.ChunkSize))
+	}
+
+	pipeline, err := shared.NewChunkPipeline(ewf.workers, maxPending, ewf.newEncoder)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	creator.ewfWriter.previousDescriptorPosition = creator.ewfWriter.dest.position - int64(descN)
+	ewf.pipeline = pipeline
+	return nil
+}
 
-	return creator.ewfWriter, nil
+// writeSegmentStart writes the file header, device information and case data of the current segment.
+// Every segment carries the device information and case data sections.
+func (ewf *EWFWriter) writeSegmentStart() error {
+	err := ewf.Segment.EWFHeader.Encode(ewf.dest)
+	if err != nil {
+		return err
+	}
+
+	headerPad, _ := alignSizeTo16Bytes(binary.Size(ewf.Segment.EWFHeader))
+	_, err = ewf.dest.Write(headerPad)
+	if err != nil {
+		return err
+	}
+
+	_, descN, err := ewf.Segment.DeviceInformation.Encode(ewf.dest, 0)
+	if err != nil {
+		return err
+	}
+	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+
+	_, descN, err = ewf.Segment.CaseData.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	if err != nil {
+		return err
+	}
+	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+
+	return nil
 }
 
 func (ewf *EWFWriter) Write(p []byte) (n int, err error) {
 	ewf.mu.Lock()
 	defer ewf.mu.Unlock()
 
+	return ewf.write(p)
+}
+
+// write adds p to the media, the caller holds ewf.mu
+func (ewf *EWFWriter) write(p []byte) (n int, err error) {
+	if ewf.writeErr != nil {
+		return 0, ewf.writeErr
+	}
+
+	// unreadable data that does not fill its last sector ends the media
+	if l := len(ewf.unreadable); l > 0 {
+		last := ewf.unreadable[l-1]
+		if (last.First+last.Count)*uint64(ewf.bytesPerSector) > ewf.mediaSize {
+			return 0, fmt.Errorf("write after unreadable data that ends within sector %d", last.First+last.Count-1)
+		}
+	}
+
+	// device information with the sector count is written before the data
+	if ewf.mediaSize+uint64(len(p)) > ewf.totalSize {
+		return 0, fmt.Errorf("write exceeds the total size of %d bytes given to Start", ewf.totalSize)
+	}
+
+	_, err = ewf.md5Hasher.Write(p)
+	if err != nil {
+		return
+	}
+
+	_, err = ewf.sha1Hasher.Write(p)
+	if err != nil {
+		return
+	}
+
 	ewf.buf = append(ewf.buf, p...)
+	ewf.mediaSize += uint64(len(p))
 	n = len(p)
 
-	if len(ewf.buf) < DefaultChunkSize {
+	chunkSize := int(ewf.ChunkSize)
+	if len(ewf.buf) < chunkSize {
 		return
 	}
 
-	for len(ewf.buf) >= DefaultChunkSize {
-		err = ewf.writeData(ewf.buf[:DefaultChunkSize])
+	for len(ewf.buf) >= chunkSize {
+		err = ewf.writeData(ewf.buf[:chunkSize])
 		if err != nil {
 			return
 		}
 
-		ewf.buf = ewf.buf[DefaultChunkSize:]
+		ewf.buf = ewf.buf[chunkSize:]
 	}
 
 	return
 }
 
+// WriteUnreadable writes n zero bytes in place of source data that could not be read. The sectors
+// they cover are listed in the error table, the zeros are hashed like the rest of the media.
+// The data written so far must end at a sector boundary, n may end within a sector only for the
+// last sector of the media.
+func (ewf *EWFWriter) WriteUnreadable(n int64) error {
+	if n <= 0 {
+		return nil
+	}
+
+	ewf.mu.Lock()
+	defer ewf.mu.Unlock()
+
+	bps := uint64(ewf.bytesPerSector)
+	if ewf.mediaSize%bps != 0 {
+		return fmt.Errorf("unreadable data must start at a sector boundary, %d bytes written", ewf.mediaSize)
+	}
+	if ewf.mediaSize+uint64(n) > ewf.totalSize {
+		return fmt.Errorf("write exceeds the total size of %d bytes given to Start", ewf.totalSize)
+	}
+	first := ewf.mediaSize / bps
+
+	if err := ewf.writeZeros(n); err != nil {
+		return err
+	}
+	ewf.addUnreadable(first, (uint64(n)+bps-1)/bps)
+
+	return nil
+}
+
+// writeZeros writes n zero bytes of media, the caller holds ewf.mu
+func (ewf *EWFWriter) writeZeros(n int64) error {
+	zeros := make([]byte, shared.MinInt64(n, int64(ewf.ChunkSize)))
+	for n > 0 {
+		p := zeros
+		if n < int64(len(p)) {
+			p = p[:n]
+		}
+		if _, err := ewf.write(p); err != nil {
+			return err
+		}
+		n -= int64(len(p))
+	}
+
+	return nil
+}
+
+// addUnreadable records a range of unreadable sectors, joining it to the previous range when adjacent
+func (ewf *EWFWriter) addUnreadable(first, count uint64) {
+	if l := len(ewf.unreadable); l > 0 {
+		last := &ewf.unreadable[l-1]
+		if last.First+last.Count == first {
+			last.Count += count
+			return
+		}
+	}
+	ewf.unreadable = append(ewf.unreadable, shared.SectorRange{First: first, Count: count})
+}
+
+// Errors returns the sector ranges written as unreadable so far
+func (ewf *EWFWriter) Errors() []shared.SectorRange {
+	ewf.mu.Lock()
+	defer ewf.mu.Unlock()
+	return append([]shared.SectorRange(nil), ewf.unreadable...)
+}
+
+// Acquire copies size bytes of src into the image. A chunk that fails to read is read again in
+// units of the error granularity, each one up to the number of read retries. Units that keep
+// failing are written zero filled and listed in the error table. progress may be nil.
+func (ewf *EWFWriter) Acquire(ctx context.Context, src io.ReaderAt, size int64, progress shared.ProgressFunc) error {
+	return shared.Acquire(ctx, ewf, src, size, shared.AcquireOptions{
+		SectorSize:  int(ewf.bytesPerSector),
+		BlockSize:   int(ewf.ChunkSize),
+		Granularity: int(ewf.errorGranularity * ewf.bytesPerSector),
+		Retries:     ewf.readRetries,
+		Progress:    progress,
+	})
+}
+
+// sessionTableSection returns the session table listing the sessions, nil when there are none
+func (ewf *EWFWriter) sessionTableSection() *EWFSessionTableSection {
+	if len(ewf.sessions) == 0 {
+		return nil
+	}
+
+	sessionTable := &EWFSessionTableSection{
+		Entries: make([]EWFSessionTableSectionEntry, 0, len(ewf.sessions)),
+	}
+	for _, s := range ewf.sessions {
+		sessionTable.Entries = append(sessionTable.Entries, EWFSessionTableSectionEntry{
+			FirstSector: s.Range.First,
+			Flags:       s.Flags,
+		})
+	}
+	return sessionTable
+}
+
+// sessionTableSize is the number of bytes the session table takes at the end of the last segment
+func (ewf *EWFWriter) sessionTableSize() int64 {
+	if len(ewf.sessions) == 0 {
+		return 0
+	}
+
+	header := binary.Size(EWFSessionTableSectionHeader{})
+	footer := binary.Size(EWFSessionTableSectionFooter{})
+	entrySize := int64(binary.Size(EWFSessionTableSectionEntry{}))
+	return DescriptorSize +
+		int64(header+calculatePadding(header)) +
+		int64(len(ewf.sessions))*entrySize +
+		int64(footer+calculatePadding(footer))
+}
+
+// errorTableSection returns the error table listing the unreadable sectors, nil when there are none
+func (ewf *EWFWriter) errorTableSection() *EWFErrorTableSection {
+	if len(ewf.unreadable) == 0 {
+		return nil
+	}
+
+	errorTable := &EWFErrorTableSection{}
+	for _, r := range ewf.unreadable {
+		// entries count at most math.MaxUint32 sectors
+		for first, count := r.First, r.Count; count > 0; {
+			n := count
+			if n > math.MaxUint32 {
+				n = math.MaxUint32
+			}
+			errorTable.Entries = append(errorTable.Entries, EWFErrorTableSectionEntry{
+				FirstSector: first,
+				SectorCount: uint32(n),
+			})
+			first += n
+			count -= n
+		}
+	}
+	return errorTable
+}
+
+// errorTableSize is the number of bytes the error table takes at the end of the last segment
+func (ewf *EWFWriter) errorTableSize() int64 {
+	if len(ewf.unreadable) == 0 {
+		return 0
+	}
+
+	// a range is split into entries of at most math.MaxUint32 sectors
+	var entries int64
+	for _, r := range ewf.unreadable {
+		entries += int64((r.Count + math.MaxUint32 - 1) / math.MaxUint32)
+	}
+
+	header := binary.Size(EWFErrorTableSectionHeader{})
+	footer := binary.Size(EWFErrorTableSectionFooter{})
+	entrySize := int64(binary.Size(EWFErrorTableSectionEntry{}))
+	return DescriptorSize +
+		int64(header+calculatePadding(header)) +
+		entries*entrySize +
+		int64(footer+calculatePadding(footer))
+}
+
+// Close stores the data left in the write buffer and completes the image with its hashes. The
+// compression workers run until Close or the first failed write, a writer that is given up before
+// has to be closed all the same.
 func (ewf *EWFWriter) Close() error {
+	ewf.mu.Lock()
+	if ewf.writeErr != nil {
+		ewf.mu.Unlock()
+		return ewf.writeErr
+	}
 	if len(ewf.buf) > 0 {
-		ewf.mu.Lock()
-		ewf.buf = shared.PadBytes(ewf.buf, DefaultChunkSize)
+		// the last chunk is stored short, filled up to a whole sector. The zeros are not hashed,
+		// the hashes cover the source data only.
+		if partial := len(ewf.buf) % int(ewf.bytesPerSector); partial > 0 {
+			ewf.buf = append(ewf.buf, make([]byte, int(ewf.bytesPerSector)-partial)...)
+		}
 		err := ewf.writeData(ewf.buf)
 		if err != nil {
 			ewf.mu.Unlock()
 			return err
 		}
 		ewf.buf = ewf.buf[:0]
-		ewf.mu.Unlock()
 	}
+	ewf.mu.Unlock()
 
+	err := ewf.flushPipeline()
+	if err != nil {
+		return err
+	}
+
+	// device information is already written with the sector count of the total size
+	if ewf.mediaSize != ewf.totalSize {
+		return fmt.Errorf("wrote %d bytes, Start was given a total size of %d bytes", ewf.mediaSize, ewf.totalSize)
+	}
+
+	err = ewf.writeTables()
+	if err != nil {
+		return err
+	}
+
+	if sessionTable := ewf.sessionTableSection(); sessionTable != nil {
+		_, descN, err := sessionTable.Encode(ewf.dest, ewf.previousDescriptorPosition)
+		if err != nil {
+			return err
+		}
+		ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+		ewf.Segment.SessionTable = sessionTable
+	}
+
+	if errorTable := ewf.errorTableSection(); errorTable != nil {
+		_, descN, err := errorTable.Encode(ewf.dest, ewf.previousDescriptorPosition)
+		if err != nil {
+			return err
+		}
+		ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+		ewf.Segment.ErrorTable = errorTable
+	}
+
+	copy(ewf.Segment.MD5Hash.Hash[:], ewf.md5Hasher.Sum(nil))
+	_, descN, err := ewf.Segment.MD5Hash.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	if err != nil {
+		return err
+	}
+	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+
+	copy(ewf.Segment.SHA1Hash.Hash[:], ewf.sha1Hasher.Sum(nil))
+	_, descN, err = ewf.Segment.SHA1Hash.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	if err != nil {
+		return err
+	}
+	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+
+	_, descN, err = ewf.Segment.Done.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	if err != nil {
+		return err
+	}
+	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
+
+	return ewf.closeSegment()
+}
+
+// writeTables writes the sector data descriptor and the tables of the current segment.
+func (ewf *EWFWriter) writeTables() error {
 	_, descN, err := ewf.Segment.Sectors.Encode(
 		ewf.dest,
 		ewf.dataSize,
@@ -229,45 +704,191 @@ func (ewf *EWFWriter) Close() error {
 		ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
 	}
 
-	copy(ewf.Segment.MD5Hash.Hash[:], ewf.md5Hasher.Sum(nil))
-	_, descN, err = ewf.Segment.MD5Hash.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	return nil
+}
+
+// closeSegment closes the destination of the current segment if it was opened by the writer.
+func (ewf *EWFWriter) closeSegment() error {
+	if ewf.Segment.EWFHeader.SegmentNumber == 1 {
+		return nil
+	}
+	if closer, ok := ewf.dest.fh.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// rollover closes the current segment with a next section and continues with a new segment file.
+func (ewf *EWFWriter) rollover() error {
+	err := ewf.writeTables()
 	if err != nil {
 		return err
 	}
-	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
 
-	copy(ewf.Segment.SHA1Hash.Hash[:], ewf.sha1Hasher.Sum(nil))
-	_, descN, err = ewf.Segment.SHA1Hash.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	_, descN, err := new(EWFNextSection).Encode(ewf.dest, ewf.previousDescriptorPosition)
 	if err != nil {
 		return err
 	}
 	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
 
-	_, descN, err = ewf.Segment.Done.Encode(ewf.dest, ewf.previousDescriptorPosition)
+	err = ewf.closeSegment()
 	if err != nil {
 		return err
 	}
-	ewf.previousDescriptorPosition = ewf.dest.position - int64(descN)
 
-	return nil
+	prev := ewf.Segment
+	segmentNumber := prev.EWFHeader.SegmentNumber + 1
+	dest, err := ewf.nextSegment(segmentNumber)
+	if err != nil {
+		return fmt.Errorf("failed to open segment %d: %w", segmentNumber, err)
+	}
+
+	seg, err := NewEWFSegment(nil)
+	if err != nil {
+		return err
+	}
+	header := *prev.EWFHeader
+	header.SegmentNumber = segmentNumber
+	seg.EWFHeader = &header
+	seg.DeviceInformation = prev.DeviceInformation
+	seg.CaseData = prev.CaseData
+	seg.Sectors = new(EWFSectorsSection)
+	seg.Tables = []*EWFTableSection{
+		newTable(),
+	}
+	seg.MD5Hash = prev.MD5Hash
+	seg.SHA1Hash = prev.SHA1Hash
+	seg.Done = prev.Done
+
+	ewf.dest = &writer{fh: dest}
+	ewf.Segment = seg
+	ewf.dataSize = 0
+	ewf.dataPadSize = 0
+	ewf.previousDescriptorPosition = 0
+
+	return ewf.writeSegmentStart()
 }
 
-func (ewf *EWFWriter) writeData(p []byte) error {
+// segmentTrailerSize is the number of bytes needed to close a segment holding the given
+// number of chunks: the sector data descriptor, its tables and the sections that may follow them.
+func segmentTrailerSize(entries uint32) int64 {
+	tableCount := int64(entries/maxTableLength) + 1
+	tableHeader := int64(binary.Size(EWFTableSectionHeader{}) + calculatePadding(binary.Size(EWFTableSectionHeader{})))
+	tableFooter := int64(binary.Size(EWFTableSectionFooter{}) + calculatePadding(binary.Size(EWFTableSectionFooter{})))
+	entrySize := int64(binary.Size(EWFTableSectionEntry{}))
+	tables := tableCount*(DescriptorSize+tableHeader+tableFooter) + int64(entries)*entrySize
+
+	md5Size := int64(binary.Size(EWFMD5Section{}) + calculatePadding(binary.Size(EWFMD5Section{})))
+	sha1Size := int64(binary.Size(EWFSHA1Section{}) + calculatePadding(binary.Size(EWFSHA1Section{})))
+	last := 3*DescriptorSize + md5Size + sha1Size
+
+	return DescriptorSize + tables + last
+}
+
+// needsRollover reports whether a chunk of chunkSize bytes would exceed the segment size.
+func (ewf *EWFWriter) needsRollover(chunkSize int) bool {
+	if ewf.maxSegmentSize <= 0 {
+		return false
+	}
+
+	var entries uint32
+	for _, t := range ewf.Segment.Tables {
+		entries += t.Header.NumEntries
+	}
+	if entries == 0 {
+		// at least one chunk goes into every segment
+		return false
+	}
+
+	padded := int64(chunkSize + calculatePadding(chunkSize))
+	trailer := segmentTrailerSize(entries+1) + ewf.sessionTableSize() + ewf.errorTableSize()
+	return ewf.dest.position+padded+trailer > ewf.maxSegmentSize
+}
+
+// writeData encodes and stores p. The first error stops the compression workers, later writes
+// return it.
+func (ewf *EWFWriter) writeData(p []byte) (err error) {
+	if ewf.writeErr != nil {
+		return ewf.writeErr
+	}
 	if len(p) == 0 {
 		return nil
 	}
+	defer func() {
+		if err != nil {
+			ewf.writeErr = err
+			ewf.stopEncoders()
+		}
+	}()
 
-	var bufc []byte
-	bufc, err := ewf.compressor.Compress(p)
-	if err != nil {
-		return err
+	if ewf.pipeline == nil {
+		bufc, compressed, err := ewf.encode(p)
+		if err != nil {
+			return err
+		}
+		return ewf.writeChunk(bufc, compressed)
 	}
 
-	// compression has bigger output
-	flag := uint32(EWF_CHUNK_DATA_FLAG_IS_COMPRESSED)
-	if len(bufc) > len(p) {
-		bufc = p
-		flag = 0
+	for ewf.pipeline.Full() {
+		if err := ewf.writeEncodedChunk(ewf.pipeline.Next()); err != nil {
+			return err
+		}
+	}
+
+	// p is a window of the write buffer
+	ewf.pipeline.Submit(append([]byte(nil), p...))
+
+	for ewf.pipeline.Ready() {
+		if err := ewf.writeEncodedChunk(ewf.pipeline.Next()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushPipeline writes the chunks waiting in the pipeline and stops the compression workers
+func (ewf *EWFWriter) flushPipeline() error {
+	if ewf.pipeline == nil {
+		return nil
+	}
+	defer ewf.stopEncoders()
+
+	for c := ewf.pipeline.Next(); c != nil; c = ewf.pipeline.Next() {
+		if err := ewf.writeEncodedChunk(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopEncoders stops the compression workers after the chunks submitted to them are encoded
+func (ewf *EWFWriter) stopEncoders() {
+	if ewf.pipeline == nil {
+		return
+	}
+	ewf.pipeline.Close()
+	ewf.pipeline = nil
+}
+
+func (ewf *EWFWriter) writeEncodedChunk(c *shared.EncodedChunk) error {
+	if c.Err != nil {
+		return c.Err
+	}
+	return ewf.writeChunk(c.Encoded, c.Compressed)
+}
+
+// writeChunk stores the encoded chunk bufc and adds it to the table
+func (ewf *EWFWriter) writeChunk(bufc []byte, compressed bool) error {
+	flag := uint32(0)
+	if compressed {
+		flag = EWF_CHUNK_DATA_FLAG_IS_COMPRESSED
+	}
+
+	if ewf.needsRollover(len(bufc)) {
+		if err := ewf.rollover(); err != nil {
+			return err
+		}
 	}
 
 	cpos := ewf.dest.position
@@ -287,11 +908,5 @@ func (ewf *EWFWriter) writeData(p []byte) error {
 	ewf.Segment.addTableEntry(ewf.chunkCount, cpos, uint32(len(bufc)), flag)
 	ewf.chunkCount++
 
-	_, err = ewf.md5Hasher.Write(p)
-	if err != nil {
-		return err
-	}
-
-	_, err = ewf.sha1Hasher.Write(p)
-	return err
+	return nil
 }
@@ -0,0 +1,68 @@
+package evf2
+
+import (
+	"errors"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// ErrNotLogical is returned when opening an image that is not a logical evidence container as one
+var ErrNotLogical = errors.New("not a logical evidence container")
+
+// LogicalReader reads the files of a logical evidence container (Lx01). It implements fs.FS,
+// paths are relative to the root of the file entry tree. File data is read through the sector
+// tables like the media of a disk image.
+type LogicalReader struct {
+	*shared.LogicalFS
+
+	// EWF reads the media the file data is stored in
+	EWF *EWFReader
+}
+
+// OpenLogical opens the segment files of a logical evidence container, checksums are not validated
+func OpenLogical(fhs ...io.ReadSeeker) (*LogicalReader, error) {
+	return OpenLogicalWithOptions(shared.OpenOptions{}, fhs...)
+}
+
+// OpenLogicalWithOptions opens the segment files of a logical evidence container and decodes its
+// file entry tree
+func OpenLogicalWithOptions(opts shared.OpenOptions, fhs ...io.ReadSeeker) (*LogicalReader, error) {
+	ewf, err := OpenEWFWithOptions(opts, fhs...)
+	if err != nil {
+		return nil, err
+	}
+	if string(ewf.First.EWFHeader.Signature[:]) != LVF2Signature {
+		return nil, ErrNotLogical
+	}
+
+	singleFiles, err := ewf.singleFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := shared.ParseSingleFiles(singleFiles.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LogicalReader{
+		LogicalFS: shared.NewLogicalFS(ewf, root),
+		EWF:       ewf,
+	}, nil
+}
+
+// singleFiles decodes the segments up to the one holding the single files data section
+func (ewf *EWFReader) singleFiles() (*EWFSingleFilesDataSection, error) {
+	for i := 0; i < ewf.segments.Len(); i++ {
+		seg, _, err := ewf.Segment(i)
+		if err != nil {
+			return nil, err
+		}
+		if seg.SingleFiles != nil {
+			return seg.SingleFiles, nil
+		}
+	}
+
+	return nil, errors.New("logical evidence container has no single files data section")
+}
@@ -0,0 +1,29 @@
+package evf2
+
+import (
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+type EWFNextSection struct {
+}
+
+func (d *EWFNextSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, segment *EWFSegment) error {
+	//next has no data
+	return nil
+}
+
+func (d *EWFNextSection) Encode(ewf io.Writer, previousDescriptorPosition int64) (dataN int, descN int, err error) {
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_NEXT)
+
+	desc.DataSize = 0
+	desc.PreviousOffset = uint64(previousDescriptorPosition)
+
+	descN, desc.Checksum, err = shared.WriteWithSum(ewf, desc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return dataN, descN, nil
+}
@@ -32,20 +32,33 @@ type EWFSegment struct {
 	DeviceInformation *EWFDeviceInformationSection
 	CaseData          *EWFCaseDataSection
 
-	Sectors  *EWFSectorsSection
-	Tables   []*EWFTableSection
-	MD5Hash  *EWFMD5Section
-	SHA1Hash *EWFSHA1Section
-	Done     *EWFDoneSection
+	Sectors      *EWFSectorsSection
+	Tables       []*EWFTableSection
+	MD5Hash      *EWFMD5Section
+	SHA1Hash     *EWFSHA1Section
+	ErrorTable   *EWFErrorTableSection
+	SessionTable *EWFSessionTableSection
+	SingleFiles  *EWFSingleFilesDataSection
+	Next         *EWFNextSection
+	Done         *EWFDoneSection
 
 	SectionDescriptors []*EWFSectionDescriptor
 
 	fh           io.ReadSeeker
+	strict       bool
+	recover      bool
 	isDecoded    bool
 	chunkCount   int64
 	sectorCount  int64
 	sectorOffset int64
 	tableOffsets []int64
+
+	// ra reads the chunks and table entries of the segment file, safe for concurrent use
+	ra io.ReaderAt
+	// chunks caches the decompressed chunks of the image, nil when caching is disabled
+	chunks *shared.ChunkCache
+	// recovered is set when the tables were rebuilt by scanning the chunk data
+	recovered bool
 }
 
 func NewEWFSegment(fh io.ReadSeeker) (*EWFSegment, error) {
@@ -56,6 +69,8 @@ func NewEWFSegment(fh io.ReadSeeker) (*EWFSegment, error) {
 	}
 
 	if fh != nil {
+		seg.ra = shared.NewReaderAt(fh)
+
 		ewfHeader := new(EWFHeader)
 		err := ewfHeader.Decode(fh)
 		if err != nil {
@@ -76,6 +91,44 @@ func (seg *EWFSegment) Decode(link *EWFSegment, decompressorFunc shared.Decompre
 		return nil
 	}
 
+	var err error
+	if seg.recover && !seg.endsWithDescriptor() {
+		err = seg.scanSections(link, decompressorFunc)
+	} else {
+		err = seg.readSections(decompressorFunc)
+	}
+	if err != nil {
+		return err
+	}
+
+	sectorOffset := int64(0)
+	for _, table := range seg.Tables {
+		if sectorOffset != 0 {
+			seg.tableOffsets = append(seg.tableOffsets, sectorOffset)
+		}
+
+		table.SectorOffset = sectorOffset
+		sectorOffset += table.SectorCount
+
+		seg.chunkCount += int64(table.Header.NumEntries)
+	}
+
+	sc, err := seg.CaseData.GetSectorCount()
+	if err != nil {
+		return err
+	}
+	seg.sectorCount = seg.chunkCount * int64(sc)
+	if link != nil {
+		seg.sectorOffset = link.sectorOffset + link.sectorCount
+	}
+
+	seg.isDecoded = true
+	return nil
+}
+
+// readSections reads the section descriptors from the end of the segment file backwards, then
+// decodes the sections in file order
+func (seg *EWFSegment) readSections(decompressorFunc shared.Decompressor) error {
 	// Assuming fh is positioned at the end of the file or where the last section ends
 	var err error
 	var section *EWFSectionDescriptor
@@ -94,6 +147,11 @@ func (seg *EWFSegment) Decode(link *EWFSegment, decompressorFunc shared.Decompre
 		if err != nil {
 			return err
 		}
+		if seg.strict {
+			if err := section.verifyChecksum(seg.EWFHeader.SegmentNumber); err != nil {
+				return err
+			}
+		}
 
 		// Append section descriptor in reverse order
 		seg.SectionDescriptors = append([]*EWFSectionDescriptor{section}, seg.SectionDescriptors...)
@@ -111,86 +169,345 @@ func (seg *EWFSegment) Decode(link *EWFSegment, decompressorFunc shared.Decompre
 
 	// sections must be readed end to start direction
 	// after reading descriptors, we decode the data
-	sectorOffset := int64(0)
 	for _, section := range seg.SectionDescriptors {
-		// Process specific section types
-		switch section.Type {
-		case EWF_SECTION_TYPE_DEVICE_INFORMATION:
-			if seg.DeviceInformation != nil {
-				continue
-			}
-			h := new(EWFDeviceInformationSection)
-			if err := h.Decode(seg.fh, section, decompressorFunc); err != nil {
-				return err
-			}
-			seg.DeviceInformation = h
+		if err := seg.decodeSection(section, decompressorFunc); err != nil {
+			return err
+		}
+	}
 
-		case EWF_SECTION_TYPE_CASE_DATA:
-			if seg.CaseData != nil {
-				continue
-			}
-			h := new(EWFCaseDataSection)
-			if err := h.Decode(seg.fh, section, decompressorFunc); err != nil {
-				return err
-			}
-			seg.CaseData = h
+	return nil
+}
 
-		case EWF_SECTION_TYPE_SECTOR_DATA:
-			sectorData := new(EWFSectorsSection)
-			if err := sectorData.Decode(seg.fh, section); err != nil {
-				return err
-			}
-			seg.Sectors = sectorData
+// decodeSection decodes the data of a section, sections of unknown type are skipped
+func (seg *EWFSegment) decodeSection(section *EWFSectionDescriptor, decompressorFunc shared.Decompressor) error {
+	// Process specific section types
+	switch section.Type {
+	case EWF_SECTION_TYPE_DEVICE_INFORMATION:
+		if seg.DeviceInformation != nil {
+			return nil
+		}
+		h := new(EWFDeviceInformationSection)
+		if err := h.Decode(seg.fh, section, decompressorFunc); err != nil {
+			return err
+		}
+		seg.DeviceInformation = h
 
-		case EWF_SECTION_TYPE_SECTOR_TABLE:
-			table := new(EWFTableSection)
-			if err := table.Decode(seg.fh, section, seg, decompressorFunc); err != nil {
-				return err
-			}
+	case EWF_SECTION_TYPE_CASE_DATA:
+		if seg.CaseData != nil {
+			return nil
+		}
+		h := new(EWFCaseDataSection)
+		if err := h.Decode(seg.fh, section, decompressorFunc); err != nil {
+			return err
+		}
+		seg.CaseData = h
 
-			if sectorOffset != 0 {
-				seg.tableOffsets = append(seg.tableOffsets, sectorOffset)
-			}
+	case EWF_SECTION_TYPE_SECTOR_DATA:
+		sectorData := new(EWFSectorsSection)
+		if err := sectorData.Decode(seg.fh, section); err != nil {
+			return err
+		}
+		seg.Sectors = sectorData
+
+	case EWF_SECTION_TYPE_SECTOR_TABLE:
+		table := new(EWFTableSection)
+		if err := table.Decode(seg.fh, section, seg, decompressorFunc); err != nil {
+			return err
+		}
+		seg.Tables = append(seg.Tables, table)
+
+	case EWF_SECTION_TYPE_ERROR_TABLE:
+		errorTable := new(EWFErrorTableSection)
+		if err := errorTable.Decode(seg.fh, section, seg); err != nil {
+			return err
+		}
+		seg.ErrorTable = errorTable
+	case EWF_SECTION_TYPE_SESSION_TABLE:
+		sessionTable := new(EWFSessionTableSection)
+		if err := sessionTable.Decode(seg.fh, section, seg); err != nil {
+			return err
+		}
+		seg.SessionTable = sessionTable
+	case EWF_SECTION_TYPE_SINGLE_FILES_DATA:
+		singleFiles := new(EWFSingleFilesDataSection)
+		if err := singleFiles.Decode(seg.fh, section, decompressorFunc); err != nil {
+			return err
+		}
+		seg.SingleFiles = singleFiles
+	case EWF_SECTION_TYPE_MD5_HASH:
+		md5Hash := new(EWFMD5Section)
+		if err := md5Hash.Decode(seg.fh, section); err != nil {
+			return err
+		}
+		seg.MD5Hash = md5Hash
+	case EWF_SECTION_TYPE_SHA1_HASH:
+		sha1Hash := new(EWFSHA1Section)
+		if err := sha1Hash.Decode(seg.fh, section); err != nil {
+			return err
+		}
+		seg.SHA1Hash = sha1Hash
+	case EWF_SECTION_TYPE_NEXT:
+		nextSec := new(EWFNextSection)
+		if err := nextSec.Decode(seg.fh, section, seg); err != nil {
+			return err
+		}
+		seg.Next = nextSec
+	case EWF_SECTION_TYPE_DONE:
+		doneSec := new(EWFDoneSection)
+		if err := doneSec.Decode(seg.fh, section, seg); err != nil {
+			return err
+		}
+		seg.Done = doneSec
+	}
+
+	return nil
+}
+
+// maxSectionScan bounds how far a section descriptor is searched for after the start of the
+// section data, the largest sections besides the chunk data are tables of maxTableLength entries
+const maxSectionScan = 1 << 20
+
+// endsWithDescriptor reports whether the segment file ends with a section descriptor whose
+// checksum matches, the sections are then read from the last one backwards
+func (seg *EWFSegment) endsWithDescriptor() bool {
+	size, err := seg.fh.Seek(0, io.SeekEnd)
+	if err != nil || size < DescriptorSize {
+		return false
+	}
+	return seg.descriptorAt(size-DescriptorSize) != nil
+}
+
+// endsWithNext reports whether the last section of the segment is a next section, so another
+// segment follows it
+func (seg *EWFSegment) endsWithNext() bool {
+	size, err := seg.fh.Seek(0, io.SeekEnd)
+	if err != nil || size < DescriptorSize {
+		return false
+	}
+	section := seg.descriptorAt(size - DescriptorSize)
+	return section != nil && section.Type == EWF_SECTION_TYPE_NEXT
+}
+
+// descriptorAt returns the section descriptor at offset, nil when there is none whose checksum
+// matches
+func (seg *EWFSegment) descriptorAt(offset int64) *EWFSectionDescriptor {
+	if _, err := seg.fh.Seek(offset, io.SeekStart); err != nil {
+		return nil
+	}
+	section, err := NewEWFSectionDescriptor(seg.fh)
+	if err != nil {
+		return nil
+	}
+	if sum, err := shared.Checksum(section.Descriptor); err != nil || sum != section.Checksum {
+		return nil
+	}
+	return section
+}
+
+// followingDescriptor returns the descriptor at offset of the section whose data starts at
+// dataOffset and that follows the descriptor at prev, nil when there is none
+func (seg *EWFSegment) followingDescriptor(offset, dataOffset, prev int64) *EWFSectionDescriptor {
+	section := seg.descriptorAt(offset)
+	if section == nil || section.Previous != uint64(prev) || section.DataOffset != dataOffset {
+		return nil
+	}
+	return section
+}
 
-			table.SectorOffset = sectorOffset
-			sectorOffset += table.SectorCount
+// findDescriptor searches the descriptor of the section whose data starts at pos and that
+// follows the descriptor at prev, nil when there is none within maxSectionScan bytes
+func (seg *EWFSegment) findDescriptor(pos, prev, fileSize int64) (*EWFSectionDescriptor, error) {
+	n := fileSize - pos
+	if n > maxSectionScan+DescriptorSize {
+		n = maxSectionScan + DescriptorSize
+	}
+	if n < DescriptorSize {
+		return nil, nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(io.NewSectionReader(seg.ra, pos, n), buf); err != nil {
+		return nil, err
+	}
+
+	// descriptors are aligned like the data before them
+	for i := int64(0); i+DescriptorSize <= n; i += 16 {
+		// the previous offset and the data size follow the type and the flags
+		if binary.LittleEndian.Uint64(buf[i+8:]) != uint64(prev) || binary.LittleEndian.Uint64(buf[i+16:]) != uint64(i) {
+			continue
+		}
+		if section := seg.followingDescriptor(pos+i, pos, prev); section != nil {
+			return section, nil
+		}
+	}
+	return nil, nil
+}
+
+// scanChunks finds the chunks stored from start up to end, nil when the segment lacks the
+// sections that describe its chunks or compresses them with bzip2. boundary may be nil.
+func (seg *EWFSegment) scanChunks(start, end int64, boundary func(offset int64) bool) ([]shared.ScannedChunk, error) {
+	if seg.CaseData == nil || seg.DeviceInformation == nil || seg.EWFHeader.CompressionMethod == EWF_COMPRESSION_METHOD_BZIP2 {
+		return nil, nil
+	}
+	sc, err := seg.CaseData.GetSectorCount()
+	if err != nil {
+		return nil, err
+	}
+	ss, err := seg.DeviceInformation.GetSectorSize()
+	if err != nil {
+		return nil, err
+	}
+
+	// uncompressed chunks are stored without a checksum
+	return shared.ScanChunks(seg.ra, start, end, shared.ChunkLayout{
+		ChunkSize: sc * ss,
+		Alignment: 16,
+		Boundary:  boundary,
+	})
+}
+
+// scanSections finds the sections of a segment file that does not end with a section descriptor,
+// e.g. of an interrupted acquisition, walking forward from the file header. Every descriptor
+// follows the data of its section and points back to the previous descriptor, chunk data is
+// crossed by scanning its chunks. When the walk ends before a next or done section, the tables
+// are rebuilt from the chunks found.
+func (seg *EWFSegment) scanSections(link *EWFSegment, decompressorFunc shared.Decompressor) error {
+	fileSize, err := seg.fh.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	headerSize := binary.Size(EWFHeader{})
+	pos := int64(headerSize + calculatePadding(headerSize))
+	prev := int64(0)
+
+	var chunks []shared.ScannedChunk
+	scanned := false
+	for pos < fileSize {
+		section, err := seg.findDescriptor(pos, prev, fileSize)
+		if err != nil {
+			return err
+		}
 
-			seg.Tables = append(seg.Tables, table)
-		case EWF_SECTION_TYPE_MD5_HASH:
-			md5Hash := new(EWFMD5Section)
-			if err := md5Hash.Decode(seg.fh, section); err != nil {
+		// chunk data whose sector data descriptor is further away or was never written
+		if section == nil && seg.Sectors == nil && !scanned {
+			dataOffset, prevOffset := pos, prev
+			chunks, err = seg.scanChunks(pos, fileSize, func(offset int64) bool {
+				section = seg.followingDescriptor(offset, dataOffset, prevOffset)
+				return section != nil
+			})
+			if err != nil {
 				return err
 			}
-			seg.MD5Hash = md5Hash
-		case EWF_SECTION_TYPE_SHA1_HASH:
-			sha1Hash := new(EWFSHA1Section)
-			if err := sha1Hash.Decode(seg.fh, section); err != nil {
-				return err
+			scanned = true
+
+			// the scan ends after a short last chunk, the descriptor follows its padding
+			if section == nil && len(chunks) > 0 {
+				last := chunks[len(chunks)-1]
+				end := last.Offset + last.Size
+				end += int64(calculatePadding(int(end % 16)))
+				section = seg.followingDescriptor(end, dataOffset, prevOffset)
 			}
-			seg.SHA1Hash = sha1Hash
-		case EWF_SECTION_TYPE_DONE:
-			doneSec := new(EWFDoneSection)
-			if err := doneSec.Decode(seg.fh, section, seg); err != nil {
+		}
+		if section == nil {
+			break
+		}
+
+		if err := seg.decodeSection(section, decompressorFunc); err != nil {
+			return err
+		}
+		seg.SectionDescriptors = append(seg.SectionDescriptors, section)
+		if section.Type == EWF_SECTION_TYPE_NEXT || section.Type == EWF_SECTION_TYPE_DONE {
+			return nil
+		}
+
+		prev = section.offset
+		pos = section.offset + DescriptorSize
+	}
+
+	// a table written after the last chunk data lists every chunk, also a short last chunk that
+	// scanning cannot tell from padding
+	if seg.tablesFollowSectors() {
+		seg.recovered = true
+		return nil
+	}
+
+	if !scanned {
+		for _, section := range seg.SectionDescriptors {
+			if section.Type != EWF_SECTION_TYPE_SECTOR_DATA {
+				continue
+			}
+			chunks, err = seg.scanChunks(section.DataOffset, section.offset, nil)
+			if err != nil {
 				return err
 			}
-			seg.Done = doneSec
 		}
 	}
 
-	for _, t := range seg.Tables {
-		seg.chunkCount += int64(t.Header.NumEntries)
+	return seg.recoverTables(link, chunks, decompressorFunc)
+}
+
+// tablesFollowSectors reports whether a sector table section was decoded after the last sector
+// data section
+func (seg *EWFSegment) tablesFollowSectors() bool {
+	table := false
+	for _, section := range seg.SectionDescriptors {
+		switch section.Type {
+		case EWF_SECTION_TYPE_SECTOR_DATA:
+			table = false
+		case EWF_SECTION_TYPE_SECTOR_TABLE:
+			table = true
+		}
 	}
+	return table
+}
 
+// recoverTables replaces the tables of a segment by tables listing the chunks found by scanning
+// its chunk data
+func (seg *EWFSegment) recoverTables(link *EWFSegment, chunks []shared.ScannedChunk, decompressorFunc shared.Decompressor) error {
+	if seg.CaseData == nil || seg.DeviceInformation == nil {
+		return fmt.Errorf("segment %d: no device information and case data to recover the chunks with", seg.EWFHeader.SegmentNumber)
+	}
 	sc, err := seg.CaseData.GetSectorCount()
 	if err != nil {
 		return err
 	}
-	seg.sectorCount = seg.chunkCount * int64(sc)
+	ss, err := seg.DeviceInformation.GetSectorSize()
+	if err != nil {
+		return err
+	}
+
+	firstChunk := uint64(0)
 	if link != nil {
-		seg.sectorOffset = link.sectorOffset + link.sectorCount
+		firstChunk = uint64((link.sectorOffset + link.sectorCount) / int64(sc))
+	}
+
+	seg.Tables = nil
+	seg.recovered = true
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	seg.Tables = append(seg.Tables, newTable())
+	for i, c := range chunks {
+		flag := uint32(0)
+		if c.Compressed {
+			flag = EWF_CHUNK_DATA_FLAG_IS_COMPRESSED
+		}
+		seg.addTableEntry(firstChunk+uint64(i), c.Offset, uint32(c.Size), flag)
+	}
+
+	last := chunks[len(chunks)-1]
+	for _, t := range seg.Tables {
+		t.fh = seg.fh
+		t.decompressorFunc = decompressorFunc
+		t.Segment = seg
+		// there is no table section, checksum errors of its chunks report where the chunk data ends
+		t.Section = &EWFSectionDescriptor{fh: seg.fh, offset: last.Offset + last.Size}
+		t.SectorCount = int64(t.Header.NumEntries) * int64(sc)
+		t.SectorOffset = -1 // uninitialized
+		t.Size = t.SectorCount * int64(ss)
 	}
 
-	seg.isDecoded = true
 	return nil
 }
 
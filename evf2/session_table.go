@@ -0,0 +1,200 @@
+package evf2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// EWFSessionTableSection lists the sessions and tracks of optical media by their first sector,
+// a session runs up to the next one.
+type EWFSessionTableSection struct {
+	Header  *EWFSessionTableSectionHeader
+	Entries []EWFSessionTableSectionEntry
+	Footer  *EWFSessionTableSectionFooter
+
+	// damaged is the checksum mismatch of the section, nil when the checksums match
+	damaged error
+}
+
+type EWFSessionTableSectionHeader struct {
+	NumEntries uint32
+	Unknown    [12]uint8
+	Checksum   uint32
+}
+
+type EWFSessionTableSectionEntry struct {
+	FirstSector uint64
+	Flags       uint32
+	Unknown     [20]uint8
+}
+
+type EWFSessionTableSectionFooter struct {
+	Checksum uint32
+}
+
+func (d *EWFSessionTableSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, segment *EWFSegment) error {
+	_, err := fh.Seek(section.DataOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	header := EWFSessionTableSectionHeader{}
+	err = binary.Read(fh, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	d.Header = &header
+
+	headerSize := binary.Size(header)
+	headerSize += calculatePadding(headerSize)
+	entrySize := int64(binary.Size(EWFSessionTableSectionEntry{}))
+	if int64(headerSize)+int64(header.NumEntries)*entrySize > int64(section.Size) {
+		return fmt.Errorf("session table at 0x%x has %d entries, more than the section holds", section.offset, header.NumEntries)
+	}
+
+	_, err = fh.Seek(section.DataOffset+int64(headerSize), io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	d.Entries = make([]EWFSessionTableSectionEntry, header.NumEntries)
+	err = binary.Read(fh, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return err
+	}
+
+	footer := EWFSessionTableSectionFooter{}
+	err = binary.Read(fh, binary.LittleEndian, &footer)
+	if err != nil {
+		return err
+	}
+	d.Footer = &footer
+
+	// sessions of a damaged section are not reported, strict mode fails to open the image
+	d.damaged = d.verifyChecksums(section, segment.EWFHeader.SegmentNumber)
+	if segment.strict {
+		return d.damaged
+	}
+
+	return nil
+}
+
+func (d *EWFSessionTableSection) Encode(ewf io.Writer, previousDescriptorPosition int64) (dataN int, descN int, err error) {
+	if d.Header == nil {
+		d.Header = &EWFSessionTableSectionHeader{}
+	}
+	if d.Footer == nil {
+		d.Footer = &EWFSessionTableSectionFooter{}
+	}
+	d.Header.NumEntries = uint32(len(d.Entries))
+
+	bbuf := bytes.NewBuffer(nil)
+	_, d.Header.Checksum, err = shared.WriteWithSum(bbuf, d.Header)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	headerPad, headerPaddingSize := alignSizeTo16Bytes(bbuf.Len())
+	_, err = bbuf.Write(headerPad)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	headerLen := bbuf.Len()
+	err = binary.Write(bbuf, binary.LittleEndian, d.Entries)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// only entries data
+	d.Footer.Checksum = adler32.Checksum(bbuf.Bytes()[headerLen:])
+	err = binary.Write(bbuf, binary.LittleEndian, d.Footer)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	footerPad, footerPaddingSize := alignSizeTo16Bytes(binary.Size(d.Footer))
+	_, err = bbuf.Write(footerPad)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dataN, err = ewf.Write(bbuf.Bytes())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_SESSION_TABLE)
+
+	desc.DataSize = uint64(dataN)
+	desc.PreviousOffset = uint64(previousDescriptorPosition)
+	desc.PaddingSize = uint32(headerPaddingSize + footerPaddingSize)
+
+	descN, desc.Checksum, err = shared.WriteWithSum(ewf, desc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return dataN, descN, nil
+}
+
+// verifyChecksums validates the checksums of the header and the entries
+func (d *EWFSessionTableSection) verifyChecksums(section *EWFSectionDescriptor, segmentNumber uint16) error {
+	sum, err := shared.Checksum(d.Header)
+	if err != nil {
+		return err
+	}
+	if sum != d.Header.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "session table header",
+			Stored:        d.Header.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, d.Entries); err != nil {
+		return err
+	}
+	sum = adler32.Checksum(buf.Bytes())
+	if sum != d.Footer.Checksum {
+		return &shared.ChecksumError{
+			Segment:       segmentNumber,
+			SectionOffset: section.offset,
+			Chunk:         -1,
+			Section:       "session table entries",
+			Stored:        d.Footer.Checksum,
+			Computed:      sum,
+		}
+	}
+
+	return nil
+}
+
+// Sessions returns the sessions of media with totalSectors sectors, an error when the section
+// is damaged
+func (d *EWFSessionTableSection) Sessions(totalSectors uint64) ([]shared.Session, error) {
+	if d.damaged != nil {
+		return nil, d.damaged
+	}
+
+	sessions := make([]shared.Session, 0, len(d.Entries))
+	for _, e := range d.Entries {
+		sessions = append(sessions, shared.Session{
+			Range: shared.SectorRange{First: e.FirstSector},
+			Flags: e.Flags,
+		})
+	}
+	if err := shared.SetSessionCounts(sessions, totalSectors); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
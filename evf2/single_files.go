@@ -0,0 +1,32 @@
+package evf2
+
+import (
+	"io"
+
+	"github.com/asalih/go-ewf/shared"
+)
+
+// EWFSingleFilesDataSection holds the single files data of a logical evidence container (Lx01),
+// the tree of the file entries whose data is stored in the sector data.
+type EWFSingleFilesDataSection struct {
+	// Data is the decompressed UTF-16 little-endian single files data
+	Data []byte
+}
+
+func (d *EWFSingleFilesDataSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor, decompressorFunc shared.Decompressor) error {
+	if _, err := fh.Seek(section.DataOffset, io.SeekStart); err != nil {
+		return err
+	}
+	rd := make([]byte, section.Size)
+	if _, err := io.ReadFull(fh, rd); err != nil {
+		return err
+	}
+
+	data, err := decompressorFunc(rd)
+	if err != nil {
+		return err
+	}
+	d.Data = data
+
+	return nil
+}
@@ -2,11 +2,13 @@ package evf2
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
 	"errors"
 	"hash/adler32"
 	"io"
 	"math"
+	"sync"
 
 	"github.com/asalih/go-ewf/shared"
 )
@@ -98,6 +100,9 @@ type EWFTableSection struct {
 	SectorOffset int64
 	Size         int64
 	Offset       int64
+
+	// entriesMu guards the lazy loading of the entries
+	entriesMu sync.Mutex
 }
 
 func newTable() *EWFTableSection {
@@ -123,6 +128,13 @@ func (d *EWFTableSection) Decode(fh io.ReadSeeker, section *EWFSectionDescriptor
 		return err
 	}
 
+	if segment.strict {
+		err = d.verifyChecksums()
+		if err != nil {
+			return err
+		}
+	}
+
 	sc, err := segment.CaseData.GetSectorCount()
 	if err != nil {
 		return err
@@ -193,53 +205,127 @@ func (t *EWFTableSection) readData() error {
 }
 
 func (t *EWFTableSection) getEntry(index int64) (entryPosition EWFTableSectionEntry, err error) {
-	if t.Header.NumEntries > 0 && len(t.Entries.Data) > 0 {
-		return t.Entries.Data[index], nil
-	}
-
-	cpos, err := t.fh.Seek(0, io.SeekCurrent)
+	err = t.loadEntries()
 	if err != nil {
 		return
 	}
-	defer func() {
-		// revert back to initial position
-		_, errs := t.fh.Seek(cpos, io.SeekStart)
-		if err == nil {
-			err = errs
-		}
-	}()
+	return t.Entries.Data[index], nil
+}
+
+// loadEntries reads the table entries once, concurrent reads of chunks wait for the first one
+func (t *EWFTableSection) loadEntries() error {
+	t.entriesMu.Lock()
+	defer t.entriesMu.Unlock()
+
+	if t.Header.NumEntries == 0 || len(t.Entries.Data) > 0 {
+		return nil
+	}
 
-	_, err = t.fh.Seek(t.Entries.position, io.SeekStart)
+	entries := make([]EWFTableSectionEntry, t.Header.NumEntries)
+	r := io.NewSectionReader(t.Segment.ra, t.Entries.position, int64(binary.Size(entries)))
+	if err := binary.Read(r, binary.LittleEndian, &entries); err != nil {
+		return err
+	}
+	t.Entries.Data = entries
+	return nil
+}
+
+// verifyChecksums validates the checksums of the table header and entries
+func (t *EWFTableSection) verifyChecksums() error {
+	sum, err := shared.Checksum(t.Header)
 	if err != nil {
-		return
+		return err
+	}
+	if sum != t.Header.Checksum {
+		return t.checksumError("table header", -1, t.Header.Checksum, sum)
 	}
 
-	t.Entries.Data = make([]EWFTableSectionEntry, t.Header.NumEntries)
-	err = binary.Read(t.fh, binary.LittleEndian, &t.Entries.Data)
+	err = t.loadEntries()
 	if err != nil {
-		return
+		return err
 	}
 
-	entryPosition = t.Entries.Data[index]
-	return
+	// entries are followed by their checksum
+	entriesSize := int64(binary.Size(t.Entries.Data))
+	if t.Entries.position+entriesSize+ChecksumSize > t.Section.DataOffset+int64(t.Section.Size) {
+		return nil
+	}
+
+	if _, err := t.fh.Seek(t.Entries.position+entriesSize, io.SeekStart); err != nil {
+		return err
+	}
+	footer := EWFTableSectionFooter{}
+	if err := binary.Read(t.fh, binary.LittleEndian, &footer); err != nil {
+		return err
+	}
+	t.Footer = &footer
+
+	buf := bytes.NewBuffer(nil)
+	if err := binary.Write(buf, binary.LittleEndian, t.Entries.Data); err != nil {
+		return err
+	}
+	sum = adler32.Checksum(buf.Bytes())
+	if sum != footer.Checksum {
+		return t.checksumError("table entries", -1, footer.Checksum, sum)
+	}
+
+	return nil
+}
+
+// checksumError describes a checksum mismatch of the table or of one of its chunks
+func (t *EWFTableSection) checksumError(section string, chunk int64, stored, computed uint32) error {
+	if chunk >= 0 {
+		// chunk index in the image
+		chunk += int64(t.Header.FirstChunkNumber)
+	}
+	return &shared.ChecksumError{
+		Segment:       t.Segment.EWFHeader.SegmentNumber,
+		SectionOffset: t.Section.offset,
+		Chunk:         chunk,
+		Section:       section,
+		Stored:        stored,
+		Computed:      computed,
+	}
 }
 
+// readChunk returns the data of the chunk at index chunk of the table, from the chunk cache
+// when the reader has one
 func (t *EWFTableSection) readChunk(chunk int64) ([]byte, error) {
-	if chunk < 0 || chunk >= int64(t.Header.NumEntries) {
-		return nil, errors.New("invalid chunk index")
+	if t.Segment.chunks == nil || chunk < 0 || chunk >= int64(t.Header.NumEntries) {
+		return t.decodeChunk(chunk)
 	}
 
-	entry, err := t.getEntry(chunk)
+	// FirstChunkNumber is not trusted as the key, a wrong one would return the data of another chunk
+	sc, err := t.Segment.CaseData.GetSectorCount()
+	if err != nil {
+		return nil, err
+	}
+	key := chunk + (t.Segment.sectorOffset+t.SectorOffset)/int64(sc)
+
+	if data, ok := t.Segment.chunks.Get(key); ok {
+		return data, nil
+	}
+	data, err := t.decodeChunk(chunk)
 	if err != nil {
 		return nil, err
 	}
+	t.Segment.chunks.Add(key, data)
+	return data, nil
+}
+
+// decodeChunk reads and decompresses the chunk at index chunk of the table
+func (t *EWFTableSection) decodeChunk(chunk int64) ([]byte, error) {
+	if chunk < 0 || chunk >= int64(t.Header.NumEntries) {
+		return nil, errors.New("invalid chunk index")
+	}
 
-	if _, err := t.fh.Seek(int64(entry.DataOffset), io.SeekStart); err != nil {
+	entry, err := t.getEntry(chunk)
+	if err != nil {
 		return nil, err
 	}
 
 	buf := make([]byte, entry.Size)
-	if _, err := io.ReadFull(t.fh, buf); err != nil {
+	if _, err := io.ReadFull(io.NewSectionReader(t.Segment.ra, int64(entry.DataOffset), int64(entry.Size)), buf); err != nil {
 		return nil, err
 	}
 
@@ -260,14 +346,27 @@ func (t *EWFTableSection) readChunk(chunk int64) ([]byte, error) {
 	}
 
 	if entry.DataFlags&EWF_CHUNK_DATA_FLAG_IS_COMPRESSED != 0 { // COMPRESSED
-		return t.decompressorFunc(buf)
+		data, err := t.decompressorFunc(buf)
+		if errors.Is(err, zlib.ErrChecksum) && t.Segment.strict {
+			// stored checksum is the last 4 bytes of the zlib stream
+			stored := binary.BigEndian.Uint32(buf[len(buf)-ChecksumSize:])
+			return nil, t.checksumError("chunk", chunk, stored, adler32.Checksum(data))
+		}
+		return data, err
 	}
 
 	if entry.DataFlags&EWF_CHUNK_DATA_FLAG_HAS_CHECKSUM != 0 { // CHECKSUM
 		if len(buf) <= ChecksumSize {
 			return buf, nil
 		}
-		return buf[:len(buf)-ChecksumSize], nil
+		data := buf[:len(buf)-ChecksumSize]
+		if t.Segment.strict {
+			stored := binary.LittleEndian.Uint32(buf[len(data):])
+			if sum := adler32.Checksum(data); sum != stored {
+				return nil, t.checksumError("chunk", chunk, stored, sum)
+			}
+		}
+		return data, nil
 	}
 
 	return buf, nil
@@ -310,9 +409,9 @@ func (ets *EWFTableSection) readSectors(sector uint64, count uint64) ([]byte, er
 		chunkRemainingSectors := uint64(chunkSectorCount) - sectorOffsetInChunk
 		tableSectors := uint64(math.Min(float64(chunkRemainingSectors), float64(count)))
 
-		// Global chunk number within the segment.
-		globalChunk := int64(curSector / uint64(chunkSectorCount))
-		entryIndex := globalChunk - int64(ets.Header.FirstChunkNumber)
+		// Chunk index within the table. FirstChunkNumber counts chunks from the start of
+		// the image, so it can not be used to locate entries of segments after the first one.
+		entryIndex := int64((curSector - uint64(ets.SectorOffset)) / uint64(chunkSectorCount))
 
 		chunkPos := sectorOffsetInChunk * uint64(sectorSize)
 
@@ -326,6 +425,9 @@ func (ets *EWFTableSection) readSectors(sector uint64, count uint64) ([]byte, er
 		if chunkEnd > uint64(len(buf)) {
 			chunkEnd = uint64(len(buf))
 		}
+		if chunkPos > chunkEnd {
+			chunkPos = chunkEnd
+		}
 
 		if chunkPos != 0 || tableSectors != uint64(chunkSectorCount) {
 			buf = buf[chunkPos:chunkEnd]
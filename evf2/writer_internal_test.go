@@ -2,10 +2,24 @@ package evf2
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/asalih/go-ewf/shared"
 )
 
 func TestEVF2WriterSplitsTablesAndReadsAcrossBoundary(t *testing.T) {
@@ -89,3 +103,1850 @@ func TestEVF2WriterSplitsTablesAndReadsAcrossBoundary(t *testing.T) {
 	}
 }
 
+
+func TestEVF2WriterRollsOverSegments(t *testing.T) {
+	// 40 chunks of incompressible data, a few chunks fit into a segment.
+	data := make([]byte, 40*DefaultChunkSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	tmpDir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(tmpDir, fmt.Sprintf("split.Ex%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+
+	const maxSegmentSize = 300 * 1024
+	creator.SetSegmentSize(maxSegmentSize, func(segmentNumber uint16) (io.Writer, error) {
+		return os.Create(segmentPath(segmentNumber))
+	})
+
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(tmpDir, "split.Ex*"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("expected at least 3 segments, got %d", len(paths))
+	}
+
+	fhs := make([]io.ReadSeeker, 0, len(paths))
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if st.Size() > maxSegmentSize {
+			t.Fatalf("segment %s exceeds maximum size: %d", p, st.Size())
+		}
+
+		rf, err := os.Open(p)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer rf.Close()
+		fhs = append(fhs, rf)
+	}
+
+	reader, err := OpenEWF(fhs...)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	for i := 0; i < len(paths); i++ {
+		seg, _, err := reader.Segment(i)
+		if err != nil {
+			t.Fatalf("Segment(%d): %v", i, err)
+		}
+		if got := int(seg.EWFHeader.SegmentNumber); got != i+1 {
+			t.Fatalf("segment number mismatch: got %d want %d", got, i+1)
+		}
+		if seg.EWFHeader.SetIdentifier != reader.First.EWFHeader.SetIdentifier {
+			t.Fatalf("segment %d has a different set identifier", i+1)
+		}
+		last := i == len(paths)-1
+		if (seg.Done != nil) != last || (seg.Next != nil) == last {
+			t.Fatalf("segment %d has unexpected next/done sections", i+1)
+		}
+		if (seg.MD5Hash != nil) != last || (seg.SHA1Hash != nil) != last {
+			t.Fatalf("segment %d has unexpected hash sections", i+1)
+		}
+	}
+}
+
+func TestEVF2WriterParallelCompression(t *testing.T) {
+	old := maxTableLength
+	maxTableLength = 16
+	defer func() { maxTableLength = old }()
+
+	// mix of compressible and random chunks so workers finish out of order
+	data := make([]byte, 64*DefaultChunkSize)
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < len(data); i += DefaultChunkSize {
+		if (i/DefaultChunkSize)%3 == 0 {
+			rnd.Read(data[i : i+DefaultChunkSize])
+		}
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "parallel.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	// the in flight limit has to hold a chunk
+	if err := creator.SetCompressionWorkers(4, DefaultChunkSize-1); err == nil {
+		t.Fatalf("expected an error for an in flight limit below one chunk")
+	}
+	if err := creator.SetCompressionWorkers(4, 6*DefaultChunkSize); err != nil {
+		t.Fatalf("SetCompressionWorkers: %v", err)
+	}
+
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	// odd write sizes so chunks are cut from the middle of writes
+	for off := 0; off < len(data); off += 10000 {
+		end := off + 10000
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[off:end]); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWF(rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	if md5.Sum(data) != reader.First.MD5Hash.Hash {
+		t.Fatalf("stored MD5 does not match the written data")
+	}
+	if sha1.Sum(data) != reader.First.SHA1Hash.Hash {
+		t.Fatalf("stored SHA1 does not match the written data")
+	}
+}
+
+// fullDestination fails writes once limit bytes are written
+type fullDestination struct {
+	io.Writer
+	limit int
+}
+
+func (d *fullDestination) Write(p []byte) (int, error) {
+	if len(p) > d.limit {
+		return 0, errors.New("no space left")
+	}
+	d.limit -= len(p)
+	return d.Writer.Write(p)
+}
+
+func TestEVF2WriterStopsWorkersOnWriteError(t *testing.T) {
+	data := make([]byte, 32*DefaultChunkSize)
+	rand.New(rand.NewSource(21)).Read(data)
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "full.Ex01"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	creator, err := CreateEWF(&fullDestination{f, 8 * DefaultChunkSize})
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	if err := creator.SetCompressionWorkers(4, 0); err != nil {
+		t.Fatalf("SetCompressionWorkers: %v", err)
+	}
+
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	_, writeErr := w.Write(data)
+	if writeErr == nil {
+		t.Fatalf("expected the write to fail")
+	}
+	// the writer is given up, nothing else stops the workers
+	if w.pipeline != nil {
+		t.Fatalf("compression workers still running after a failed write")
+	}
+	if _, err := w.Write(data[:1]); err != writeErr {
+		t.Fatalf("write after a failure: got %v, want %v", err, writeErr)
+	}
+	if err := w.Close(); err != writeErr {
+		t.Fatalf("Close after a failure: got %v, want %v", err, writeErr)
+	}
+}
+
+func TestEVF2WriterSectorGeometry(t *testing.T) {
+	const bytesPerSector, sectorsPerChunk = 4096, 128
+	chunkSize := bytesPerSector * sectorsPerChunk
+
+	data := make([]byte, 3*chunkSize)
+	rnd := rand.New(rand.NewSource(3))
+	rnd.Read(data[:chunkSize])
+	for i := chunkSize; i < len(data); i++ {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "4kn.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSectorGeometry(bytesPerSector, sectorsPerChunk)
+
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := w.Write([]byte{0}); err == nil {
+		t.Fatalf("expected write beyond the total size to fail")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWF(rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	devInfo := reader.First.DeviceInformation.KeyValue
+	if got := devInfo[string(EWF_DEVICE_INFO_BYTES_PER_SEC)]; got != "4096" {
+		t.Fatalf("bp mismatch: got %q", got)
+	}
+	if got := devInfo[string(EWF_DEVICE_INFO_NUMBER_OF_SECTORS)]; got != "384" {
+		t.Fatalf("ts mismatch: got %q", got)
+	}
+	if got := reader.First.CaseData.KeyValue[string(EWF_CASE_DATA_NUMBER_OF_SECTORS_PC)]; got != "128" {
+		t.Fatalf("sb mismatch: got %q", got)
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+}
+
+func TestEVF2WriterStoresShortLastChunk(t *testing.T) {
+	// neither chunk nor sector aligned
+	data := make([]byte, 2*DefaultChunkSize+1000)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "short.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWF(rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+
+	wantSectors := fmt.Sprint((len(data) + DefaultSectorSize - 1) / DefaultSectorSize)
+	if got := reader.First.DeviceInformation.KeyValue[string(EWF_DEVICE_INFO_NUMBER_OF_SECTORS)]; got != wantSectors {
+		t.Fatalf("ts mismatch: got %q want %q", got, wantSectors)
+	}
+
+	last, err := reader.First.Tables[0].readChunk(2)
+	if err != nil {
+		t.Fatalf("readChunk: %v", err)
+	}
+	// the stored chunk fills up the last sector, the device information records the size of the source
+	if len(last) != 1024 {
+		t.Fatalf("last chunk size mismatch: got %d want 1024", len(last))
+	}
+	if got := reader.First.DeviceInformation.KeyValue[string(EWF_DEVICE_INFO_MEDIA_SIZE)]; got != fmt.Sprint(len(data)) {
+		t.Fatalf("ms mismatch: got %q want %d", got, len(data))
+	}
+	if reader.Size() != int64(len(data)) {
+		t.Fatalf("size mismatch: got %d want %d", reader.Size(), len(data))
+	}
+
+	wantMD5 := md5.Sum(data)
+	wantSHA1 := sha1.Sum(data)
+	if reader.First.MD5Hash.Hash != wantMD5 || reader.First.SHA1Hash.Hash != wantSHA1 {
+		t.Fatalf("hashes do not match the source data")
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	// fewer bytes than given to Start
+	creator, err = CreateEWF(io.Discard)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err = creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := w.Write(data[:DefaultChunkSize]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatalf("expected Close to fail when less than the total size is written")
+	}
+}
+
+func TestEVF2VerifyHashes(t *testing.T) {
+	// random data is stored uncompressed so it can be altered in place
+	data := make([]byte, 3*DefaultChunkSize+700)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	ewfPath := filepath.Join(t.TempDir(), "verify.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	verify := func() *shared.HashVerification {
+		rf, err := os.Open(ewfPath)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		defer rf.Close()
+
+		reader, err := OpenEWF(rf)
+		if err != nil {
+			t.Fatalf("OpenEWF: %v", err)
+		}
+
+		result, err := reader.VerifyHashes(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("VerifyHashes: %v", err)
+		}
+		if result.BytesRead != int64(len(data)) {
+			t.Fatalf("read %d bytes, want %d", result.BytesRead, len(data))
+		}
+		return result
+	}
+
+	result := verify()
+	if !result.MD5.Match() || !result.SHA1.Match() || result.Mismatch() {
+		t.Fatalf("stored hashes do not match: %+v", result)
+	}
+
+	raw, err := os.ReadFile(ewfPath)
+	if err != nil {
+		t.Fatalf("read file: %v", err)
+	}
+	idx := bytes.Index(raw, data[:64])
+	if idx < 0 {
+		t.Fatalf("chunk data not found in the image")
+	}
+	raw[idx] ^= 0xff
+	if err := os.WriteFile(ewfPath, raw, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	result = verify()
+	if !result.Mismatch() || result.MD5.Match() || result.SHA1.Match() {
+		t.Fatalf("expected a hash mismatch: %+v", result)
+	}
+}
+
+func TestEVF2StrictChecksums(t *testing.T) {
+	data := make([]byte, 4*DefaultChunkSize+100)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	dir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(dir, fmt.Sprintf("strict.Ex%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	// compressed chunks are small, a few of them fit into a segment
+	creator.SetSegmentSize(2048, func(n uint16) (io.Writer, error) {
+		return os.Create(segmentPath(n))
+	})
+
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	open := func(strict bool) (*EWFReader, error) {
+		var fhs []io.ReadSeeker
+		for n := uint16(1); ; n++ {
+			fh, err := os.Open(segmentPath(n))
+			if os.IsNotExist(err) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { fh.Close() })
+			fhs = append(fhs, fh)
+		}
+		if len(fhs) < 2 {
+			t.Fatalf("expected multiple segments, got %d", len(fhs))
+		}
+		return OpenEWFWithOptions(shared.OpenOptions{Strict: strict}, fhs...)
+	}
+	corrupt := func(n uint16, off int64) {
+		raw, err := os.ReadFile(segmentPath(n))
+		if err != nil {
+			t.Fatalf("read file: %v", err)
+		}
+		raw[off] ^= 0xff
+		if err := os.WriteFile(segmentPath(n), raw, 0o644); err != nil {
+			t.Fatalf("write file: %v", err)
+		}
+	}
+
+	reader, err := open(true)
+	if err != nil {
+		t.Fatalf("strict open of a valid image: %v", err)
+	}
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("strict read of a valid image: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	seg, _, err := reader.Segment(1)
+	if err != nil {
+		t.Fatalf("Segment: %v", err)
+	}
+	table := seg.Tables[0]
+	entry, err := table.getEntry(0)
+	if err != nil {
+		t.Fatalf("getEntry: %v", err)
+	}
+	if entry.DataFlags&EWF_CHUNK_DATA_FLAG_IS_COMPRESSED == 0 {
+		t.Fatalf("expected a compressed chunk")
+	}
+	tableOffset := table.Section.offset
+
+	// last byte of the zlib stream is part of its Adler-32 checksum
+	corrupt(2, int64(entry.DataOffset)+int64(entry.Size)-1)
+
+	reader, err = open(true)
+	if err != nil {
+		t.Fatalf("strict open with a corrupt chunk: %v", err)
+	}
+	_, err = io.ReadFull(reader, readAll)
+	var csErr *shared.ChecksumError
+	if !errors.As(err, &csErr) {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+	if csErr.Segment != 2 || csErr.Chunk != int64(table.Header.FirstChunkNumber) || csErr.SectionOffset != tableOffset || csErr.Section != "chunk" {
+		t.Fatalf("unexpected checksum error: %+v", csErr)
+	}
+
+	// checksum of the table header
+	corrupt(2, table.Section.DataOffset+16)
+	if _, err := open(false); err != nil {
+		t.Fatalf("lenient open with a corrupt table: %v", err)
+	}
+	_, err = open(true)
+	if !errors.As(err, &csErr) || csErr.Section != "table header" || csErr.SectionOffset != tableOffset {
+		t.Fatalf("expected a table header checksum error, got %v", err)
+	}
+
+	// checksum of the case data section descriptor
+	var caseDataOffset int64 = -1
+	for _, desc := range reader.First.SectionDescriptors {
+		if desc.Type == EWF_SECTION_TYPE_CASE_DATA {
+			caseDataOffset = desc.offset
+		}
+	}
+	corrupt(1, caseDataOffset+DescriptorSize-1)
+	_, err = open(true)
+	if !errors.As(err, &csErr) || csErr.Section != "section descriptor" || csErr.Segment != 1 || csErr.SectionOffset != caseDataOffset {
+		t.Fatalf("expected a descriptor checksum error, got %v", err)
+	}
+}
+
+func TestEVF2ErrorTableRoundTrip(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "error_table.bin"))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	errorTable := &EWFErrorTableSection{Entries: []EWFErrorTableSectionEntry{
+		{FirstSector: 100, SectorCount: 8},
+		{FirstSector: 1 << 33, SectorCount: 1},
+	}}
+	dataN, _, err := errorTable.Encode(f, 0)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if dataN%16 != 0 {
+		t.Fatalf("section data is not 16 byte aligned: %d bytes", dataN)
+	}
+
+	// the descriptor follows the section data
+	if _, err := f.Seek(int64(dataN), io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	section, err := NewEWFSectionDescriptor(f)
+	if err != nil {
+		t.Fatalf("NewEWFSectionDescriptor: %v", err)
+	}
+	if section.Type != EWF_SECTION_TYPE_ERROR_TABLE || section.DataOffset != 0 {
+		t.Fatalf("unexpected section %v", section)
+	}
+
+	seg := &EWFSegment{EWFHeader: &EWFHeader{SegmentNumber: 1}, strict: true}
+	decoded := new(EWFErrorTableSection)
+	if err := decoded.Decode(f, section, seg); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	ranges, err := decoded.Ranges()
+	if err != nil {
+		t.Fatalf("Ranges: %v", err)
+	}
+	want := []shared.SectorRange{{First: 100, Count: 8}, {First: 1 << 33, Count: 1}}
+	if len(ranges) != len(want) {
+		t.Fatalf("got ranges %+v, want %+v", ranges, want)
+	}
+	for i := range want {
+		if ranges[i] != want[i] {
+			t.Fatalf("got ranges %+v, want %+v", ranges, want)
+		}
+	}
+
+	// corrupt the first entry, the entries checksum no longer matches
+	if _, err := f.WriteAt([]byte{0xff}, 32); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var csErr *shared.ChecksumError
+	if err := new(EWFErrorTableSection).Decode(f, section, seg); !errors.As(err, &csErr) || csErr.Section != "error table entries" {
+		t.Fatalf("expected an error table entries checksum error, got %v", err)
+	}
+
+	// lenient mode opens the section but does not report its ranges
+	seg.strict = false
+	damaged := new(EWFErrorTableSection)
+	if err := damaged.Decode(f, section, seg); err != nil {
+		t.Fatalf("lenient Decode: %v", err)
+	}
+	if _, err := damaged.Ranges(); !errors.As(err, &csErr) {
+		t.Fatalf("expected a checksum error from Ranges, got %v", err)
+	}
+}
+
+func TestEVF2UnreadableSectorErrors(t *testing.T) {
+	data := make([]byte, 3*DefaultChunkSize)
+	rand.New(rand.NewSource(5)).Read(data)
+
+	ewfPath := filepath.Join(t.TempDir(), "unreadable.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+	reader, err := OpenEWFWithOptions(shared.OpenOptions{UnreadableSectorErrors: true}, rf)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	if ranges, err := reader.Errors(); err != nil || len(ranges) != 0 {
+		t.Fatalf("unexpected errors of an image without error table: %v, %v", ranges, err)
+	}
+
+	// ranges as decoded from an error table
+	bad := shared.SectorRange{First: 70, Count: 2}
+	reader.unreadable = []shared.SectorRange{bad}
+
+	buf := make([]byte, 4*DefaultSectorSize)
+	n, err := reader.ReadAt(buf, 68*DefaultSectorSize)
+	var usErr *shared.UnreadableSectorError
+	if !errors.Is(err, shared.ErrUnreadableSector) || !errors.As(err, &usErr) || usErr.Range != bad {
+		t.Fatalf("expected an unreadable sector error, got %v", err)
+	}
+	if n != 2*DefaultSectorSize || !bytes.Equal(buf[:n], data[68*DefaultSectorSize:70*DefaultSectorSize]) {
+		t.Fatalf("read %d bytes before the unreadable sector, want %d", n, 2*DefaultSectorSize)
+	}
+
+	if n, err := reader.ReadAt(buf, 71*DefaultSectorSize+10); n != 0 || !errors.Is(err, shared.ErrUnreadableSector) {
+		t.Fatalf("expected an unreadable sector error without data, got %d, %v", n, err)
+	}
+	if _, err := reader.ReadAt(buf, 72*DefaultSectorSize); err != nil {
+		t.Fatalf("read after the unreadable sectors: %v", err)
+	}
+
+	// hashes are verified over the stored data
+	result, err := reader.VerifyHashes(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("VerifyHashes: %v", err)
+	}
+	if result.Mismatch() {
+		t.Fatalf("stored hashes do not match: %+v", result)
+	}
+}
+
+// flakyReader fails reads touching a sector until the sector has failed its number of times,
+// a negative number fails forever
+type flakyReader struct {
+	data       []byte
+	sectorSize int64
+	failures   map[int64]int
+}
+
+func (r *flakyReader) ReadAt(p []byte, off int64) (int, error) {
+	var err error
+	for s := off / r.sectorSize; s*r.sectorSize < off+int64(len(p)); s++ {
+		if left, ok := r.failures[s]; ok && left != 0 {
+			r.failures[s] = left - 1
+			err = fmt.Errorf("unreadable sector %d", s)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	n := copy(p, r.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func TestEVF2ErrorTableSize(t *testing.T) {
+	// the second range is split into three entries
+	w := &EWFWriter{unreadable: []shared.SectorRange{
+		{First: 100, Count: 8},
+		{First: 1 << 20, Count: 2*math.MaxUint32 + 5},
+	}}
+	errorTable := w.errorTableSection()
+	if len(errorTable.Entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(errorTable.Entries))
+	}
+
+	dataN, descN, err := errorTable.Encode(bytes.NewBuffer(nil), 0)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if size := w.errorTableSize(); size != int64(dataN+descN) {
+		t.Fatalf("errorTableSize %d, encoded %d bytes", size, dataN+descN)
+	}
+}
+
+func TestEVF2WriterAcquireWritesErrorTable(t *testing.T) {
+	data := make([]byte, 4*DefaultChunkSize+300)
+	rand.New(rand.NewSource(6)).Read(data)
+	lastSector := int64(len(data)) / DefaultSectorSize
+
+	cases := []struct {
+		name        string
+		granularity uint32
+		failures    map[int64]int
+		want        []shared.SectorRange
+		wantGr      string
+	}{
+		{
+			name:        "sectors",
+			granularity: 1,
+			// sector 5 reads on the last retry
+			failures: map[int64]int{5: 2, 20: -1, 21: -1, 150: -1, lastSector: -1},
+			want:     []shared.SectorRange{{First: 20, Count: 2}, {First: 150, Count: 1}, {First: uint64(lastSector), Count: 1}},
+			wantGr:   "1",
+		},
+		{
+			name:     "chunks",
+			failures: map[int64]int{100: -1},
+			want:     []shared.SectorRange{{First: 64, Count: 64}},
+			wantGr:   "64",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &flakyReader{data: data, sectorSize: DefaultSectorSize, failures: tc.failures}
+
+			expected := append([]byte(nil), data...)
+			for _, r := range tc.want {
+				start := int64(r.First) * DefaultSectorSize
+				end := shared.MinInt64(int64(r.First+r.Count)*DefaultSectorSize, int64(len(expected)))
+				copy(expected[start:end], make([]byte, end-start))
+			}
+
+			ewfPath := filepath.Join(t.TempDir(), "acquire.Ex01")
+			f, err := os.Create(ewfPath)
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			creator, err := CreateEWF(f)
+			if err != nil {
+				t.Fatalf("CreateEWF: %v", err)
+			}
+			creator.SetErrorGranularity(tc.granularity)
+			creator.SetReadRetries(2)
+			w, err := creator.Start(int64(len(data)))
+			if err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			if err := w.Acquire(context.Background(), src, int64(len(data)), nil); err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			if err := f.Close(); err != nil {
+				t.Fatalf("file close: %v", err)
+			}
+
+			rf, err := os.Open(ewfPath)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			defer rf.Close()
+			reader, err := OpenEWFWithOptions(shared.OpenOptions{Strict: true}, rf)
+			if err != nil {
+				t.Fatalf("OpenEWF: %v", err)
+			}
+
+			ranges, err := reader.Errors()
+			if err != nil {
+				t.Fatalf("Errors: %v", err)
+			}
+			if len(ranges) != len(tc.want) {
+				t.Fatalf("got ranges %+v, want %+v", ranges, tc.want)
+			}
+			for i := range tc.want {
+				if ranges[i] != tc.want[i] {
+					t.Fatalf("got ranges %+v, want %+v", ranges, tc.want)
+				}
+			}
+
+			if gr := reader.First.CaseData.KeyValue[string(EWF_CASE_DATA_ERROR_GRANULARITY)]; gr != tc.wantGr {
+				t.Fatalf("error granularity is %q, want %q", gr, tc.wantGr)
+			}
+
+			// the error table is written before the hash sections
+			errorTableIdx, md5Idx := -1, -1
+			for i, desc := range reader.First.SectionDescriptors {
+				switch desc.Type {
+				case EWF_SECTION_TYPE_ERROR_TABLE:
+					errorTableIdx = i
+				case EWF_SECTION_TYPE_MD5_HASH:
+					md5Idx = i
+				}
+			}
+			if errorTableIdx < 0 || errorTableIdx > md5Idx {
+				t.Fatalf("error table at section %d, md5 hash at %d", errorTableIdx, md5Idx)
+			}
+
+			readAll := make([]byte, len(data))
+			if _, err := io.ReadFull(reader, readAll); err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if !bytes.Equal(expected, readAll) {
+				t.Fatalf("data mismatch, unreadable sectors are not zero filled")
+			}
+
+			result, err := reader.VerifyHashes(context.Background(), nil)
+			if err != nil {
+				t.Fatalf("VerifyHashes: %v", err)
+			}
+			md5Sum := md5.Sum(expected)
+			if result.Mismatch() || !bytes.Equal(result.MD5.Stored, md5Sum[:]) {
+				t.Fatalf("unexpected hash verification: %+v", result)
+			}
+		})
+	}
+}
+
+func TestEVF2WriterErrorGranularityMustDivideChunk(t *testing.T) {
+	creator, err := CreateEWF(io.Discard)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetErrorGranularity(48)
+	if _, err := creator.Start(DefaultChunkSize); err == nil {
+		t.Fatalf("expected an error for a granularity that does not divide the chunk")
+	}
+}
+
+func TestEVF2WriterSessions(t *testing.T) {
+	const bytesPerSector, sectorsPerChunk = 2048, 16
+	data := make([]byte, 100*bytesPerSector)
+	for i := range data {
+		data[i] = byte((i * 131) % 251)
+	}
+
+	ewfPath := filepath.Join(t.TempDir(), "cd.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSectorGeometry(bytesPerSector, sectorsPerChunk)
+	creator.AddDeviceInformation(EWF_DEVICE_INFO_DRIVE_TYPE, EWF_DRIVE_TYPE_OPTICAL)
+	creator.SetSessions([]shared.Session{
+		{Range: shared.SectorRange{First: 0}, Flags: shared.SessionFlagAudioTrack},
+		{Range: shared.SectorRange{First: 40}},
+	})
+
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	reader, err := OpenEWFWithOptions(shared.OpenOptions{Strict: true}, rf)
+	if err != nil {
+		t.Fatalf("OpenEWFWithOptions: %v", err)
+	}
+
+	sessions, err := reader.Sessions()
+	if err != nil {
+		t.Fatalf("Sessions: %v", err)
+	}
+	want := []shared.Session{
+		{Range: shared.SectorRange{First: 0, Count: 40}, Flags: shared.SessionFlagAudioTrack},
+		{Range: shared.SectorRange{First: 40, Count: 60}},
+	}
+	if len(sessions) != len(want) {
+		t.Fatalf("got %d sessions, want %d", len(sessions), len(want))
+	}
+	for i := range want {
+		if sessions[i] != want[i] {
+			t.Fatalf("session %d: got %+v, want %+v", i, sessions[i], want[i])
+		}
+	}
+
+	readAll := make([]byte, len(data))
+	if _, err := io.ReadFull(reader, readAll); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if !bytes.Equal(data, readAll) {
+		t.Fatalf("data mismatch after full read")
+	}
+
+	for name, sessions := range map[string][]shared.Session{
+		"unordered":   {{Range: shared.SectorRange{First: 40}}, {Range: shared.SectorRange{First: 0}}},
+		"beyond data": {{Range: shared.SectorRange{First: 100}}},
+	} {
+		creator, err := CreateEWF(io.Discard)
+		if err != nil {
+			t.Fatalf("CreateEWF: %v", err)
+		}
+		creator.SetSectorGeometry(bytesPerSector, sectorsPerChunk)
+		creator.AddDeviceInformation(EWF_DEVICE_INFO_DRIVE_TYPE, EWF_DRIVE_TYPE_OPTICAL)
+		creator.SetSessions(sessions)
+		if _, err := creator.Start(int64(len(data))); err == nil {
+			t.Fatalf("%s: expected Start to fail", name)
+		}
+	}
+
+	creator, err = CreateEWF(io.Discard)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSessions([]shared.Session{{Range: shared.SectorRange{First: 0}}})
+	if _, err := creator.Start(int64(len(data))); err == nil {
+		t.Fatalf("expected Start to fail with sessions for a fixed drive")
+	}
+}
+
+// encodeSingleFiles writes data zlib compressed as a single files data section with its descriptor.
+// Returns data write count, descriptor write count and err
+func encodeSingleFiles(w io.Writer, data []byte, previousDescriptorPosition int64) (dataN int, descN int, err error) {
+	comp, err := shared.NewZlibCompressor()
+	if err != nil {
+		return 0, 0, err
+	}
+	compressed, err := comp.Compress(data)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	compressed, paddingSize := alignTo16Bytes(compressed)
+
+	dataN, err = w.Write(compressed)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	desc := NewEWFSectionDescriptorData(EWF_SECTION_TYPE_SINGLE_FILES_DATA)
+	desc.DataSize = uint64(len(compressed))
+	desc.PreviousOffset = uint64(previousDescriptorPosition)
+	desc.PaddingSize = uint32(paddingSize)
+
+	descN, desc.Checksum, err = shared.WriteWithSum(w, desc)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return dataN, descN, nil
+}
+
+// writeLogicalFixture writes media as an Lx01 with the given single files text
+func writeLogicalFixture(t *testing.T, ewfPath string, media []byte, singleFiles string) {
+	t.Helper()
+
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	defer f.Close()
+
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.AddDeviceInformation(EWF_DEVICE_INFO_DRIVE_TYPE, EWF_DRIVE_TYPE_LOGICAL)
+	w, err := creator.Start(int64(len(media)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := w.Write(media); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// the single files data section goes in front of the done section
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	reader, err := OpenEWF(f)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	descs := reader.First.SectionDescriptors
+	done := descs[len(descs)-1]
+	if done.Type != EWF_SECTION_TYPE_DONE {
+		t.Fatalf("last section is %v", done.Type)
+	}
+	if err := f.Truncate(done.offset); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	if _, err := f.Seek(done.offset, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+
+	u16 := shared.UTF8ToUTF16([]byte(singleFiles))
+	dataN, _, err := encodeSingleFiles(f, u16, int64(done.Previous))
+	if err != nil {
+		t.Fatalf("single files Encode: %v", err)
+	}
+	if _, _, err := new(EWFDoneSection).Encode(f, done.offset+int64(dataN)); err != nil {
+		t.Fatalf("done Encode: %v", err)
+	}
+
+	if _, err := f.WriteAt([]byte(LVF2Signature), 0); err != nil {
+		t.Fatalf("write signature: %v", err)
+	}
+}
+
+// checkLogicalFiles checks that logical holds the files with their data and modification time.
+// The Sys of a file is the *shared.LogicalEntry whose hashes and other times it is expected to
+// be recorded with, stored hashes have to match the data of files without one.
+func checkLogicalFiles(t *testing.T, logical *LogicalReader, files fstest.MapFS) {
+	t.Helper()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	if err := fstest.TestFS(logical, names...); err != nil {
+		t.Fatalf("TestFS: %v", err)
+	}
+
+	for name, file := range files {
+		got, err := fs.ReadFile(logical, name)
+		if err != nil {
+			t.Fatalf("ReadFile %s: %v", name, err)
+		}
+		if !bytes.Equal(got, file.Data) {
+			t.Fatalf("%s: data mismatch", name)
+		}
+
+		entry, err := logical.Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup %s: %v", name, err)
+		}
+		if entry.IsDir || entry.Size != int64(len(file.Data)) {
+			t.Fatalf("%s: unexpected entry %+v", name, entry)
+		}
+		if !entry.ModTime.Equal(file.ModTime) {
+			t.Fatalf("%s: mod time %v, want %v", name, entry.ModTime, file.ModTime)
+		}
+
+		want, ok := file.Sys.(*shared.LogicalEntry)
+		if !ok {
+			if md5Hash := fmt.Sprintf("%x", md5.Sum(file.Data)); entry.MD5 != "" && entry.MD5 != md5Hash {
+				t.Fatalf("%s: MD5 %q, want %q", name, entry.MD5, md5Hash)
+			}
+			if sha1Hash := fmt.Sprintf("%x", sha1.Sum(file.Data)); entry.SHA1 != "" && entry.SHA1 != sha1Hash {
+				t.Fatalf("%s: SHA1 %q, want %q", name, entry.SHA1, sha1Hash)
+			}
+			continue
+		}
+		if entry.MD5 != want.MD5 || entry.SHA1 != want.SHA1 {
+			t.Fatalf("%s: hashes %q %q, want %q %q", name, entry.MD5, entry.SHA1, want.MD5, want.SHA1)
+		}
+		if !entry.CreationTime.Equal(want.CreationTime) || !entry.AccessTime.Equal(want.AccessTime) ||
+			!entry.ChangeTime.Equal(want.ChangeTime) {
+			t.Fatalf("%s: creation, access and change time %v %v %v, want %v %v %v", name,
+				entry.CreationTime, entry.AccessTime, entry.ChangeTime, want.CreationTime, want.AccessTime, want.ChangeTime)
+		}
+	}
+}
+
+func TestEVF2LogicalReader(t *testing.T) {
+	// file data spans chunks
+	photo := make([]byte, DefaultChunkSize+100)
+	rand.New(rand.NewSource(17)).Read(photo)
+	readme := []byte("hello world\n")
+	media := append(append([]byte(nil), photo...), readme...)
+
+	photoMD5 := md5.Sum(photo)
+	photoSHA1 := sha1.Sum(photo)
+	types := "p\tn\tid\topr\tsrc\tsub\tcid\tls\tbe\tlo\tpo\tha\tsha\tmo\tcr\twr\tac\tdl"
+	singleFiles := strings.Join([]string{
+		"5",
+		"rec",
+		"tb\tcl",
+		fmt.Sprintf("%d\t1", len(media)),
+		"",
+		"entry",
+		"4\t1",
+		types,
+		"0\t1",
+		"1\t\t1\t0\t1\t0\t0\t0\t\t\t\t\t\t0\t0\t0\t0\t0",
+		"0\t2",
+		"1\tPictures\t2\t0\t1\t0\t0\t0\t\t\t\t\t\t1600000000\t1500000000\t1600000000\t1650000000\t0",
+		"0\t0",
+		fmt.Sprintf("0\tphoto.jpg\t3\t0\t1\t0\t0\t%d\t1 0 %x\t\t\t%x\t%x\t1600000100\t1500000100\t1600000200\t1650000100\t0", len(photo), len(photo), photoMD5, photoSHA1),
+		"0\t0",
+		fmt.Sprintf("0\treadme.txt\t4\t0\t1\t0\t0\t%d\t1 %x %x\t\t\t\t\t0\t0\t1600000300\t0\t0", len(readme), len(photo), len(readme)),
+		"",
+	}, "\n")
+
+	ewfPath := filepath.Join(t.TempDir(), "files.Lx01")
+	writeLogicalFixture(t, ewfPath, media, singleFiles)
+
+	rf, err := os.Open(ewfPath)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer rf.Close()
+
+	logical, err := OpenLogicalWithOptions(shared.OpenOptions{Strict: true}, rf)
+	if err != nil {
+		t.Fatalf("OpenLogicalWithOptions: %v", err)
+	}
+
+	checkLogicalFiles(t, logical, fstest.MapFS{
+		"Pictures/photo.jpg": {Data: photo, ModTime: time.Unix(1600000200, 0), Sys: &shared.LogicalEntry{
+			MD5:          fmt.Sprintf("%x", photoMD5),
+			SHA1:         fmt.Sprintf("%x", photoSHA1),
+			CreationTime: time.Unix(1500000100, 0),
+			AccessTime:   time.Unix(1650000100, 0),
+			ChangeTime:   time.Unix(1600000100, 0),
+		}},
+		"Pictures/readme.txt": {Data: readme, ModTime: time.Unix(1600000300, 0), Sys: &shared.LogicalEntry{}},
+	})
+
+	// disk images are not logical evidence
+	disk := bytes.NewBuffer(nil)
+	creator, err := CreateEWF(disk)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start(int64(len(media)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := w.Write(media); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := OpenLogical(bytes.NewReader(disk.Bytes())); !errors.Is(err, ErrNotLogical) {
+		t.Fatalf("expected ErrNotLogical, got %v", err)
+	}
+}
+
+func TestEVF2ChunkCache(t *testing.T) {
+	data := make([]byte, 4*DefaultChunkSize)
+	rand.New(rand.NewSource(19)).Read(data)
+
+	ewfPath := filepath.Join(t.TempDir(), "cache.Ex01")
+	f, err := os.Create(ewfPath)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	defer f.Close()
+
+	reader, err := OpenEWFWithOptions(shared.OpenOptions{ChunkCacheSize: 2}, f)
+	if err != nil {
+		t.Fatalf("OpenEWFWithOptions: %v", err)
+	}
+	// opening reads the last chunk to find the media size
+	base := reader.ChunkCacheStats()
+
+	readAt := func(off int64, size int) {
+		t.Helper()
+		buf := make([]byte, size)
+		if _, err := reader.ReadAt(buf, off); err != nil {
+			t.Fatalf("ReadAt(%d): %v", off, err)
+		}
+		if !bytes.Equal(buf, data[off:off+int64(size)]) {
+			t.Fatalf("data mismatch at %d", off)
+		}
+	}
+	stats := func() shared.ChunkCacheStats {
+		s := reader.ChunkCacheStats()
+		return shared.ChunkCacheStats{Hits: s.Hits - base.Hits, Misses: s.Misses - base.Misses}
+	}
+
+	// small reads of one chunk decompress it once
+	for off := int64(0); off < DefaultChunkSize; off += 512 {
+		readAt(off, 512)
+	}
+	if got, want := stats(), (shared.ChunkCacheStats{Hits: DefaultChunkSize/512 - 1, Misses: 1}); got != want {
+		t.Fatalf("stats after reading chunk 0: %+v, want %+v", got, want)
+	}
+
+	// chunks 1 and 2 evict chunk 0, chunk 2 stays cached
+	readAt(DefaultChunkSize, 512)
+	readAt(2*DefaultChunkSize, 512)
+	readAt(0, 512)
+	readAt(2*DefaultChunkSize+512, 512)
+	if got, want := stats(), (shared.ChunkCacheStats{Hits: DefaultChunkSize / 512, Misses: 4}); got != want {
+		t.Fatalf("stats after eviction: %+v, want %+v", got, want)
+	}
+
+	// a read across a chunk boundary finds chunk 0 and reads chunk 1
+	readAt(DefaultChunkSize-256, 512)
+	if got, want := stats(), (shared.ChunkCacheStats{Hits: DefaultChunkSize/512 + 1, Misses: 5}); got != want {
+		t.Fatalf("stats after boundary read: %+v, want %+v", got, want)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("seek: %v", err)
+	}
+	uncached, err := OpenEWF(f)
+	if err != nil {
+		t.Fatalf("OpenEWF: %v", err)
+	}
+	buf := make([]byte, 512)
+	if _, err := uncached.ReadAt(buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if s := uncached.ChunkCacheStats(); s != (shared.ChunkCacheStats{}) {
+		t.Fatalf("reader without a cache counted %+v", s)
+	}
+}
+
+// onlyReadSeeker hides the io.ReaderAt of a file
+type onlyReadSeeker struct {
+	io.ReadSeeker
+}
+
+func TestEVF2ConcurrentReadAt(t *testing.T) {
+	data := make([]byte, 12*DefaultChunkSize)
+	rand.New(rand.NewSource(20)).Read(data)
+
+	dir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(dir, fmt.Sprintf("concurrent.Ex%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSegmentSize(4*DefaultChunkSize, func(n uint16) (io.Writer, error) {
+		return os.Create(segmentPath(n))
+	})
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "concurrent.Ex*"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("expected at least 3 segments, got %d", len(paths))
+	}
+
+	open := func(opts shared.OpenOptions, wrap bool) *EWFReader {
+		fhs := make([]io.ReadSeeker, 0, len(paths))
+		for _, p := range paths {
+			rf, err := os.Open(p)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { rf.Close() })
+			if wrap {
+				fhs = append(fhs, onlyReadSeeker{rf})
+			} else {
+				fhs = append(fhs, rf)
+			}
+		}
+		reader, err := OpenEWFWithOptions(opts, fhs...)
+		if err != nil {
+			t.Fatalf("OpenEWFWithOptions: %v", err)
+		}
+		return reader
+	}
+
+	tests := []struct {
+		name   string
+		reader *EWFReader
+	}{
+		{"ReaderAt", open(shared.OpenOptions{}, false)},
+		{"ReadSeeker", open(shared.OpenOptions{}, true)},
+		{"ChunkCache", open(shared.OpenOptions{ChunkCacheSize: 3}, false)},
+		{"Strict", open(shared.OpenOptions{Strict: true}, false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// segments after the first are decoded by the first reads touching them
+			var wg sync.WaitGroup
+			errs := make(chan error, 16)
+			for g := 0; g < 16; g++ {
+				wg.Add(1)
+				go func(seed int64) {
+					defer wg.Done()
+					rnd := rand.New(rand.NewSource(seed))
+					buf := make([]byte, 2*DefaultChunkSize)
+					for i := 0; i < 20; i++ {
+						off := rnd.Int63n(int64(len(data)))
+						size := 1 + rnd.Intn(len(buf))
+						n, err := tt.reader.ReadAt(buf[:size], off)
+						if err != nil && err != io.EOF {
+							errs <- fmt.Errorf("ReadAt(%d, %d): %w", off, size, err)
+							return
+						}
+						if !bytes.Equal(buf[:n], data[off:off+int64(n)]) {
+							errs <- fmt.Errorf("ReadAt(%d, %d): data mismatch", off, size)
+							return
+						}
+						if n < size && off+int64(n) != int64(len(data)) {
+							errs <- fmt.Errorf("ReadAt(%d, %d): short read of %d bytes", off, size, n)
+							return
+						}
+					}
+				}(int64(g))
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestEVF2OpenEWFFileAndReaderAt(t *testing.T) {
+	data := make([]byte, 10*DefaultChunkSize+300)
+	rand.New(rand.NewSource(21)).Read(data)
+
+	dir := t.TempDir()
+	segmentPath := func(n uint16) string {
+		return filepath.Join(dir, fmt.Sprintf("image.Ex%02d", n))
+	}
+
+	f, err := os.Create(segmentPath(1))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	creator, err := CreateEWF(f)
+	if err != nil {
+		t.Fatalf("CreateEWF: %v", err)
+	}
+	creator.SetSegmentSize(4*DefaultChunkSize, func(n uint16) (io.Writer, error) {
+		return os.Create(segmentPath(n))
+	})
+	w, err := creator.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("file close: %v", err)
+	}
+	// not a segment of the set
+	if err := os.WriteFile(filepath.Join(dir, "image.raw"), data, 0o644); err != nil {
+		t.Fatalf("write raw: %v", err)
+	}
+
+	paths, err := shared.SegmentPaths(segmentPath(1))
+	if err != nil {
+		t.Fatalf("SegmentPaths: %v", err)
+	}
+	if len(paths) < 3 {
+		t.Fatalf("expected at least 3 segments, got %v", paths)
+	}
+
+	verify := func(reader *EWFReader) {
+		t.Helper()
+		if reader.SegmentCount() != len(paths) {
+			t.Fatalf("SegmentCount = %d, want %d", reader.SegmentCount(), len(paths))
+		}
+		got := make([]byte, len(data))
+		if _, err := reader.ReadAt(got, 0); err != nil && err != io.EOF {
+			t.Fatalf("ReadAt: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("data mismatch")
+		}
+	}
+
+	reader, err := OpenEWFFile(segmentPath(1), shared.OpenOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("OpenEWFFile: %v", err)
+	}
+	verify(reader)
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := reader.ReadAt(make([]byte, 16), 0); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("ReadAt after Close: %v, want os.ErrClosed", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	if _, err := OpenEWFFile(filepath.Join(dir, "missing.Ex01"), shared.OpenOptions{}); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("OpenEWFFile of a missing file: %v", err)
+	}
+
+	segments := make([]shared.SegmentReaderAt, 0, len(paths))
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("read segment: %v", err)
+		}
+		segments = append(segments, shared.SegmentReaderAt{ReaderAt: bytes.NewReader(b), Size: int64(len(b))})
+	}
+	reader, err = OpenEWFReaderAt(shared.OpenOptions{}, segments...)
+	if err != nil {
+		t.Fatalf("OpenEWFReaderAt: %v", err)
+	}
+	verify(reader)
+}
+
+func TestEVF2SegmentSetValidation(t *testing.T) {
+	data := make([]byte, 10*DefaultChunkSize)
+	rand.New(rand.NewSource(24)).Read(data)
+	dir := t.TempDir()
+
+	// two acquisitions of the same data, split the same way
+	acquire := func(name string) []string {
+		segmentPath := func(n uint16) string {
+			return filepath.Join(dir, fmt.Sprintf("%s.Ex%02d", name, n))
+		}
+		f, err := os.Create(segmentPath(1))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		creator, err := CreateEWF(f)
+		if err != nil {
+			t.Fatalf("CreateEWF: %v", err)
+		}
+		creator.SetSegmentSize(3*DefaultChunkSize, func(n uint16) (io.Writer, error) {
+			return os.Create(segmentPath(n))
+		})
+		w, err := creator.Start(int64(len(data)))
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("file close: %v", err)
+		}
+
+		paths, err := shared.SegmentPaths(segmentPath(1))
+		if err != nil {
+			t.Fatalf("SegmentPaths: %v", err)
+		}
+		if len(paths) < 4 {
+			t.Fatalf("expected at least 4 segments, got %d", len(paths))
+		}
+		return paths
+	}
+	first := acquire("first")
+	second := acquire("second")
+
+	open := func(paths ...string) (*EWFReader, error) {
+		fhs := make([]io.ReadSeeker, 0, len(paths))
+		for _, p := range paths {
+			rf, err := os.Open(p)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			t.Cleanup(func() { rf.Close() })
+			fhs = append(fhs, rf)
+		}
+		return OpenEWF(fhs...)
+	}
+
+	reader, err := open(first...)
+	if err != nil {
+		t.Fatalf("OpenEWF of the complete set: %v", err)
+	}
+	got := make([]byte, len(data))
+	if _, err := reader.ReadAt(got, 0); err != nil && err != io.EOF {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("data mismatch")
+	}
+
+	last := uint16(len(first))
+	tests := []struct {
+		name  string
+		paths []string
+		want  shared.SegmentSetError
+	}{
+		{"missing", append([]string{first[0], first[1]}, first[3:]...), shared.SegmentSetError{Missing: []uint16{3}}},
+		{"missing first", first[1:], shared.SegmentSetError{Missing: []uint16{1}}},
+		{"missing last", first[:last-1], shared.SegmentSetError{Missing: []uint16{last}}},
+		{"duplicate", append([]string{first[0], first[1]}, first[1:]...), shared.SegmentSetError{Duplicate: []uint16{2}}},
+		{"foreign", append([]string{first[0], first[1], second[2]}, first[3:]...), shared.SegmentSetError{Foreign: []uint16{3}}},
+		{"foreign and missing", append([]string{first[0], second[1]}, first[3:]...), shared.SegmentSetError{Missing: []uint16{3}, Foreign: []uint16{2}}},
+	}
+	for _, tt := range tests {
+		_, err := open(tt.paths...)
+		var setErr *shared.SegmentSetError
+		if !errors.As(err, &setErr) {
+			t.Fatalf("%s: got %v, want a *shared.SegmentSetError", tt.name, err)
+		}
+		if fmt.Sprint(*setErr) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *setErr, tt.want)
+		}
+	}
+
+	// the files that follow a gap are still found by name
+	for _, tt := range []struct {
+		name   string
+		remove string
+		first  string
+		want   shared.SegmentSetError
+	}{
+		{"missing file", first[2], first[0], shared.SegmentSetError{Missing: []uint16{3}}},
+		{"missing last file", second[last-1], second[0], shared.SegmentSetError{Missing: []uint16{last}}},
+	} {
+		if err := os.Remove(tt.remove); err != nil {
+			t.Fatalf("remove: %v", err)
+		}
+		_, err := OpenEWFFile(tt.first, shared.OpenOptions{})
+		var setErr *shared.SegmentSetError
+		if !errors.As(err, &setErr) {
+			t.Fatalf("%s: got %v, want a *shared.SegmentSetError", tt.name, err)
+		}
+		if fmt.Sprint(*setErr) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *setErr, tt.want)
+		}
+	}
+}
+
+func TestEVF2RecoverInterruptedImage(t *testing.T) {
+	// compressible chunks followed by random ones, which are stored uncompressed
+	// the last chunk is short and does not end on a sector boundary
+	const tail = 1000
+	data := make([]byte, 10*DefaultChunkSize+tail)
+	for i := 0; i < 5*DefaultChunkSize; i++ {
+		data[i] = byte(i / 512)
+	}
+	rand.New(rand.NewSource(25)).Read(data[5*DefaultChunkSize:])
+
+	// acquire writes the data, the acquisition stops before Close unless complete is set
+	acquire := func(t *testing.T, segmentSize int64, complete bool) []string {
+		dir := t.TempDir()
+		segmentPath := func(n uint16) string {
+			return filepath.Join(dir, fmt.Sprintf("image.Ex%02d", n))
+		}
+		var files []*os.File
+		t.Cleanup(func() {
+			for _, f := range files {
+				f.Close()
+			}
+		})
+		create := func(n uint16) (*os.File, error) {
+			f, err := os.Create(segmentPath(n))
+			if err == nil {
+				files = append(files, f)
+			}
+			return f, err
+		}
+
+		f, err := create(1)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		creator, err := CreateEWF(f)
+		if err != nil {
+			t.Fatalf("CreateEWF: %v", err)
+		}
+		if segmentSize > 0 {
+			creator.SetSegmentSize(segmentSize, func(n uint16) (io.Writer, error) {
+				return create(n)
+			})
+		}
+		w, err := creator.Start(int64(len(data)))
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if complete {
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+		}
+
+		paths, err := shared.SegmentPaths(segmentPath(1))
+		if err != nil {
+			t.Fatalf("SegmentPaths: %v", err)
+		}
+		return paths
+	}
+
+	open := func(t *testing.T, paths []string, opts shared.OpenOptions) (*EWFReader, error) {
+		files, err := shared.OpenSegmentFiles(paths[0])
+		if err != nil {
+			t.Fatalf("OpenSegmentFiles: %v", err)
+		}
+		t.Cleanup(func() { shared.CloseFiles(files) })
+		fhs := make([]io.ReadSeeker, len(files))
+		for i, f := range files {
+			fhs[i] = f
+		}
+		return OpenEWFWithOptions(opts, fhs...)
+	}
+
+	truncate := func(t *testing.T, path string, n int64) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if err := os.Truncate(path, info.Size()-n); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+	}
+
+	checkRecovered := func(t *testing.T, reader *EWFReader, size int64, segments string) {
+		t.Helper()
+		if reader.Size() != size {
+			t.Fatalf("size %d, want %d", reader.Size(), size)
+		}
+		// the device information records the size of the source
+		recorded := int64(len(data))
+		recovery := reader.Recovery()
+		if recovery.Size != size || recovery.RecordedSize != recorded {
+			t.Fatalf("recovery %+v, want %d of %d bytes", recovery, size, recorded)
+		}
+		if got := fmt.Sprint(recovery.Segments); got != segments {
+			t.Fatalf("scanned segments %s, want %s", got, segments)
+		}
+		if recovery.Truncated() != (segments != "[]") {
+			t.Fatalf("recovery %+v truncated: %v", recovery, recovery.Truncated())
+		}
+
+		got := make([]byte, size)
+		if _, err := reader.ReadAt(got, 0); err != nil && err != io.EOF {
+			t.Fatalf("ReadAt: %v", err)
+		}
+		if !bytes.Equal(got, data[:size]) {
+			t.Fatalf("recovered data mismatch")
+		}
+		if _, err := reader.ReadAt(make([]byte, 1), size); err != io.EOF {
+			t.Fatalf("read beyond the recovered data: %v, want EOF", err)
+		}
+	}
+
+	t.Run("interrupted", func(t *testing.T) {
+		paths := acquire(t, 0, false)
+
+		if _, err := open(t, paths, shared.OpenOptions{}); err == nil {
+			t.Fatalf("interrupted image opened without recovery")
+		}
+		reader, err := open(t, paths, shared.OpenOptions{Recover: true})
+		if err != nil {
+			t.Fatalf("open in recovery mode: %v", err)
+		}
+		// the writer holds the short last chunk until Close
+		checkRecovered(t, reader, int64(len(data)-tail), "[1]")
+	})
+
+	t.Run("truncated chunk", func(t *testing.T) {
+		paths := acquire(t, 0, false)
+		// the last chunk is cut short
+		truncate(t, paths[0], 100)
+
+		reader, err := open(t, paths, shared.OpenOptions{Recover: true})
+		if err != nil {
+			t.Fatalf("open in recovery mode: %v", err)
+		}
+		checkRecovered(t, reader, int64(len(data)-tail-DefaultChunkSize), "[1]")
+	})
+
+	t.Run("truncated trailer", func(t *testing.T) {
+		paths := acquire(t, 0, true)
+		// the tables are written, the hash and done sections are cut off
+		truncate(t, paths[0], 100)
+
+		reader, err := open(t, paths, shared.OpenOptions{Recover: true, Strict: true})
+		if err != nil {
+			t.Fatalf("open in recovery mode: %v", err)
+		}
+		checkRecovered(t, reader, int64(len(data)), "[1]")
+	})
+
+	t.Run("segments", func(t *testing.T) {
+		paths := acquire(t, 3*DefaultChunkSize, false)
+		if len(paths) < 3 {
+			t.Fatalf("expected at least 3 segments, got %d", len(paths))
+		}
+
+		reader, err := open(t, paths, shared.OpenOptions{Recover: true, Strict: true})
+		if err != nil {
+			t.Fatalf("open in recovery mode: %v", err)
+		}
+		checkRecovered(t, reader, int64(len(data)-tail), fmt.Sprintf("[%d]", len(paths)))
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		paths := acquire(t, 3*DefaultChunkSize, true)
+
+		reader, err := open(t, paths, shared.OpenOptions{Recover: true})
+		if err != nil {
+			t.Fatalf("open in recovery mode: %v", err)
+		}
+		checkRecovered(t, reader, int64(len(data)), "[]")
+	})
+}
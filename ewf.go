@@ -0,0 +1,186 @@
+// Package ewf opens EWF images of any supported format. The format is detected from the
+// signature of the segment files and the image is read by the evf1 or evf2 package.
+package ewf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/asalih/go-ewf/evf1"
+	"github.com/asalih/go-ewf/evf2"
+	"github.com/asalih/go-ewf/shared"
+)
+
+// Format is the format of an image, identified by the signature of its segment files
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	// FormatEVF is an E01 image, read by the evf1 package
+	FormatEVF
+	// FormatLVF is an L01 logical evidence file, read by the evf1 package
+	FormatLVF
+	// FormatEVF2 is an Ex01 image, read by the evf2 package
+	FormatEVF2
+	// FormatLVF2 is an Lx01 logical evidence file, read by the evf2 package
+	FormatLVF2
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatEVF:
+		return "EVF1 (E01)"
+	case FormatLVF:
+		return "LVF1 (L01)"
+	case FormatEVF2:
+		return "EVF2 (Ex01)"
+	case FormatLVF2:
+		return "LVF2 (Lx01)"
+	default:
+		return "unknown"
+	}
+}
+
+// Logical reports whether the format is a logical evidence file holding files instead of media
+func (f Format) Logical() bool {
+	return f == FormatLVF || f == FormatLVF2
+}
+
+var (
+	// ErrUnknownFormat is matched by the errors of segment files without an EWF signature
+	ErrUnknownFormat = errors.New("unknown EWF signature")
+	// ErrMixedFormats is matched by the errors of segment sets whose files have different
+	// signatures
+	ErrMixedFormats = errors.New("segment files of different formats")
+)
+
+// DetectFormat reads the 8 byte signature at the start of a segment file
+func DetectFormat(r io.Reader) (Format, error) {
+	var sig [8]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return FormatUnknown, fmt.Errorf("%w: file is shorter than a signature", ErrUnknownFormat)
+		}
+		return FormatUnknown, err
+	}
+
+	switch string(sig[:]) {
+	case evf1.EVFSignature:
+		return FormatEVF, nil
+	case evf1.LVFSignature:
+		return FormatLVF, nil
+	case evf2.EVF2Signature:
+		return FormatEVF2, nil
+	case evf2.LVF2Signature:
+		return FormatLVF2, nil
+	}
+	return FormatUnknown, fmt.Errorf("%w %q", ErrUnknownFormat, sig[:])
+}
+
+// Reader is an image opened by Open or OpenSegments. The embedded reader is an *evf1.EWFReader
+// or an *evf2.EWFReader depending on Format.
+type Reader struct {
+	shared.EWFReader
+	Format Format
+
+	// files are the segment files opened by Open, closed by Close
+	files []*os.File
+}
+
+// Open opens the image whose first segment file is at path together with the segment files
+// that follow it, e.g. image.E02 and image.E03 for image.E01. Close closes the files.
+func Open(path string, opts shared.OpenOptions) (*Reader, error) {
+	files, err := shared.OpenSegmentFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fhs := make([]io.ReadSeeker, len(files))
+	for i, f := range files {
+		fhs[i] = f
+	}
+	r, err := OpenSegments(opts, fhs...)
+	if err != nil {
+		_ = shared.CloseFiles(files)
+		return nil, err
+	}
+	r.files = files
+	return r, nil
+}
+
+// OpenSegments opens the segment files of an image, all of them must have the signature of the
+// same format. Each file is read from its current position, like by the OpenEWF functions.
+func OpenSegments(opts shared.OpenOptions, fhs ...io.ReadSeeker) (*Reader, error) {
+	if len(fhs) == 0 {
+		return nil, errors.New("no segment files")
+	}
+
+	format := FormatUnknown
+	for i, fh := range fhs {
+		f, err := detectSegment(fh)
+		if err != nil {
+			return nil, fmt.Errorf("segment file %d: %w", i+1, err)
+		}
+		if i == 0 {
+			format = f
+		} else if f != format {
+			return nil, fmt.Errorf("%w: segment file %d is %s, segment file 1 is %s", ErrMixedFormats, i+1, f, format)
+		}
+	}
+
+	r := &Reader{Format: format}
+	switch format {
+	case FormatEVF, FormatLVF:
+		reader, err := evf1.OpenEWFWithOptions(opts, fhs...)
+		if err != nil {
+			return nil, err
+		}
+		r.EWFReader = reader
+	default:
+		reader, err := evf2.OpenEWFWithOptions(opts, fhs...)
+		if err != nil {
+			return nil, err
+		}
+		r.EWFReader = reader
+	}
+	return r, nil
+}
+
+// detectSegment detects the format of a segment file and seeks back to where it was read from
+func detectSegment(fh io.ReadSeeker) (Format, error) {
+	pos, err := fh.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	format, err := DetectFormat(fh)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	if _, err := fh.Seek(pos, io.SeekStart); err != nil {
+		return FormatUnknown, err
+	}
+	return format, nil
+}
+
+// EVF1 returns the reader of an E01 or L01 image, false for the other formats
+func (r *Reader) EVF1() (*evf1.EWFReader, bool) {
+	reader, ok := r.EWFReader.(*evf1.EWFReader)
+	return reader, ok
+}
+
+// EVF2 returns the reader of an Ex01 or Lx01 image, false for the other formats
+func (r *Reader) EVF2() (*evf2.EWFReader, bool) {
+	reader, ok := r.EWFReader.(*evf2.EWFReader)
+	return reader, ok
+}
+
+// Close closes the segment files opened by Open. Segments passed to OpenSegments are left to
+// the caller.
+func (r *Reader) Close() error {
+	err := r.EWFReader.Close()
+	files := r.files
+	r.files = nil
+	return errors.Join(err, shared.CloseFiles(files))
+}
@@ -1,15 +1,20 @@
-package main
+package ewf
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 
 	"github.com/asalih/go-ewf/evf1"
 	"github.com/asalih/go-ewf/evf2"
+	"github.com/asalih/go-ewf/shared"
 )
 
 const (
@@ -90,10 +95,9 @@ func TestEVF1WriteRead(t *testing.T) {
 			t.Fatalf("Failed to open EVF1 reader: %v", err)
 		}
 
-		// Note: EVF1 reports size based on chunk boundaries (padded size)
-		// The actual size may be larger due to padding to complete chunks
-		if reader.Size() < int64(len(originalData)) {
-			t.Errorf("Size too small: got %d, want at least %d", reader.Size(), len(originalData))
+		// Size is the media size, the last chunk is stored short
+		if reader.Size() != int64(len(originalData)) {
+			t.Errorf("Size mismatch: got %d, want %d", reader.Size(), len(originalData))
 		}
 
 		// Verify metadata
@@ -102,7 +106,7 @@ func TestEVF1WriteRead(t *testing.T) {
 			t.Errorf("Case number mismatch: got %v", caseNum)
 		}
 
-		// Read original data size (not the padded size)
+		// Read original data size
 		readData := make([]byte, len(originalData))
 		n, err := io.ReadFull(reader, readData)
 		if err != nil {
@@ -117,6 +121,18 @@ func TestEVF1WriteRead(t *testing.T) {
 		if !bytes.Equal(originalData, readData) {
 			t.Error("Read data does not match original data")
 		}
+
+		// Reads stop at the end of the media
+		rest, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Failed to read up to the end: %v", err)
+		}
+		if int64(len(originalData)+len(rest)) != reader.Size() {
+			t.Errorf("Read up to the end mismatch: got %d, want %d", len(originalData)+len(rest), reader.Size())
+		}
+		if n, err := reader.ReadAt(make([]byte, 1), reader.Size()); n != 0 || err != io.EOF {
+			t.Errorf("ReadAt at the end: got %d, %v, want 0, EOF", n, err)
+		}
 	})
 
 	// Test random access reads
@@ -243,10 +259,9 @@ func TestEVF2WriteRead(t *testing.T) {
 			t.Fatalf("Failed to open EVF2 reader: %v", err)
 		}
 
-		// Note: EVF2 reports size based on chunk boundaries (padded size)
-		// The actual size may be larger due to padding to complete chunks
-		if reader.Size() < int64(len(originalData)) {
-			t.Errorf("Size too small: got %d, want at least %d", reader.Size(), len(originalData))
+		// Size is the media size, the last chunk is stored short
+		if reader.Size() != int64(len(originalData)) {
+			t.Errorf("Size mismatch: got %d, want %d", reader.Size(), len(originalData))
 		}
 
 		// Verify metadata
@@ -257,7 +272,7 @@ func TestEVF2WriteRead(t *testing.T) {
 			}
 		}
 
-		// Read original data size (not the padded size)
+		// Read original data size
 		readData := make([]byte, len(originalData))
 		n, err := io.ReadFull(reader, readData)
 		if err != nil {
@@ -272,6 +287,18 @@ func TestEVF2WriteRead(t *testing.T) {
 		if !bytes.Equal(originalData, readData) {
 			t.Error("Read data does not match original data")
 		}
+
+		// Reads stop at the end of the media
+		rest, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Failed to read up to the end: %v", err)
+		}
+		if int64(len(originalData)+len(rest)) != reader.Size() {
+			t.Errorf("Read up to the end mismatch: got %d, want %d", len(originalData)+len(rest), reader.Size())
+		}
+		if n, err := reader.ReadAt(make([]byte, 1), reader.Size()); n != 0 || err != io.EOF {
+			t.Errorf("ReadAt at the end: got %d, %v, want 0, EOF", n, err)
+		}
 	})
 
 	// Test random access reads
@@ -354,7 +381,7 @@ func TestEVF2WriteRead(t *testing.T) {
 			t.Errorf("SeekCurrent failed: %v", err)
 		}
 
-		// Test SeekEnd (note: uses padded size reported by reader)
+		// Test SeekEnd (note: uses media size reported by reader)
 		pos, err = reader.Seek(-1024, io.SeekEnd)
 		if err != nil {
 			t.Errorf("SeekEnd failed: %v", err)
@@ -419,18 +446,17 @@ func TestEVF1HashVerification(t *testing.T) {
 		t.Fatalf("Failed to open EVF1 reader: %v", err)
 	}
 
-	// Verify that hashes are stored (actual hash values include padding which is expected)
+	// Verify that hashes cover exactly the source data
 	if reader.First.Digest == nil {
 		t.Error("Digest section is nil")
 	} else {
-		// Just verify hashes exist and are non-zero
-		zeroMD5 := [16]byte{}
-		zeroSHA1 := [20]byte{}
-		if bytes.Equal(reader.First.Digest.MD5[:], zeroMD5[:]) {
-			t.Error("MD5 hash is zero")
+		wantMD5 := md5.Sum(originalData)
+		wantSHA1 := sha1.Sum(originalData)
+		if !bytes.Equal(reader.First.Digest.MD5[:], wantMD5[:]) {
+			t.Errorf("MD5 mismatch: got %x want %x", reader.First.Digest.MD5, wantMD5)
 		}
-		if bytes.Equal(reader.First.Digest.SHA1[:], zeroSHA1[:]) {
-			t.Error("SHA1 hash is zero")
+		if !bytes.Equal(reader.First.Digest.SHA1[:], wantSHA1[:]) {
+			t.Errorf("SHA1 mismatch: got %x want %x", reader.First.Digest.SHA1, wantSHA1)
 		}
 	}
 }
@@ -484,22 +510,22 @@ func TestEVF2HashVerification(t *testing.T) {
 		t.Fatalf("Failed to open EVF2 reader: %v", err)
 	}
 
-	// Verify that hashes are stored (actual hash values include padding which is expected)
+	// Verify that hashes cover exactly the source data
 	if reader.First.MD5Hash == nil {
 		t.Error("MD5Hash section is nil")
 	} else {
-		zeroMD5 := [16]byte{}
-		if bytes.Equal(reader.First.MD5Hash.Hash[:], zeroMD5[:]) {
-			t.Error("MD5 hash is zero")
+		wantMD5 := md5.Sum(originalData)
+		if !bytes.Equal(reader.First.MD5Hash.Hash[:], wantMD5[:]) {
+			t.Errorf("MD5 mismatch: got %x want %x", reader.First.MD5Hash.Hash, wantMD5)
 		}
 	}
 
 	if reader.First.SHA1Hash == nil {
 		t.Error("SHA1Hash section is nil")
 	} else {
-		zeroSHA1 := [20]byte{}
-		if bytes.Equal(reader.First.SHA1Hash.Hash[:], zeroSHA1[:]) {
-			t.Error("SHA1 hash is zero")
+		wantSHA1 := sha1.Sum(originalData)
+		if !bytes.Equal(reader.First.SHA1Hash.Hash[:], wantSHA1[:]) {
+			t.Errorf("SHA1 mismatch: got %x want %x", reader.First.SHA1Hash.Hash, wantSHA1)
 		}
 	}
 }
@@ -554,7 +580,7 @@ func TestEVF2MultipleReads(t *testing.T) {
 			t.Fatalf("Failed to open EVF2 reader on iteration %d: %v", i, err)
 		}
 
-		// Read only the original data size (not the padded data)
+		// Read only the original data size
 		readData := make([]byte, len(originalData))
 		n, err := io.ReadFull(reader, readData)
 		if err != nil {
@@ -633,7 +659,7 @@ func TestEVF2ChunkedWrite(t *testing.T) {
 				t.Fatalf("Failed to open EVF2 reader: %v", err)
 			}
 
-			// Read only the original data size (not the padded data)
+			// Read only the original data size
 			readData := make([]byte, len(originalData))
 			n, err := io.ReadFull(reader, readData)
 			if err != nil {
@@ -849,3 +875,363 @@ func TestEVF1AndEVF2DataIntegrity(t *testing.T) {
 		}
 	})
 }
+
+// TestOpenDetectsFormat tests that Open picks the reader of the format of the segment files
+func TestOpenDetectsFormat(t *testing.T) {
+	data := bytes.Repeat([]byte("go-ewf format detection "), 8*1024)
+	tmpDir := t.TempDir()
+
+	e01Path := filepath.Join(tmpDir, "detect.E01")
+	e01File, err := os.Create(e01Path)
+	if err != nil {
+		t.Fatalf("Failed to create EWF file: %v", err)
+	}
+	creator1, err := evf1.CreateEWF(e01File)
+	if err != nil {
+		t.Fatalf("Failed to create EVF1 creator: %v", err)
+	}
+	writer1, err := creator1.Start()
+	if err != nil {
+		t.Fatalf("Failed to start writer: %v", err)
+	}
+	if _, err := writer1.Write(data); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := writer1.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	e01File.Close()
+
+	ex01Path := filepath.Join(tmpDir, "detect.Ex01")
+	ex01File, err := os.Create(ex01Path)
+	if err != nil {
+		t.Fatalf("Failed to create EWF file: %v", err)
+	}
+	creator2, err := evf2.CreateEWF(ex01File)
+	if err != nil {
+		t.Fatalf("Failed to create EVF2 creator: %v", err)
+	}
+	writer2, err := creator2.Start(int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to start writer: %v", err)
+	}
+	if _, err := writer2.Write(data); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := writer2.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	ex01File.Close()
+
+	l01Path := filepath.Join(tmpDir, "detect.L01")
+	l01File, err := os.Create(l01Path)
+	if err != nil {
+		t.Fatalf("Failed to create L01 file: %v", err)
+	}
+	logicalCreator, err := evf1.CreateLogical(l01File)
+	if err != nil {
+		t.Fatalf("Failed to create L01 creator: %v", err)
+	}
+	logicalWriter, err := logicalCreator.Start()
+	if err != nil {
+		t.Fatalf("Failed to start writer: %v", err)
+	}
+	if err := logicalWriter.AddFS(fstest.MapFS{"file.txt": {Data: data}}); err != nil {
+		t.Fatalf("Failed to add files: %v", err)
+	}
+	if err := logicalWriter.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	l01File.Close()
+
+	tests := []struct {
+		path   string
+		format Format
+	}{
+		{e01Path, FormatEVF},
+		{ex01Path, FormatEVF2},
+		{l01Path, FormatLVF},
+	}
+	for _, tt := range tests {
+		reader, err := Open(tt.path, shared.OpenOptions{})
+		if err != nil {
+			t.Fatalf("Open(%s): %v", tt.path, err)
+		}
+		if reader.Format != tt.format {
+			t.Errorf("Open(%s) format = %s, want %s", tt.path, reader.Format, tt.format)
+		}
+		if reader.Format.Logical() != (tt.format == FormatLVF || tt.format == FormatLVF2) {
+			t.Errorf("Open(%s) Logical() = %v", tt.path, reader.Format.Logical())
+		}
+		_, isEVF1 := reader.EVF1()
+		_, isEVF2 := reader.EVF2()
+		if isEVF1 != (tt.format == FormatEVF || tt.format == FormatLVF) || isEVF2 == isEVF1 {
+			t.Errorf("Open(%s) reader is EVF1 %v, EVF2 %v", tt.path, isEVF1, isEVF2)
+		}
+
+		readData := make([]byte, len(data))
+		if _, err := reader.ReadAt(readData, 0); err != nil && err != io.EOF {
+			t.Fatalf("Failed to read %s: %v", tt.path, err)
+		}
+		if !bytes.Equal(readData, data) {
+			t.Errorf("Data mismatch reading %s", tt.path)
+		}
+		if err := reader.Close(); err != nil {
+			t.Errorf("Close(%s): %v", tt.path, err)
+		}
+	}
+
+	// segment files of different formats
+	ex01Data, err := os.ReadFile(ex01Path)
+	if err != nil {
+		t.Fatalf("Failed to read EWF file: %v", err)
+	}
+	e01Data, err := os.ReadFile(e01Path)
+	if err != nil {
+		t.Fatalf("Failed to read EWF file: %v", err)
+	}
+	_, err = OpenSegments(shared.OpenOptions{}, bytes.NewReader(e01Data), bytes.NewReader(ex01Data))
+	if !errors.Is(err, ErrMixedFormats) {
+		t.Errorf("OpenSegments of mixed formats: %v, want ErrMixedFormats", err)
+	}
+
+	rawPath := filepath.Join(tmpDir, "detect.raw")
+	if err := os.WriteFile(rawPath, data, 0o644); err != nil {
+		t.Fatalf("Failed to write raw file: %v", err)
+	}
+	if _, err := Open(rawPath, shared.OpenOptions{}); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Open of a raw file: %v, want ErrUnknownFormat", err)
+	}
+	if _, err := OpenSegments(shared.OpenOptions{}, bytes.NewReader([]byte("EVF"))); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("OpenSegments of a short file: %v, want ErrUnknownFormat", err)
+	}
+}
+
+// TestSegmentExtensions tests the EnCase naming sequence of segment files
+func TestSegmentExtensions(t *testing.T) {
+	tests := []struct {
+		family shared.SegmentFamily
+		number uint16
+		ext    string
+	}{
+		{shared.SegmentFamilyE01, 1, ".E01"},
+		{shared.SegmentFamilyE01, 99, ".E99"},
+		{shared.SegmentFamilyE01, 100, ".EAA"},
+		{shared.SegmentFamilyE01, 125, ".EAZ"},
+		{shared.SegmentFamilyE01, 126, ".EBA"},
+		{shared.SegmentFamilyE01, 775, ".EZZ"},
+		{shared.SegmentFamilyE01, 776, ".FAA"},
+		{shared.SegmentFamilyE01, 14971, ".ZZZ"},
+		{shared.SegmentFamilyEx01, 99, ".Ex99"},
+		{shared.SegmentFamilyEx01, 100, ".ExAA"},
+		{shared.SegmentFamilyEx01, 776, ".FxAA"},
+		{shared.SegmentFamilyL01, 100, ".LAA"},
+		{shared.SegmentFamilyLx01, 300, ".LxHS"},
+		{shared.SegmentFamilyS01, 100, ".saa"},
+		{shared.SegmentFamilyS01, 5507, ".zzz"},
+		{"e", 100, ".eaa"},
+	}
+	for _, tt := range tests {
+		ext, err := tt.family.Extension(tt.number)
+		if err != nil || ext != tt.ext {
+			t.Errorf("%s Extension(%d) = %q, %v, want %q", tt.family, tt.number, ext, err, tt.ext)
+		}
+		number, err := tt.family.Number(tt.ext)
+		if err != nil || number != tt.number {
+			t.Errorf("%s Number(%q) = %d, %v, want %d", tt.family, tt.ext, number, err, tt.number)
+		}
+	}
+
+	// every number maps to an extension that maps back to it
+	for _, family := range []shared.SegmentFamily{shared.SegmentFamilyE01, shared.SegmentFamilyLx01, shared.SegmentFamilyS01} {
+		seen := make(map[string]bool)
+		for number := uint16(1); ; number++ {
+			ext, err := family.Extension(number)
+			if err != nil {
+				break
+			}
+			if seen[ext] {
+				t.Fatalf("%s extension %s repeats", family, ext)
+			}
+			seen[ext] = true
+			if back, err := family.Number(ext); err != nil || back != number {
+				t.Fatalf("%s Number(%q) = %d, %v, want %d", family, ext, back, err, number)
+			}
+		}
+	}
+
+	if _, err := shared.SegmentFamilyE01.Extension(14972); err == nil {
+		t.Errorf("expected an error beyond .ZZZ")
+	}
+	if _, err := shared.SegmentFamilyE01.Extension(0); err == nil {
+		t.Errorf("expected an error for segment 0")
+	}
+	for _, ext := range []string{".Ex01", ".DAA", ".E00", ".EA1", ".raw"} {
+		if _, err := shared.SegmentFamilyE01.Number(ext); err == nil {
+			t.Errorf("expected an error for %s in the E01 family", ext)
+		}
+	}
+
+	path, err := shared.SegmentPath(filepath.Join("cases", "disk.Lx01"), 100)
+	if err != nil || path != filepath.Join("cases", "disk.LxAA") {
+		t.Errorf("SegmentPath = %q, %v", path, err)
+	}
+}
+
+// TestOpenManySegments tests that images with more than 99 segment files are written and
+// opened with the full naming sequence
+func TestOpenManySegments(t *testing.T) {
+	const segments = 300
+	data := make([]byte, segments*512)
+	for i := range data {
+		data[i] = byte(i / 512)
+	}
+
+	tmpDir := t.TempDir()
+	firstPath := filepath.Join(tmpDir, "many.E01")
+	ewfFile, err := os.Create(firstPath)
+	if err != nil {
+		t.Fatalf("Failed to create EWF file: %v", err)
+	}
+	creator, err := evf1.CreateEWF(ewfFile)
+	if err != nil {
+		t.Fatalf("Failed to create EVF1 creator: %v", err)
+	}
+	// one 512 byte chunk per segment
+	creator.SetSectorGeometry(512, 1)
+	creator.SetSegmentSize(1, func(segmentNumber uint16) (io.WriteSeeker, error) {
+		path, err := shared.SegmentPath(firstPath, segmentNumber)
+		if err != nil {
+			return nil, err
+		}
+		return os.Create(path)
+	})
+	writer, err := creator.Start()
+	if err != nil {
+		t.Fatalf("Failed to start writer: %v", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		t.Fatalf("Failed to write data: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+	ewfFile.Close()
+
+	for _, name := range []string{"many.E99", "many.EAA", "many.EHS"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Fatalf("Segment file %s is missing: %v", name, err)
+		}
+	}
+
+	reader, err := Open(firstPath, shared.OpenOptions{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer reader.Close()
+
+	if reader.SegmentCount() != segments {
+		t.Fatalf("Opened %d segments, want %d", reader.SegmentCount(), segments)
+	}
+	readData := make([]byte, len(data))
+	if _, err := reader.ReadAt(readData, 0); err != nil && err != io.EOF {
+		t.Fatalf("Failed to read data: %v", err)
+	}
+	if !bytes.Equal(readData, data) {
+		t.Fatalf("Data mismatch")
+	}
+}
+
+// TestOpenMissingSegments tests that a segment file missing from the middle or the end of a set
+// is reported by Open
+func TestOpenMissingSegments(t *testing.T) {
+	const segments = 4
+	data := make([]byte, segments*512)
+	for i := range data {
+		data[i] = byte(i / 512)
+	}
+
+	acquire := func(t *testing.T, firstPath string) {
+		ewfFile, err := os.Create(firstPath)
+		if err != nil {
+			t.Fatalf("Failed to create EWF file: %v", err)
+		}
+		defer ewfFile.Close()
+		next := func(segmentNumber uint16) (*os.File, error) {
+			path, err := shared.SegmentPath(firstPath, segmentNumber)
+			if err != nil {
+				return nil, err
+			}
+			return os.Create(path)
+		}
+
+		var writer io.WriteCloser
+		if filepath.Ext(firstPath) == ".E01" {
+			creator, err := evf1.CreateEWF(ewfFile)
+			if err != nil {
+				t.Fatalf("Failed to create EVF1 creator: %v", err)
+			}
+			// one 512 byte chunk per segment
+			creator.SetSectorGeometry(512, 1)
+			creator.SetSegmentSize(1, func(segmentNumber uint16) (io.WriteSeeker, error) {
+				return next(segmentNumber)
+			})
+			writer, err = creator.Start()
+			if err != nil {
+				t.Fatalf("Failed to start writer: %v", err)
+			}
+		} else {
+			creator, err := evf2.CreateEWF(ewfFile)
+			if err != nil {
+				t.Fatalf("Failed to create EVF2 creator: %v", err)
+			}
+			creator.SetSectorGeometry(512, 1)
+			creator.SetSegmentSize(1, func(segmentNumber uint16) (io.Writer, error) {
+				return next(segmentNumber)
+			})
+			writer, err = creator.Start(int64(len(data)))
+			if err != nil {
+				t.Fatalf("Failed to start writer: %v", err)
+			}
+		}
+		if _, err := writer.Write(data); err != nil {
+			t.Fatalf("Failed to write data: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Failed to close writer: %v", err)
+		}
+	}
+
+	for _, ext := range []string{".E01", ".Ex01"} {
+		for _, tt := range []struct {
+			name    string
+			remove  uint16
+			missing uint16
+		}{
+			{"middle", 2, 2},
+			{"last", segments, segments},
+		} {
+			t.Run(ext+" "+tt.name, func(t *testing.T) {
+				firstPath := filepath.Join(t.TempDir(), "image"+ext)
+				acquire(t, firstPath)
+
+				path, err := shared.SegmentPath(firstPath, tt.remove)
+				if err != nil {
+					t.Fatalf("SegmentPath: %v", err)
+				}
+				if err := os.Remove(path); err != nil {
+					t.Fatalf("Failed to remove segment: %v", err)
+				}
+
+				_, err = Open(firstPath, shared.OpenOptions{})
+				var setErr *shared.SegmentSetError
+				if !errors.As(err, &setErr) {
+					t.Fatalf("Open: got %v, want a *shared.SegmentSetError", err)
+				}
+				if len(setErr.Missing) != 1 || setErr.Missing[0] != tt.missing {
+					t.Errorf("Missing = %v, want [%d]", setErr.Missing, tt.missing)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// AcquisitionWriter is an image writer that records the source data it could not read
+type AcquisitionWriter interface {
+	io.Writer
+	// WriteUnreadable writes n zero bytes in place of source data that could not be read and
+	// records the sectors they cover as unreadable. n ends within a sector only at the end of the
+	// media.
+	WriteUnreadable(n int64) error
+}
+
+// AcquireOptions configures how Acquire reads the source
+type AcquireOptions struct {
+	// SectorSize is the number of bytes per sector
+	SectorSize int
+	// BlockSize is the number of bytes read at once, a multiple of Granularity
+	BlockSize int
+	// Granularity is the number of bytes read again and zero filled as a unit when a block fails
+	// to read, a multiple of SectorSize. 0 reads failing blocks sector by sector.
+	Granularity int
+	// Retries is how many more times a failing unit is read before it is zero filled
+	Retries int
+	// Progress is called after each block, it may be nil
+	Progress ProgressFunc
+}
+
+// Acquire copies size bytes of src to w in blocks. A block that fails to read is read again in
+// units of the error granularity and the units that keep failing are written as unreadable. A
+// source that ends before size bytes, is closed or can not be read at all fails the acquisition.
+func Acquire(ctx context.Context, w AcquisitionWriter, src io.ReaderAt, size int64, opts AcquireOptions) error {
+	if opts.Granularity == 0 {
+		opts.Granularity = opts.SectorSize
+	}
+	if opts.SectorSize <= 0 || opts.Granularity%opts.SectorSize != 0 {
+		return fmt.Errorf("invalid error granularity %d for sector size %d", opts.Granularity, opts.SectorSize)
+	}
+	if opts.BlockSize < opts.Granularity || opts.BlockSize%opts.Granularity != 0 {
+		return fmt.Errorf("invalid block size %d for error granularity %d", opts.BlockSize, opts.Granularity)
+	}
+	if opts.Retries < 0 {
+		return fmt.Errorf("invalid retry count %d", opts.Retries)
+	}
+
+	buf := make([]byte, opts.BlockSize)
+	var off int64
+	for off < size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p := buf
+		if remaining := size - off; remaining < int64(len(p)) {
+			p = p[:remaining]
+		}
+
+		n, err := src.ReadAt(p, off)
+		if n == len(p) {
+			if _, err := w.Write(p); err != nil {
+				return err
+			}
+		} else if err := sourceError(err, off+int64(n), size); err != nil {
+			return err
+		} else if err := acquireUnits(ctx, w, src, p, off, size, opts); err != nil {
+			return err
+		}
+		off += int64(len(p))
+
+		if opts.Progress != nil {
+			opts.Progress(off, size)
+		}
+	}
+
+	return nil
+}
+
+// acquireUnits reads p from src at off one granularity unit at a time
+func acquireUnits(ctx context.Context, w AcquisitionWriter, src io.ReaderAt, p []byte, off, size int64, opts AcquireOptions) error {
+	for i := 0; i < len(p); i += opts.Granularity {
+		unit := p[i:]
+		if len(unit) > opts.Granularity {
+			unit = unit[:opts.Granularity]
+		}
+
+		read := false
+		for attempt := 0; attempt <= opts.Retries && !read; attempt++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := src.ReadAt(unit, off+int64(i))
+			read = n == len(unit)
+			if !read {
+				if err := sourceError(err, off+int64(i)+int64(n), size); err != nil {
+					return err
+				}
+			}
+		}
+
+		if read {
+			if _, err := w.Write(unit); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := w.WriteUnreadable(int64(len(unit))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sourceError returns the error of a short read at off that fails the acquisition, nil when err
+// is a failure to read the media that is retried and written as unreadable
+func sourceError(err error, off, size int64) error {
+	switch {
+	case err == nil, errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("source ends at %d bytes, before its size of %d bytes", off, size)
+	case errors.Is(err, fs.ErrClosed), errors.Is(err, fs.ErrInvalid), errors.Is(err, fs.ErrPermission),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("read source at %d: %w", off, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+)
+
+// OpenOptions configures how the readers open an image
+type OpenOptions struct {
+	// Strict validates the Adler-32 checksums of section descriptors and tables when the image is
+	// opened and the checksums of chunks when they are read. A damaged table is replaced by a valid
+	// mirror where the format keeps one in either mode, without Strict other mismatches are not an
+	// error.
+	Strict bool
+
+	// UnreadableSectorErrors makes reads that touch sectors which could not be read during
+	// acquisition fail with an error matching ErrUnreadableSector instead of returning the zeros
+	// stored for them.
+	UnreadableSectorErrors bool
+
+	// ChunkCacheSize is the number of decompressed chunks the reader keeps in memory, so small
+	// reads within a chunk do not read and decompress it again. The cache holds up to
+	// ChunkCacheSize times the chunk size bytes, 0 disables it.
+	ChunkCacheSize int
+
+	// Recover opens images whose acquisition was interrupted, e.g. by a power loss, so segment
+	// files end without their tables or closing sections. The chunks of such segments are found
+	// by scanning the segment file and the media is read up to the last chunk found, the reader
+	// reports what was recovered.
+	Recover bool
+}
+
+// ChecksumError is returned in strict mode when a stored Adler-32 checksum does not match its data
+type ChecksumError struct {
+	// Segment is the segment number of the file holding the data
+	Segment uint16
+	// SectionOffset is the offset of the section descriptor in the segment file,
+	// for chunks it is the table section that lists the chunk
+	SectionOffset int64
+	// Chunk is the chunk index in the image, -1 when the checksum does not belong to a chunk
+	Chunk int64
+	// Section names the checksummed data, e.g. "section descriptor", "table header" or "chunk"
+	Section string
+
+	Stored   uint32
+	Computed uint32
+}
+
+func (e *ChecksumError) Error() string {
+	if e.Chunk >= 0 {
+		return fmt.Sprintf("checksum mismatch of %s %d in segment %d, table at 0x%x: stored 0x%08x, computed 0x%08x",
+			e.Section, e.Chunk, e.Segment, e.SectionOffset, e.Stored, e.Computed)
+	}
+	return fmt.Sprintf("checksum mismatch of %s in segment %d at 0x%x: stored 0x%08x, computed 0x%08x",
+		e.Section, e.Segment, e.SectionOffset, e.Stored, e.Computed)
+}
+
+// Checksum computes the Adler-32 checksum of obj the way WriteWithSum does,
+// the last 4 bytes of obj are the checksum itself and not included.
+func Checksum(obj interface{}) (uint32, error) {
+	buf := bytes.NewBuffer(nil)
+	err := binary.Write(buf, binary.LittleEndian, obj)
+	if err != nil {
+		return 0, err
+	}
+
+	data := buf.Bytes()
+	if len(data) < adler32SumSize {
+		return 0, fmt.Errorf("data too short for a checksum: %d bytes", len(data))
+	}
+	return adler32.Checksum(data[:len(data)-adler32SumSize]), nil
+}
@@ -0,0 +1,86 @@
+package shared
+
+import (
+	"container/list"
+	"sync"
+)
+
+// ChunkCacheStats counts the lookups of decompressed chunks in the chunk cache of a reader
+type ChunkCacheStats struct {
+	// Hits are the chunk reads served from the cache
+	Hits uint64
+	// Misses are the chunk reads that read and decompressed the chunk from the segment files
+	Misses uint64
+}
+
+// ChunkCache keeps the most recently used decompressed chunks of an image, keyed by the chunk
+// index in the image. It is safe for concurrent use.
+type ChunkCache struct {
+	mu       sync.Mutex
+	capacity int
+	lru      *list.List
+	items    map[int64]*list.Element
+	stats    ChunkCacheStats
+}
+
+type cachedChunk struct {
+	chunk int64
+	data  []byte
+}
+
+// NewChunkCache returns a cache holding up to capacity chunks, nil when capacity is not positive
+func NewChunkCache(capacity int) *ChunkCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &ChunkCache{
+		capacity: capacity,
+		lru:      list.New(),
+		items:    make(map[int64]*list.Element, capacity),
+	}
+}
+
+// Get returns the data of chunk and marks it as recently used. The data is shared with the
+// cache and must not be modified.
+func (c *ChunkCache) Get(chunk int64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[chunk]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cachedChunk).data, true
+}
+
+// Add stores the data of chunk, evicting the least recently used chunk when the cache is full
+func (c *ChunkCache) Add(chunk int64, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[chunk]; ok {
+		elem.Value.(*cachedChunk).data = data
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.items[chunk] = c.lru.PushFront(&cachedChunk{chunk: chunk, data: data})
+	if c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cachedChunk).chunk)
+	}
+}
+
+// Stats returns the hit and miss counts, zero for a nil cache
+func (c *ChunkCache) Stats() ChunkCacheStats {
+	if c == nil {
+		return ChunkCacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -42,8 +42,13 @@ type ZlibCompressor struct {
 }
 
 func NewZlibCompressor() (*ZlibCompressor, error) {
+	return NewZlibCompressorLevel(zlib.BestCompression)
+}
+
+// NewZlibCompressorLevel creates a compressor with one of the zlib compression levels
+func NewZlibCompressorLevel(level int) (*ZlibCompressor, error) {
 	buf := bytes.NewBuffer(nil)
-	wr, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
+	wr, err := zlib.NewWriterLevel(buf, level)
 	if err != nil {
 		return nil, err
 	}
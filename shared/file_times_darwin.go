@@ -0,0 +1,15 @@
+package shared
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysFileTimes returns the times of the stat result of a file
+func sysFileTimes(sys interface{}) (creation, access, change time.Time) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	return time.Unix(st.Birthtimespec.Unix()), time.Unix(st.Atimespec.Unix()), time.Unix(st.Ctimespec.Unix())
+}
@@ -0,0 +1,16 @@
+package shared
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysFileTimes returns the times of the stat result of a file. Linux does not report the creation
+// time through stat.
+func sysFileTimes(sys interface{}) (creation, access, change time.Time) {
+	st, ok := sys.(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	return time.Time{}, time.Unix(st.Atim.Unix()), time.Unix(st.Ctim.Unix())
+}
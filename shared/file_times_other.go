@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package shared
+
+import "time"
+
+// sysFileTimes returns no times, the stat result of a file is not known on this platform
+func sysFileTimes(sys interface{}) (creation, access, change time.Time) {
+	return
+}
@@ -0,0 +1,16 @@
+package shared
+
+import (
+	"syscall"
+	"time"
+)
+
+// sysFileTimes returns the times of the attributes of a file. Windows does not report when the
+// file entry was last changed.
+func sysFileTimes(sys interface{}) (creation, access, change time.Time) {
+	attrs, ok := sys.(*syscall.Win32FileAttributeData)
+	if !ok {
+		return
+	}
+	return time.Unix(0, attrs.CreationTime.Nanoseconds()), time.Unix(0, attrs.LastAccessTime.Nanoseconds()), time.Time{}
+}
@@ -0,0 +1,105 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"fmt"
+	"io"
+)
+
+// hashBlockSize is the size of the reads done while hashing the media
+const hashBlockSize = 1024 * 1024
+
+// ProgressFunc is called with the number of bytes processed so far and the total number of bytes
+type ProgressFunc func(processed, total int64)
+
+// HashResult is a stored hash compared to the hash computed from the media.
+// Stored is nil when the image has no such hash.
+type HashResult struct {
+	Stored   []byte
+	Computed []byte
+}
+
+// IsStored reports whether the image has the hash
+func (h HashResult) IsStored() bool {
+	return h.Stored != nil
+}
+
+// Match reports whether the hash is stored and equals the computed one
+func (h HashResult) Match() bool {
+	return h.IsStored() && bytes.Equal(h.Stored, h.Computed)
+}
+
+// HashVerification is the result of verifying the stored hashes of an image
+type HashVerification struct {
+	MD5       HashResult
+	SHA1      HashResult
+	BytesRead int64
+}
+
+// HasStoredHashes reports whether the image has any stored hash
+func (v *HashVerification) HasStoredHashes() bool {
+	return v.MD5.IsStored() || v.SHA1.IsStored()
+}
+
+// Mismatch reports whether a stored hash differs from the computed one
+func (v *HashVerification) Mismatch() bool {
+	return (v.MD5.IsStored() && !v.MD5.Match()) || (v.SHA1.IsStored() && !v.SHA1.Match())
+}
+
+// VerifyHashes reads size bytes of media from r, computes MD5 and SHA1 and compares them to the
+// stored hashes. A nil or all zero stored hash is treated as missing.
+func VerifyHashes(ctx context.Context, r io.ReaderAt, size int64, storedMD5, storedSHA1 []byte, progress ProgressFunc) (*HashVerification, error) {
+	md5Hasher := md5.New()
+	sha1Hasher := sha1.New()
+	w := io.MultiWriter(md5Hasher, sha1Hasher)
+
+	buf := make([]byte, hashBlockSize)
+	var off int64
+	for off < size {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		p := buf
+		if remaining := size - off; remaining < int64(len(p)) {
+			p = p[:remaining]
+		}
+
+		n, err := r.ReadAt(p, off)
+		if n > 0 {
+			_, _ = w.Write(p[:n])
+			off += int64(n)
+		}
+		if err != nil && !(err == io.EOF && off == size) {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("read error at position %d: %w", off, err)
+		}
+		if n == 0 && err == nil {
+			return nil, fmt.Errorf("read error at position %d: %w", off, io.ErrNoProgress)
+		}
+
+		if progress != nil {
+			progress(off, size)
+		}
+	}
+
+	return &HashVerification{
+		MD5:       HashResult{Stored: storedHash(storedMD5), Computed: md5Hasher.Sum(nil)},
+		SHA1:      HashResult{Stored: storedHash(storedSHA1), Computed: sha1Hasher.Sum(nil)},
+		BytesRead: off,
+	}, nil
+}
+
+func storedHash(h []byte) []byte {
+	for _, b := range h {
+		if b != 0 {
+			return append([]byte(nil), h...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package shared
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	_ fs.FS        = &LogicalFS{}
+	_ fs.ReadDirFS = &LogicalFS{}
+	_ fs.StatFS    = &LogicalFS{}
+)
+
+// logicalReadBufferSize is the size of the reads of file data from the media
+const logicalReadBufferSize = 64 * 1024
+
+// LogicalFS exposes the file entries of logical evidence as a file system. File data is read
+// from the media of the evidence.
+type LogicalFS struct {
+	Root *LogicalEntry
+
+	media io.ReaderAt
+}
+
+// NewLogicalFS returns a file system of the entries under root reading file data from media
+func NewLogicalFS(media io.ReaderAt, root *LogicalEntry) *LogicalFS {
+	return &LogicalFS{Root: root, media: media}
+}
+
+// Lookup returns the entry at the slash separated path name, "." is the root
+func (l *LogicalFS) Lookup(name string) (*LogicalEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, fs.ErrInvalid
+	}
+
+	entry := l.Root
+	if name == "." {
+		return entry, nil
+	}
+	for _, elem := range strings.Split(name, "/") {
+		var next *LogicalEntry
+		for _, child := range entry.Children {
+			if child.Name == elem {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil, fs.ErrNotExist
+		}
+		entry = next
+	}
+	return entry, nil
+}
+
+func (l *LogicalFS) Open(name string) (fs.File, error) {
+	entry, err := l.Lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	info := &logicalFileInfo{entry: entry, name: path.Base(name)}
+	if entry.IsDir {
+		return &logicalDir{info: info}, nil
+	}
+
+	readers := make([]io.Reader, 0, len(entry.Extents))
+	for _, e := range entry.Extents {
+		readers = append(readers, io.NewSectionReader(l.media, e.Offset, e.Size))
+	}
+	// small reads would decode the same chunk of the media again and again
+	return &logicalFile{
+		info: info,
+		r:    bufio.NewReaderSize(io.LimitReader(io.MultiReader(readers...), entry.Size), logicalReadBufferSize),
+	}, nil
+}
+
+func (l *LogicalFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := l.Lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if !entry.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return dirEntries(entry), nil
+}
+
+func (l *LogicalFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := l.Lookup(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return &logicalFileInfo{entry: entry, name: path.Base(name)}, nil
+}
+
+// dirEntries returns the children of entry sorted by name
+func dirEntries(entry *LogicalEntry) []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(entry.Children))
+	for _, child := range entry.Children {
+		entries = append(entries, fs.FileInfoToDirEntry(&logicalFileInfo{entry: child, name: child.Name}))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+// logicalFileInfo describes an entry, Sys returns the *LogicalEntry
+type logicalFileInfo struct {
+	entry *LogicalEntry
+	name  string
+}
+
+func (i *logicalFileInfo) Name() string       { return i.name }
+func (i *logicalFileInfo) Size() int64        { return i.entry.Size }
+func (i *logicalFileInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i *logicalFileInfo) IsDir() bool        { return i.entry.IsDir }
+func (i *logicalFileInfo) Sys() interface{}   { return i.entry }
+func (i *logicalFileInfo) Mode() fs.FileMode {
+	if i.entry.IsDir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+type logicalFile struct {
+	info *logicalFileInfo
+	r    io.Reader
+}
+
+func (f *logicalFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *logicalFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *logicalFile) Close() error               { return nil }
+
+type logicalDir struct {
+	info    *logicalFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *logicalDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *logicalDir) Close() error               { return nil }
+func (d *logicalDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *logicalDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = dirEntries(d.info.entry)
+	}
+
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,156 @@
+package shared
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// singleFilesReserve bounds the single files data written besides the file entries
+	singleFilesReserve = 1024
+	// singleFilesEntryReserve bounds the single files data of an entry besides its name
+	singleFilesEntryReserve = 512
+)
+
+// LogicalTree builds the file entry tree of logical evidence while the data of its files is
+// written to the media
+type LogicalTree struct {
+	// Root is the unnamed root directory of the tree
+	Root *LogicalEntry
+
+	media io.Writer
+	// mediaSize returns the number of bytes written to the media so far
+	mediaSize func() int64
+	// reserve bounds the length of the single files data of the tree
+	reserve int64
+}
+
+// NewLogicalTree returns an empty tree whose file data is written to media. mediaSize returns the
+// number of bytes written to the media so far, the offset the data of the next file starts at.
+func NewLogicalTree(media io.Writer, mediaSize func() int64) *LogicalTree {
+	return &LogicalTree{
+		Root:      &LogicalEntry{IsDir: true},
+		media:     media,
+		mediaSize: mediaSize,
+		reserve:   singleFilesReserve + singleFilesEntryReserve,
+	}
+}
+
+// SingleFilesReserve bounds the length in bytes of the UTF-8 single files data of the tree, a
+// byte takes two bytes at most once encoded in UTF-16
+func (t *LogicalTree) SingleFilesReserve() int64 {
+	return t.reserve
+}
+
+// AddFS stores the directories and regular files of fsys under the root of the tree. Other file
+// types are skipped.
+func (t *LogicalTree) AddFS(fsys fs.FS) error {
+	return t.addTree(fsys, ".", t.Root)
+}
+
+// AddDirectory stores the directory at path with its directories and regular files under the root
+// of the tree
+func (t *LogicalTree) AddDirectory(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+
+	dir := t.addEntry(t.Root, filepath.Base(path), info)
+	return t.addTree(os.DirFS(path), ".", dir)
+}
+
+// addTree stores the entries of the directory name of fsys as children of parent
+func (t *LogicalTree) addTree(fsys fs.FS, name string, parent *LogicalEntry) error {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range entries {
+		if !d.IsDir() && !d.Type().IsRegular() {
+			continue
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entryPath := d.Name()
+		if name != "." {
+			entryPath = name + "/" + d.Name()
+		}
+
+		entry := t.addEntry(parent, d.Name(), info)
+		if d.IsDir() {
+			if err := t.addTree(fsys, entryPath, entry); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := t.addFileData(fsys, entryPath, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addEntry adds an entry described by info to parent
+func (t *LogicalTree) addEntry(parent *LogicalEntry, name string, info fs.FileInfo) *LogicalEntry {
+	entry := &LogicalEntry{
+		Name:    name,
+		IsDir:   info.IsDir(),
+		ModTime: info.ModTime(),
+	}
+	entry.CreationTime, entry.AccessTime, entry.ChangeTime = fileTimes(info)
+	parent.Children = append(parent.Children, entry)
+	t.reserve += int64(len(name)) + singleFilesEntryReserve
+	return entry
+}
+
+// addFileData writes the data of the file name of fsys to the media and records it in entry
+func (t *LogicalTree) addFileData(fsys fs.FS, name string, entry *LogicalEntry) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset := t.mediaSize()
+	md5Hasher := md5.New()
+	sha1Hasher := sha1.New()
+	n, err := io.Copy(io.MultiWriter(t.media, md5Hasher, sha1Hasher), f)
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %w", name, err)
+	}
+
+	entry.Size = n
+	if n > 0 {
+		entry.Extents = []LogicalExtent{{Offset: offset, Size: n}}
+	}
+	entry.MD5 = fmt.Sprintf("%x", md5Hasher.Sum(nil))
+	entry.SHA1 = fmt.Sprintf("%x", sha1Hasher.Sum(nil))
+
+	return nil
+}
+
+// fileTimes returns the creation, access and change time of a file, zero for the ones that are not
+// known. They are taken from the stat result of files of the operating system and from the entry
+// of files read from logical evidence.
+func fileTimes(info fs.FileInfo) (creation, access, change time.Time) {
+	if entry, ok := info.Sys().(*LogicalEntry); ok {
+		return entry.CreationTime, entry.AccessTime, entry.ChangeTime
+	}
+	return sysFileTimes(info.Sys())
+}
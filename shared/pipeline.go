@@ -0,0 +1,116 @@
+package shared
+
+import (
+	"sync"
+)
+
+// ChunkEncoder encodes a chunk for storage and reports whether the result is compressed.
+// The returned slice must not be reused by the encoder.
+type ChunkEncoder func(p []byte) (encoded []byte, compressed bool, err error)
+
+// EncodedChunk is a chunk processed by the ChunkPipeline
+type EncodedChunk struct {
+	Data       []byte
+	Encoded    []byte
+	Compressed bool
+	Err        error
+
+	done chan struct{}
+}
+
+// ChunkPipeline encodes chunks on a pool of workers. Chunks are returned in the order they are submitted,
+// at most maxPending chunks are kept in memory at once.
+type ChunkPipeline struct {
+	jobs       chan *EncodedChunk
+	pending    []*EncodedChunk
+	maxPending int
+	wg         sync.WaitGroup
+}
+
+// NewChunkPipeline starts workers goroutines, each one encoding with its own encoder from newEncoder.
+func NewChunkPipeline(workers, maxPending int, newEncoder func() (ChunkEncoder, error)) (*ChunkPipeline, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxPending < workers {
+		maxPending = workers
+	}
+
+	encoders := make([]ChunkEncoder, workers)
+	for i := range encoders {
+		enc, err := newEncoder()
+		if err != nil {
+			return nil, err
+		}
+		encoders[i] = enc
+	}
+
+	cp := &ChunkPipeline{
+		jobs:       make(chan *EncodedChunk, maxPending),
+		pending:    make([]*EncodedChunk, 0, maxPending),
+		maxPending: maxPending,
+	}
+
+	for _, enc := range encoders {
+		cp.wg.Add(1)
+		go cp.work(enc)
+	}
+
+	return cp, nil
+}
+
+func (cp *ChunkPipeline) work(encode ChunkEncoder) {
+	defer cp.wg.Done()
+	for job := range cp.jobs {
+		job.Encoded, job.Compressed, job.Err = encode(job.Data)
+		close(job.done)
+	}
+}
+
+// Submit queues p for encoding. The pipeline keeps a reference to p until it is returned by Next.
+// Callers must make room with Next while Full reports true.
+func (cp *ChunkPipeline) Submit(p []byte) {
+	job := &EncodedChunk{
+		Data: p,
+		done: make(chan struct{}),
+	}
+	cp.pending = append(cp.pending, job)
+	cp.jobs <- job
+}
+
+// Full reports whether the pipeline holds the maximum number of pending chunks
+func (cp *ChunkPipeline) Full() bool {
+	return len(cp.pending) >= cp.maxPending
+}
+
+// Ready reports whether the oldest pending chunk is encoded
+func (cp *ChunkPipeline) Ready() bool {
+	if len(cp.pending) == 0 {
+		return false
+	}
+	select {
+	case <-cp.pending[0].done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Next waits for the oldest pending chunk and returns it, nil if there are no pending chunks
+func (cp *ChunkPipeline) Next() *EncodedChunk {
+	if len(cp.pending) == 0 {
+		return nil
+	}
+	job := cp.pending[0]
+	cp.pending[0] = nil
+	cp.pending = cp.pending[1:]
+
+	<-job.done
+	return job
+}
+
+// Close stops the workers after the submitted chunks are encoded
+func (cp *ChunkPipeline) Close() {
+	close(cp.jobs)
+	cp.wg.Wait()
+}
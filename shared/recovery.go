@@ -0,0 +1,129 @@
+package shared
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/adler32"
+	"io"
+)
+
+// Recovery describes what could be read of an image opened with OpenOptions.Recover
+type Recovery struct {
+	// Size is the number of media bytes that could be recovered, reads end there
+	Size int64
+	// RecordedSize is the media size stored in the image, 0 when the acquisition stopped before
+	// it was written
+	RecordedSize int64
+	// Segments are the numbers of the segments whose chunks were found by scanning the segment
+	// file, their sections could not be read up to the end
+	Segments []uint16
+}
+
+// Truncated reports whether the image is not complete: a segment had to be scanned or less media
+// than recorded could be recovered
+func (r *Recovery) Truncated() bool {
+	return len(r.Segments) > 0 || r.Size < r.RecordedSize
+}
+
+// ScannedChunk is a chunk found by ScanChunks
+type ScannedChunk struct {
+	// Offset is the offset of the chunk in the segment file
+	Offset int64
+	// Size is the stored size of the chunk without padding, for uncompressed chunks it includes
+	// the checksum when the format stores one
+	Size int64
+	// Compressed is set for chunks stored as a zlib stream
+	Compressed bool
+}
+
+// ChunkLayout describes how a format stores the chunks of a segment file
+type ChunkLayout struct {
+	// ChunkSize is the size of a chunk of media data
+	ChunkSize int
+	// Alignment pads every chunk to a multiple of it, 0 for no padding
+	Alignment int64
+	// Checksum is set when uncompressed chunks are followed by their Adler-32 checksum
+	Checksum bool
+	// Boundary reports whether a section starts at offset, scanning stops there. It may be nil.
+	Boundary func(offset int64) bool
+}
+
+// ScanChunks finds the chunks stored one after the other in r from start up to end. Scanning
+// stops at the first data that is not a whole chunk: a valid zlib stream, or an uncompressed
+// chunk whose checksum matches. Without checksums an uncompressed chunk must hold a whole chunk
+// of data that is not all zero, a zero chunk is always stored compressed. A chunk shorter than
+// the chunk size ends the scan, only the last chunk of an image is short.
+func ScanChunks(r io.ReaderAt, start, end int64, layout ChunkLayout) ([]ScannedChunk, error) {
+	// incompressible data makes zlib streams a little larger than the chunk
+	window := int64(layout.ChunkSize) + int64(layout.ChunkSize)/1024 + 64
+	buf := make([]byte, window)
+
+	var chunks []ScannedChunk
+	for off := start; off < end; {
+		if layout.Boundary != nil && layout.Boundary(off) {
+			break
+		}
+
+		n := end - off
+		if n > window {
+			n = window
+		}
+		read, err := r.ReadAt(buf[:n], off)
+		if err != nil && err != io.EOF {
+			return chunks, err
+		}
+
+		size, dataSize, compressed := chunkAt(buf[:read], layout)
+		if size == 0 {
+			break
+		}
+		chunks = append(chunks, ScannedChunk{Offset: off, Size: size, Compressed: compressed})
+		if dataSize < layout.ChunkSize {
+			break
+		}
+
+		off += size
+		if layout.Alignment > 1 && size%layout.Alignment != 0 {
+			off += layout.Alignment - size%layout.Alignment
+		}
+	}
+
+	return chunks, nil
+}
+
+// chunkAt returns the stored size and the data size of the chunk at the start of p, a stored
+// size of 0 when p does not start with a chunk
+func chunkAt(p []byte, layout ChunkLayout) (size int64, dataSize int, compressed bool) {
+	// zlib header: deflate method and a check value that makes it a multiple of 31
+	if len(p) >= 2 && p[0]&0x0f == 8 && (uint16(p[0])<<8|uint16(p[1]))%31 == 0 {
+		br := bytes.NewReader(p)
+		if zr, err := zlib.NewReader(br); err == nil {
+			// the stream ends with its Adler-32 checksum, EOF is only returned when it matches
+			n, err := io.Copy(io.Discard, io.LimitReader(zr, int64(layout.ChunkSize)+1))
+			if err == nil && n > 0 && n <= int64(layout.ChunkSize) {
+				return int64(len(p) - br.Len()), int(n), true
+			}
+		}
+	}
+
+	if !layout.Checksum {
+		if len(p) >= layout.ChunkSize && !isZero(p[:layout.ChunkSize]) {
+			return int64(layout.ChunkSize), layout.ChunkSize, false
+		}
+		return 0, 0, false
+	}
+
+	// a short last chunk is followed by its checksum where the data ends
+	dataSize = len(p) - adler32SumSize
+	if dataSize > layout.ChunkSize {
+		dataSize = layout.ChunkSize
+	}
+	if dataSize <= 0 {
+		return 0, 0, false
+	}
+	if adler32.Checksum(p[:dataSize]) != binary.LittleEndian.Uint32(p[dataSize:]) {
+		return 0, 0, false
+	}
+	return int64(dataSize + adler32SumSize), dataSize, false
+}
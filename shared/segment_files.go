@@ -0,0 +1,207 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SegmentFamily is the prefix of the extensions of the segment files of a set: E for .E01,
+// Ex for .Ex01, L for .L01, Lx for .Lx01 and s for .s01 (SMART). The letters of the extensions
+// follow the case of the family.
+type SegmentFamily string
+
+const (
+	SegmentFamilyE01  SegmentFamily = "E"
+	SegmentFamilyEx01 SegmentFamily = "Ex"
+	SegmentFamilyL01  SegmentFamily = "L"
+	SegmentFamilyLx01 SegmentFamily = "Lx"
+	SegmentFamilyS01  SegmentFamily = "s"
+)
+
+var (
+	segmentFamily = regexp.MustCompile(`^([EeLl][Xx]?|[Ss])$`)
+	// firstSegment matches the extension of a segment numbered 1 to 99, e.g. .E01 or .Lx05
+	firstSegment = regexp.MustCompile(`^\.([EeLl][Xx]?|[Ss])([0-9]{2})$`)
+)
+
+// letters returns the first and last letter of the extensions of the family
+func (f SegmentFamily) letters() (byte, byte) {
+	if f[0] >= 'a' {
+		return 'a', 'z'
+	}
+	return 'A', 'Z'
+}
+
+// Extension returns the extension with the leading dot of segment number in the EnCase naming
+// sequence: E01 to E99 are followed by EAA to EZZ, FAA to FZZ and so on up to ZZZ. The x of
+// the Ex01 and Lx01 families stays in place, Ex99 is followed by ExAA and ExZZ by FxAA.
+func (f SegmentFamily) Extension(number uint16) (string, error) {
+	if !segmentFamily.MatchString(string(f)) {
+		return "", fmt.Errorf("invalid segment family %q", f)
+	}
+	if number == 0 {
+		return "", errors.New("segment numbers start at 1")
+	}
+	if number <= 99 {
+		return fmt.Sprintf(".%s%02d", f, number), nil
+	}
+
+	first, last := f.letters()
+	n := int(number) - 100
+	third := first + byte(n%26)
+	n /= 26
+	second := first + byte(n%26)
+	n /= 26
+	if n > int(last-f[0]) {
+		return "", fmt.Errorf("segment number %d is beyond the last extension of the %s01 family", number, f)
+	}
+	return "." + string(f[0]+byte(n)) + string(f[1:]) + string([]byte{second, third}), nil
+}
+
+// Number returns the segment number of an extension of the family, the reverse of Extension
+func (f SegmentFamily) Number(ext string) (uint16, error) {
+	if !segmentFamily.MatchString(string(f)) {
+		return 0, fmt.Errorf("invalid segment family %q", f)
+	}
+	ext = strings.TrimPrefix(ext, ".")
+	if len(ext) != len(f)+2 || ext[1:len(f)] != string(f[1:]) {
+		return 0, fmt.Errorf("extension %q is not of the %s01 family", ext, f)
+	}
+
+	suffix := ext[len(f):]
+	if ext[0] == f[0] && suffix[0] >= '0' && suffix[0] <= '9' && suffix[1] >= '0' && suffix[1] <= '9' {
+		number := uint16(suffix[0]-'0')*10 + uint16(suffix[1]-'0')
+		if number == 0 {
+			return 0, errors.New("segment numbers start at 1")
+		}
+		return number, nil
+	}
+
+	first, last := f.letters()
+	if ext[0] < f[0] || ext[0] > last || suffix[0] < first || suffix[0] > last || suffix[1] < first || suffix[1] > last {
+		return 0, fmt.Errorf("extension %q is not of the %s01 family", ext, f)
+	}
+	n := int(ext[0]-f[0])*26*26 + int(suffix[0]-first)*26 + int(suffix[1]-first)
+	return uint16(100 + n), nil
+}
+
+// ParseSegmentExtension returns the family and the segment number of the extension of a segment
+// numbered 1 to 99, e.g. E and 1 for .E01. Extensions of later segments depend on the family,
+// see SegmentFamily.Number.
+func ParseSegmentExtension(ext string) (SegmentFamily, uint16, error) {
+	m := firstSegment.FindStringSubmatch(ext)
+	if m == nil {
+		return "", 0, fmt.Errorf("%q is not the extension of one of the first 99 segments", ext)
+	}
+	family := SegmentFamily(m[1])
+	number, err := family.Number(ext)
+	if err != nil {
+		return "", 0, err
+	}
+	return family, number, nil
+}
+
+// SegmentPath returns the path of segment number of the set whose first segment file is at
+// first, e.g. image.EAA for segment 100 of image.E01
+func SegmentPath(first string, number uint16) (string, error) {
+	ext := filepath.Ext(first)
+	family, _, err := ParseSegmentExtension(ext)
+	if err != nil {
+		return "", err
+	}
+	segmentExt, err := family.Extension(number)
+	if err != nil {
+		return "", err
+	}
+	return first[:len(first)-len(ext)] + segmentExt, nil
+}
+
+// SegmentReaderAt is a segment file read with positional reads, e.g. from memory, a memory mapped
+// file or a network source
+type SegmentReaderAt struct {
+	io.ReaderAt
+	// Size is the size of the segment file in bytes
+	Size int64
+}
+
+// SegmentPaths returns the path of the first segment file followed by the paths of the later
+// segments of its family that exist in the same directory, ordered by segment number, e.g.
+// image.E02 to image.E99 and image.EAA for image.E01. Gaps in the numbering do not end the list,
+// so a missing segment is reported when the set is opened. A path that does not have a segment
+// extension is returned alone.
+func SegmentPaths(first string) ([]string, error) {
+	if _, err := os.Stat(first); err != nil {
+		return nil, err
+	}
+	paths := []string{first}
+
+	ext := filepath.Ext(first)
+	family, number, err := ParseSegmentExtension(ext)
+	if err != nil {
+		return paths, nil
+	}
+	entries, err := os.ReadDir(filepath.Dir(first))
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Base(first)
+	base = base[:len(base)-len(ext)]
+	numbers := make(map[string]uint16)
+	var later []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base) {
+			continue
+		}
+		n, err := family.Number(name[len(base):])
+		if err != nil || n <= number {
+			continue
+		}
+		path := filepath.Join(filepath.Dir(first), name)
+		numbers[path] = n
+		later = append(later, path)
+	}
+	sort.Slice(later, func(i, j int) bool {
+		return numbers[later[i]] < numbers[later[j]]
+	})
+
+	return append(paths, later...), nil
+}
+
+// OpenSegmentFiles opens the segment files of the set the first segment file belongs to. No file
+// is left open when an error is returned.
+func OpenSegmentFiles(first string) ([]*os.File, error) {
+	paths, err := SegmentPaths(first)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*os.File, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			_ = CloseFiles(files)
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// CloseFiles closes all files and returns their close errors joined
+func CloseFiles(files []*os.File) error {
+	var errs []error
+	for _, f := range files {
+		if err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
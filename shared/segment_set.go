@@ -0,0 +1,114 @@
+package shared
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// SegmentSetError is returned when the segment files of an image are not one complete set.
+// Segments after the last one passed are detected as missing only when the last one ends with a
+// next section.
+type SegmentSetError struct {
+	// Missing are the segment numbers up to the last segment that were not passed, followed by the
+	// number after the last segment when that one is continued
+	Missing []uint16
+	// Duplicate are the segment numbers passed more than once
+	Duplicate []uint16
+	// Foreign are the segment numbers whose set identifier differs from the one of the first
+	// segment, they belong to another acquisition. Segment number 0 is always foreign.
+	Foreign []uint16
+}
+
+func (e *SegmentSetError) Error() string {
+	var problems []string
+	for _, p := range []struct {
+		name     string
+		segments []uint16
+	}{
+		{"missing", e.Missing},
+		{"duplicate", e.Duplicate},
+		{"foreign", e.Foreign},
+	} {
+		if len(p.segments) == 0 {
+			continue
+		}
+		numbers := make([]string, len(p.segments))
+		for i, n := range p.segments {
+			numbers[i] = fmt.Sprint(n)
+		}
+		problems = append(problems, fmt.Sprintf("%s segments %s", p.name, strings.Join(numbers, ", ")))
+	}
+	return "invalid segment set: " + strings.Join(problems, "; ")
+}
+
+// ValidateSegmentSet checks that numbers are the segment numbers 1 to n of one image, each
+// passed once. ids are the set identifiers of the segments in the order of numbers, nil or all
+// zero for a segment that does not record one. A segment whose identifier differs from the one
+// of the lowest numbered segment that records one is foreign. continued reports whether the highest
+// numbered segment ends with a next section, the segment after it is missing then. The error is a
+// *SegmentSetError.
+func ValidateSegmentSet(numbers []uint16, ids [][]byte, continued bool) error {
+	order := make([]int, len(numbers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return numbers[order[i]] < numbers[order[j]]
+	})
+
+	setErr := &SegmentSetError{}
+	var reference []byte
+	var last uint16
+	seen := make(map[uint16]int)
+	foreign := make(map[uint16]bool)
+	for _, i := range order {
+		number := numbers[i]
+		seen[number]++
+		if number > last {
+			last = number
+		}
+
+		if i >= len(ids) || isZero(ids[i]) {
+			continue
+		}
+		if reference == nil {
+			reference = ids[i]
+		} else if !bytes.Equal(ids[i], reference) && !foreign[number] {
+			foreign[number] = true
+			setErr.Foreign = append(setErr.Foreign, number)
+		}
+	}
+
+	for n := uint16(1); n <= last && n != 0; n++ {
+		switch {
+		case seen[n] == 0:
+			setErr.Missing = append(setErr.Missing, n)
+		case seen[n] > 1:
+			setErr.Duplicate = append(setErr.Duplicate, n)
+		}
+	}
+	if continued && last < math.MaxUint16 {
+		setErr.Missing = append(setErr.Missing, last+1)
+	}
+	if seen[0] > 0 {
+		// segment numbers start at 1
+		setErr.Foreign = append([]uint16{0}, setErr.Foreign...)
+	}
+
+	if len(setErr.Missing) == 0 && len(setErr.Duplicate) == 0 && len(setErr.Foreign) == 0 {
+		return nil
+	}
+	return setErr
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,366 @@
+package shared
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Value types of the entry category of single files data
+const (
+	SINGLE_FILES_ENTRY_IS_PARENT     = "p"
+	SINGLE_FILES_ENTRY_NAME          = "n"
+	SINGLE_FILES_ENTRY_IDENTIFIER    = "id"
+	SINGLE_FILES_ENTRY_FLAGS         = "opr"
+	SINGLE_FILES_ENTRY_SOURCE        = "src"
+	SINGLE_FILES_ENTRY_SUBJECT       = "sub"
+	SINGLE_FILES_ENTRY_LOGICAL_SIZE  = "ls"
+	SINGLE_FILES_ENTRY_EXTENTS       = "be"
+	SINGLE_FILES_ENTRY_MD5           = "ha"
+	SINGLE_FILES_ENTRY_SHA1          = "sha"
+	SINGLE_FILES_ENTRY_CHANGE_TIME   = "mo"
+	SINGLE_FILES_ENTRY_CREATION_TIME = "cr"
+	SINGLE_FILES_ENTRY_WRITE_TIME    = "wr"
+	SINGLE_FILES_ENTRY_ACCESS_TIME   = "ac"
+	SINGLE_FILES_ENTRY_DELETION_TIME = "dl"
+)
+
+// LogicalExtent is a run of file data stored in the media of logical evidence
+type LogicalExtent struct {
+	Offset int64
+	Size   int64
+}
+
+// LogicalEntry is a file or directory of logical evidence
+type LogicalEntry struct {
+	Name  string
+	IsDir bool
+	// Size is the logical size of the file
+	Size int64
+	// Extents locate the file data in the media
+	Extents []LogicalExtent
+
+	CreationTime time.Time
+	// ModTime is the last time the file data was written
+	ModTime    time.Time
+	AccessTime time.Time
+	// ChangeTime is the last time the file entry was modified
+	ChangeTime   time.Time
+	DeletionTime time.Time
+
+	// MD5 and SHA1 are the hex encoded hashes stored for the file, empty when not stored
+	MD5  string
+	SHA1 string
+
+	Children []*LogicalEntry
+}
+
+// ParseSingleFiles parses the UTF-16 little-endian single files data of logical evidence and
+// returns the root of its file entry tree
+func ParseSingleFiles(data []byte) (*LogicalEntry, error) {
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0xfe {
+		data = data[2:]
+	}
+	u16 := make([]uint16, len(data)/2)
+	for i := range u16 {
+		u16[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	text := strings.TrimRight(string(utf16.Decode(u16)), "\x00")
+
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	idx := 0
+	for idx < len(lines) && lines[idx] != "entry" {
+		idx++
+	}
+	if idx == len(lines) {
+		return nil, fmt.Errorf("single files data has no entry category")
+	}
+	idx++
+
+	// the number of entries may precede the value types
+	if idx < len(lines) && isNumberLine(lines[idx]) {
+		idx++
+	}
+	if idx >= len(lines) {
+		return nil, fmt.Errorf("single files data has no entry value types")
+	}
+	types := strings.Split(lines[idx], "\t")
+	idx++
+
+	root, err := parseSingleFilesEntry(lines, &idx, types, 0)
+	if err != nil {
+		return nil, err
+	}
+	root.IsDir = true
+	return root, nil
+}
+
+// maxSingleFilesDepth bounds the nesting of file entries
+const maxSingleFilesDepth = 512
+
+// parseSingleFilesEntry parses the entry at lines[*idx] and its sub entries. An entry is a line
+// with the number of sub entries followed by a line of values.
+func parseSingleFilesEntry(lines []string, idx *int, types []string, depth int) (*LogicalEntry, error) {
+	if depth > maxSingleFilesDepth {
+		return nil, fmt.Errorf("single files entries are nested deeper than %d levels", maxSingleFilesDepth)
+	}
+	if *idx+1 >= len(lines) {
+		return nil, fmt.Errorf("single files entry at line %d is truncated", *idx+1)
+	}
+
+	counts := strings.Split(lines[*idx], "\t")
+	if len(counts) < 2 {
+		return nil, fmt.Errorf("single files entry at line %d has no number of sub entries", *idx+1)
+	}
+	numChildren, err := strconv.Atoi(counts[1])
+	if err != nil || numChildren < 0 {
+		return nil, fmt.Errorf("single files entry at line %d has an invalid number of sub entries %q", *idx+1, counts[1])
+	}
+
+	values := strings.Split(lines[*idx+1], "\t")
+	entry, err := newLogicalEntry(types, values)
+	if err != nil {
+		return nil, fmt.Errorf("single files entry at line %d: %w", *idx+2, err)
+	}
+	*idx += 2
+
+	if numChildren > 0 {
+		entry.IsDir = true
+	}
+	for i := 0; i < numChildren; i++ {
+		child, err := parseSingleFilesEntry(lines, idx, types, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		entry.Children = append(entry.Children, child)
+	}
+
+	return entry, nil
+}
+
+// newLogicalEntry returns the entry described by the values of the given value types
+func newLogicalEntry(types, values []string) (*LogicalEntry, error) {
+	entry := &LogicalEntry{}
+	for i, typ := range types {
+		if i >= len(values) {
+			break
+		}
+		value := values[i]
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch typ {
+		case SINGLE_FILES_ENTRY_IS_PARENT:
+			entry.IsDir = value == "1"
+		case SINGLE_FILES_ENTRY_NAME:
+			entry.Name = value
+		case SINGLE_FILES_ENTRY_LOGICAL_SIZE:
+			entry.Size, err = strconv.ParseInt(value, 10, 64)
+		case SINGLE_FILES_ENTRY_EXTENTS:
+			entry.Extents, err = parseExtents(value)
+		case SINGLE_FILES_ENTRY_MD5:
+			entry.MD5 = entryHash(value)
+		case SINGLE_FILES_ENTRY_SHA1:
+			entry.SHA1 = entryHash(value)
+		case SINGLE_FILES_ENTRY_CREATION_TIME:
+			entry.CreationTime, err = parseUnixTime(value)
+		case SINGLE_FILES_ENTRY_WRITE_TIME:
+			entry.ModTime, err = parseUnixTime(value)
+		case SINGLE_FILES_ENTRY_ACCESS_TIME:
+			entry.AccessTime, err = parseUnixTime(value)
+		case SINGLE_FILES_ENTRY_CHANGE_TIME:
+			entry.ChangeTime, err = parseUnixTime(value)
+		case SINGLE_FILES_ENTRY_DELETION_TIME:
+			entry.DeletionTime, err = parseUnixTime(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", typ, value, err)
+		}
+	}
+
+	if entry.Size < 0 {
+		return nil, fmt.Errorf("invalid logical size %d", entry.Size)
+	}
+	return entry, nil
+}
+
+// parseExtents parses the hex encoded number of extents followed by the offset and size of each
+func parseExtents(value string) ([]LogicalExtent, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	count, err := strconv.ParseUint(fields[0], 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(fields)-1) != 2*count {
+		return nil, fmt.Errorf("%d extents with %d values", count, len(fields)-1)
+	}
+
+	extents := make([]LogicalExtent, 0, count)
+	for i := 1; i < len(fields); i += 2 {
+		offset, err := strconv.ParseInt(fields[i], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseInt(fields[i+1], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		if offset < 0 || size < 0 {
+			return nil, fmt.Errorf("invalid extent at %d of %d bytes", offset, size)
+		}
+		extents = append(extents, LogicalExtent{Offset: offset, Size: size})
+	}
+	return extents, nil
+}
+
+// parseUnixTime parses seconds since the Unix epoch, 0 is no time
+func parseUnixTime(value string) (time.Time, error) {
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || sec == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// entryHash returns a hex encoded hash in lower case, empty when no hash is stored
+func entryHash(value string) string {
+	if strings.Trim(value, "0") == "" {
+		return ""
+	}
+	return strings.ToLower(value)
+}
+
+// isNumberLine reports whether all the fields of line are numbers
+func isNumberLine(line string) bool {
+	for _, field := range strings.Split(line, "\t") {
+		if _, err := strconv.ParseInt(field, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// singleFilesEntryTypes are the value types of the file entries written by FormatSingleFiles
+var singleFilesEntryTypes = []string{
+	SINGLE_FILES_ENTRY_IS_PARENT,
+	SINGLE_FILES_ENTRY_NAME,
+	SINGLE_FILES_ENTRY_IDENTIFIER,
+	SINGLE_FILES_ENTRY_FLAGS,
+	SINGLE_FILES_ENTRY_SOURCE,
+	SINGLE_FILES_ENTRY_SUBJECT,
+	SINGLE_FILES_ENTRY_LOGICAL_SIZE,
+	SINGLE_FILES_ENTRY_EXTENTS,
+	SINGLE_FILES_ENTRY_MD5,
+	SINGLE_FILES_ENTRY_SHA1,
+	SINGLE_FILES_ENTRY_CHANGE_TIME,
+	SINGLE_FILES_ENTRY_CREATION_TIME,
+	SINGLE_FILES_ENTRY_WRITE_TIME,
+	SINGLE_FILES_ENTRY_ACCESS_TIME,
+	SINGLE_FILES_ENTRY_DELETION_TIME,
+}
+
+// FormatSingleFiles returns the UTF-16 little-endian single files data of the file entry tree
+// under root. totalBytes is the size of the media holding the file data.
+func FormatSingleFiles(root *LogicalEntry, totalBytes int64) []byte {
+	var b strings.Builder
+	lines := func(l ...string) {
+		for _, line := range l {
+			b.WriteString(line)
+			b.WriteByte('\n')
+		}
+	}
+
+	lines("5",
+		"rec", "tb\tcl", fmt.Sprintf("%d\t1", totalBytes), "",
+		"perm", "0\t1", "p\tn\ts", "0\t0", "1\t\t", "",
+		"srce", "0\t1", "p\tn\tid\ttb", "0\t0", fmt.Sprintf("1\t\t1\t%d", totalBytes), "",
+		"sub", "0\t1", "p\tn\tid", "0\t0", "1\t\t", "",
+		"entry", fmt.Sprintf("%d\t1", countEntries(root)), strings.Join(singleFilesEntryTypes, "\t"))
+
+	id := 0
+	var formatEntry func(e *LogicalEntry)
+	formatEntry = func(e *LogicalEntry) {
+		id++
+		lines(fmt.Sprintf("0\t%d", len(e.Children)), strings.Join(entryValues(e, id), "\t"))
+		for _, child := range e.Children {
+			formatEntry(child)
+		}
+	}
+	formatEntry(root)
+	lines("")
+
+	u16 := utf16.Encode([]rune(b.String()))
+	data := make([]byte, 2*len(u16))
+	for i, r := range u16 {
+		data[2*i] = byte(r)
+		data[2*i+1] = byte(r >> 8)
+	}
+	return data
+}
+
+// entryNameReplacer replaces the delimiters of single files data in names
+var entryNameReplacer = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+// entryValues returns the values of e in the order of singleFilesEntryTypes
+func entryValues(e *LogicalEntry, id int) []string {
+	isParent := "0"
+	if e.IsDir {
+		isParent = "1"
+	}
+
+	var extents string
+	if len(e.Extents) > 0 {
+		fields := []string{strconv.FormatInt(int64(len(e.Extents)), 16)}
+		for _, x := range e.Extents {
+			fields = append(fields, strconv.FormatInt(x.Offset, 16), strconv.FormatInt(x.Size, 16))
+		}
+		extents = strings.Join(fields, " ")
+	}
+
+	return []string{
+		isParent,
+		entryNameReplacer.Replace(e.Name),
+		strconv.Itoa(id),
+		"0",
+		"1",
+		"0",
+		strconv.FormatInt(e.Size, 10),
+		extents,
+		e.MD5,
+		e.SHA1,
+		formatUnixTime(e.ChangeTime),
+		formatUnixTime(e.CreationTime),
+		formatUnixTime(e.ModTime),
+		formatUnixTime(e.AccessTime),
+		formatUnixTime(e.DeletionTime),
+	}
+}
+
+// formatUnixTime returns the seconds since the Unix epoch, 0 for no time
+func formatUnixTime(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// countEntries returns the number of entries in the tree under e, e included
+func countEntries(e *LogicalEntry) int {
+	n := 1
+	for _, child := range e.Children {
+		n += countEntries(child)
+	}
+	return n
+}
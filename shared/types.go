@@ -1,14 +1,113 @@
 package shared
 
-import "io"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
 
 type EWFReader interface {
 	io.ReadSeeker
 	io.ReaderAt
+	io.Closer
 	Size() int64
+	SegmentCount() int
 	Metadata() map[string]interface{}
+	VerifyHashes(ctx context.Context, progress ProgressFunc) (*HashVerification, error)
+	ChunkCacheStats() ChunkCacheStats
+	Recovery() *Recovery
 }
 
 type EWFWriter interface {
 	io.WriteCloser
 }
+
+// SectorRange is a run of Count sectors starting at sector First
+type SectorRange struct {
+	First uint64
+	Count uint64
+}
+
+// ErrUnreadableSector is matched by the errors of reads that touch sectors which could not be
+// read during acquisition
+var ErrUnreadableSector = errors.New("unreadable sector")
+
+// UnreadableSectorError is returned by reads that touch sectors which could not be read during
+// acquisition when OpenOptions.UnreadableSectorErrors is set
+type UnreadableSectorError struct {
+	// Range is the unreadable range the read touched
+	Range SectorRange
+}
+
+func (e *UnreadableSectorError) Error() string {
+	return fmt.Sprintf("%v: sectors %d-%d were not read during acquisition", ErrUnreadableSector, e.Range.First, e.Range.First+e.Range.Count-1)
+}
+
+func (e *UnreadableSectorError) Is(target error) bool {
+	return target == ErrUnreadableSector
+}
+
+// FindUnreadable returns the first of ranges that overlaps the length bytes at off and the offset
+// where the overlap starts. ranges must be sorted by their first sector.
+func FindUnreadable(ranges []SectorRange, sectorSize, off, length int64) (SectorRange, int64, bool) {
+	if length <= 0 || sectorSize <= 0 {
+		return SectorRange{}, 0, false
+	}
+
+	first := uint64(off / sectorSize)
+	last := uint64((off + length - 1) / sectorSize)
+	for _, r := range ranges {
+		if r.First > last {
+			break
+		}
+		if r.Count == 0 || r.First+r.Count <= first {
+			continue
+		}
+
+		start := int64(r.First) * sectorSize
+		if start < off {
+			start = off
+		}
+		return r, start, true
+	}
+
+	return SectorRange{}, 0, false
+}
+
+// SessionFlagAudioTrack marks a session entry of optical media as an audio track
+const SessionFlagAudioTrack uint32 = 0x00000001
+
+// Session is a session or track of optical media
+type Session struct {
+	Range SectorRange
+	// Flags are the flags of the session entry, see SessionFlagAudioTrack
+	Flags uint32
+}
+
+// SetSessionCounts sets the sector count of sessions from their first sectors, a session runs up
+// to the next one and the last one to the end of the media. Only the first sector and the flags
+// of a session are stored in an image.
+func SetSessionCounts(sessions []Session, totalSectors uint64) error {
+	for i := range sessions {
+		end := totalSectors
+		if i+1 < len(sessions) {
+			end = sessions[i+1].Range.First
+		}
+		if sessions[i].Range.First > end {
+			return fmt.Errorf("session %d starts at sector %d, after sector %d", i+1, sessions[i].Range.First, end)
+		}
+		sessions[i].Range.Count = end - sessions[i].Range.First
+	}
+	return nil
+}
+
+// ValidateSessions checks that every session starts after the one before it
+func ValidateSessions(sessions []Session) error {
+	for i := 1; i < len(sessions); i++ {
+		if sessions[i].Range.First <= sessions[i-1].Range.First {
+			return fmt.Errorf("session %d starts at sector %d, not after session %d at sector %d", i+1, sessions[i].Range.First, i, sessions[i-1].Range.First)
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"hash/adler32"
 	"io"
+	"sync"
 	"unicode/utf16"
 )
 
@@ -105,3 +106,49 @@ func MinInt64(a, b int64) int64 {
 	}
 	return b
 }
+
+// ReaderAtFunc adapts a function to io.ReaderAt
+type ReaderAtFunc func(p []byte, off int64) (int, error)
+
+func (f ReaderAtFunc) ReadAt(p []byte, off int64) (int, error) {
+	return f(p, off)
+}
+
+// NewReaderAt returns rs as an io.ReaderAt. A rs that is not an io.ReaderAt, e.g. a pipe
+// buffered into a seekable reader, is read by seeking and reading under a lock so concurrent
+// reads stay correct; the position of rs is restored after each read.
+func NewReaderAt(rs io.ReadSeeker) io.ReaderAt {
+	if ra, ok := rs.(io.ReaderAt); ok {
+		return ra
+	}
+	return &lockedReaderAt{rs: rs}
+}
+
+type lockedReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (r *lockedReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pos, err := r.rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if _, serr := r.rs.Seek(pos, io.SeekStart); serr != nil && (err == nil || err == io.EOF) {
+			err = serr
+		}
+	}()
+
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err = io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}